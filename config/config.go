@@ -1,7 +1,10 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
+	"os"
+	"strings"
 
 	"gopkg.in/ini.v1"
 )
@@ -18,6 +21,18 @@ type ServerConfig struct {
 	DeleteInterface   bool     `ini:"delete_interface"`
 	ClientDelete      bool     `ini:"delete_client"`
 	WhiteListIpAccess []string `ini:"whitelist_ip_access"`
+	// master key encrypting private keys in database, base64 of 32 bytes
+	// read from file or from environment variable with the given name
+	MasterKeyFile string `ini:"master_key_file"`
+	MasterKeyEnv  string `ini:"master_key_env"`
+	// archived certificates older than this are removed, 0 keeps them forever
+	ArchiveRetentionDays int `ini:"archive_retention_days"`
+	// seconds between checks of devices against database, 0 turns checks off,
+	// policy "report" only logs the drift, "fix" also brings devices in line with database
+	ReconcileInterval int    `ini:"reconcile_interval"`
+	ReconcilePolicy   string `ini:"reconcile_policy"`
+	// directory where wg-quick config of every interface is kept in sync, empty turns it off
+	WgQuickDir string `ini:"wg_quick_dir"`
 }
 
 func LoadConfig(path string) (*ServerConfig, error) {
@@ -36,6 +51,41 @@ func LoadConfig(path string) (*ServerConfig, error) {
 	if cfg.Token == "" {
 		return nil, fmt.Errorf("empty token — please check config")
 	}
+	switch cfg.ReconcilePolicy {
+	case "":
+		cfg.ReconcilePolicy = "report"
+	case "report", "fix":
+	default:
+		return nil, fmt.Errorf("unknown reconcile_policy %q, use report or fix", cfg.ReconcilePolicy)
+	}
 
 	return cfg, nil
 }
+
+// MasterKey returns master key of database encryption, nil when it is not configured
+func (c *ServerConfig) MasterKey() ([]byte, error) {
+	var encoded string
+	switch {
+	case c.MasterKeyFile != "":
+		data, err := os.ReadFile(c.MasterKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read master key: %w", err)
+		}
+		encoded = string(data)
+	case c.MasterKeyEnv != "":
+		encoded = os.Getenv(c.MasterKeyEnv)
+		if encoded == "" {
+			return nil, fmt.Errorf("environment variable %s with master key is empty", c.MasterKeyEnv)
+		}
+	default:
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("master key is not base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
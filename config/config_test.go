@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -71,3 +72,45 @@ whitelist_ip_access = 127.0.0.1,10.0.0.1
 	assert.False(t, cfg.ClientDelete)
 	assert.Equal(t, []string{"127.0.0.1", "10.0.0.1"}, cfg.WhiteListIpAccess)
 }
+
+func TestLoadConfig_ReconcilePolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.ini")
+	require.NoError(t, os.WriteFile(path, []byte("[Server]\ntoken = secret\nreconcile_interval = 60\n"), 0600))
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, 60, cfg.ReconcileInterval)
+	assert.Equal(t, "report", cfg.ReconcilePolicy)
+
+	require.NoError(t, os.WriteFile(path, []byte("[Server]\ntoken = secret\nreconcile_policy = fix\n"), 0600))
+	cfg, err = LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "fix", cfg.ReconcilePolicy)
+
+	require.NoError(t, os.WriteFile(path, []byte("[Server]\ntoken = secret\nreconcile_policy = repair\n"), 0600))
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+}
+
+func TestMasterKey(t *testing.T) {
+	cfg := &ServerConfig{}
+	key, err := cfg.MasterKey()
+	assert.NoError(t, err)
+	assert.Nil(t, key)
+
+	keyFile := filepath.Join(t.TempDir(), "master.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=\n"), 0600))
+	cfg = &ServerConfig{MasterKeyFile: keyFile}
+	key, err = cfg.MasterKey()
+	require.NoError(t, err)
+	assert.Len(t, key, 32)
+	assert.Equal(t, byte(31), key[31])
+
+	t.Setenv("WG_TEST_MASTER_KEY", "c2hvcnQ=")
+	cfg = &ServerConfig{MasterKeyEnv: "WG_TEST_MASTER_KEY"}
+	_, err = cfg.MasterKey()
+	assert.Error(t, err)
+
+	cfg = &ServerConfig{MasterKeyEnv: "WG_TEST_MASTER_KEY_EMPTY"}
+	_, err = cfg.MasterKey()
+	assert.Error(t, err)
+}
@@ -1,6 +1,13 @@
 package controllers
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
 	"wireguard_api/config"
 	"wireguard_api/usecases"
 
@@ -24,12 +31,68 @@ func (ctrl *Controller) GetStatus(c *gin.Context) {
 }
 
 func (ctrl *Controller) GetAllClients(c *gin.Context) {
-	data, err := ctrl.service.GetAllClients()
+	opts, err := listOptions(c)
 	if err != nil {
 		c.JSON(500, gin.H{"result": err.Error()})
 		return
 	}
-	c.JSON(200, gin.H{"result": data})
+	if len(opts.Fields) == 0 {
+		opts.Fields = usecases.DefaultClientFields
+	}
+	data, total, err := ctrl.service.GetAllClients(c.Query("owner"), c.Query("tag"), opts)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	result, err := selectFields(data, opts.Fields)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": result, "total": total})
+}
+
+// listOptions reads limit, offset, sort and fields of list from query
+func listOptions(c *gin.Context) (usecases.ListOptions, error) {
+	var query listQuery
+	err := c.BindQuery(&query)
+	if err != nil {
+		return usecases.ListOptions{}, err
+	}
+	opts := usecases.ListOptions{Limit: query.Limit, Offset: query.Offset, Sort: query.Sort}
+	for _, field := range strings.Split(query.Fields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			opts.Fields = append(opts.Fields, field)
+		}
+	}
+	return opts, nil
+}
+
+// selectFields keeps only requested json fields in every item of list
+func selectFields(list interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return list, nil
+	}
+	raw, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]json.RawMessage
+	err = json.Unmarshal(raw, &items)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]map[string]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		selected := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if v, ok := item[field]; ok {
+				selected[field] = v
+			}
+		}
+		result = append(result, selected)
+	}
+	return result, nil
 }
 
 func (ctrl *Controller) AddClient(c *gin.Context) {
@@ -39,14 +102,169 @@ func (ctrl *Controller) AddClient(c *gin.Context) {
 		c.JSON(500, gin.H{"result": err.Error()})
 		return
 	}
-	data, err := ctrl.service.NewClient(dataJson.Ifname, dataJson.Ip, dataJson.AllowedIp)
+	spec, err := clientSpec(dataJson)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	data, err := ctrl.service.NewClient(spec)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": data})
+}
+
+// clientSpec returns spec of new client, ttl is used when expires_at is empty
+func clientSpec(data addClient) (usecases.ClientSpec, error) {
+	expiresAt := data.ExpiresAt
+	if expiresAt == nil && data.Ttl != "" {
+		ttl, err := time.ParseDuration(data.Ttl)
+		if err != nil {
+			return usecases.ClientSpec{}, err
+		}
+		deadline := time.Now().Add(ttl)
+		expiresAt = &deadline
+	}
+	return usecases.ClientSpec{
+		ClientMeta:     data.ClientMeta,
+		ConfigSettings: data.ConfigSettings,
+		Ifname:         data.Ifname,
+		Ip:             data.Ip,
+		AllowedIp:      data.AllowedIp,
+		Profile:        data.Profile,
+		Public:         data.Public,
+		Psk:            data.Psk,
+		ExpiresAt:      expiresAt,
+	}, nil
+}
+
+// AddClients creates list of clients from JSON array or CSV with header, all clients are created or none.
+func (ctrl *Controller) AddClients(c *gin.Context) {
+	var list []addClient
+	var err error
+	if c.ContentType() == "text/csv" {
+		list, err = parseClientsCsv(c.Request.Body)
+	} else {
+		err = c.BindJSON(&list)
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	specs := make([]usecases.ClientSpec, 0, len(list))
+	for i, v := range list {
+		spec, err := clientSpec(v)
+		if err != nil {
+			c.JSON(500, gin.H{"result": fmt.Sprintf("row %d: %v", i+1, err)})
+			return
+		}
+		specs = append(specs, spec)
+	}
+	data, err := ctrl.service.NewClients(specs)
 	if err != nil {
 		c.JSON(500, gin.H{"result": err.Error()})
 		return
 	}
+	if c.Query("format") == "zip" {
+		archive, err := usecases.ConfigsZip(data)
+		if err != nil {
+			c.JSON(500, gin.H{"result": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="clients.zip"`)
+		c.Data(200, "application/zip", archive)
+		return
+	}
 	c.JSON(200, gin.H{"result": data})
 }
 
+// parseClientsCsv reads clients from CSV, first line is header with names of json fields
+// of /clients/new, tags in one cell are separated by ';' or space.
+func parseClientsCsv(r io.Reader) ([]addClient, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("csv has no clients")
+	}
+	header := rows[0]
+	var list []addClient
+	for i, row := range rows[1:] {
+		var client addClient
+		for j, value := range row {
+			value = strings.TrimSpace(value)
+			column := strings.TrimSpace(header[j])
+			switch column {
+			case "ifname":
+				client.Ifname = value
+			case "ip":
+				client.Ip = value
+			case "alloweip":
+				client.AllowedIp = value
+			case "profile":
+				client.Profile = value
+			case "public":
+				client.Public = value
+			case "psk":
+				if value != "" {
+					psk, err := strconv.ParseBool(value)
+					if err != nil {
+						return nil, fmt.Errorf("row %d: %v", i+1, err)
+					}
+					client.Psk = &psk
+				}
+			case "expires_at":
+				if value != "" {
+					expiresAt, err := time.Parse(time.RFC3339, value)
+					if err != nil {
+						return nil, fmt.Errorf("row %d: %v", i+1, err)
+					}
+					client.ExpiresAt = &expiresAt
+				}
+			case "ttl":
+				client.Ttl = value
+			case "dns":
+				client.Dns = strings.ReplaceAll(value, ";", ",")
+			case "mtu", "keepalive":
+				if value == "" {
+					continue
+				}
+				number, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, fmt.Errorf("row %d: %v", i+1, err)
+				}
+				if column == "mtu" {
+					client.Mtu = number
+				} else {
+					client.Keepalive = &number
+				}
+			case "name":
+				client.Name = value
+			case "owner":
+				client.Owner = value
+			case "email":
+				client.Email = value
+			case "description":
+				client.Description = value
+			case "tags":
+				if value == "" {
+					continue
+				}
+				client.Tags = strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ' ' })
+			default:
+				return nil, fmt.Errorf("unknown csv column %s", header[j])
+			}
+		}
+		if client.Ifname == "" {
+			return nil, fmt.Errorf("row %d: ifname is required", i+1)
+		}
+		list = append(list, client)
+	}
+	return list, nil
+}
+
 func (ctrl *Controller) AddInterface(c *gin.Context) {
 	var dataJson addServer
 	err := c.BindJSON(&dataJson)
@@ -54,9 +272,9 @@ func (ctrl *Controller) AddInterface(c *gin.Context) {
 		c.JSON(500, gin.H{"result": err.Error()})
 		return
 	}
-	data, err := ctrl.service.NewInterface(dataJson.Ifname, dataJson.Ip, dataJson.Endpoint, dataJson.Port)
+	data, err := ctrl.service.NewInterface(dataJson.Ifname, dataJson.Ip, dataJson.Endpoint, dataJson.Port, dataJson.Psk, dataJson.ConfigSettings, dataJson.AddressPools)
 	if err != nil {
-		c.JSON(500, gin.H{"result": err.Error()})
+		c.JSON(linkStatus(err), gin.H{"result": err.Error()})
 		return
 	}
 	c.JSON(200, gin.H{"result": data})
@@ -81,8 +299,23 @@ func (ctrl *Controller) DeleteClient(c *gin.Context) {
 	c.JSON(200, gin.H{"result": "ok"})
 }
 
-func (ctrl *Controller) GetClientArchive(c *gin.Context) {
-	data, err := ctrl.service.GetClientArchive()
+func (ctrl *Controller) UpdateClient(c *gin.Context) {
+	var dataJson updateClient
+	err := c.BindJSON(&dataJson)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	data, err := ctrl.service.UpdateClient(publicParam(c), dataJson.Ip, dataJson.AllowedIp, dataJson.Profile, dataJson.Settings, dataJson.Meta)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": data})
+}
+
+func (ctrl *Controller) RotateClient(c *gin.Context) {
+	data, err := ctrl.service.RotateClient(publicParam(c))
 	if err != nil {
 		c.JSON(500, gin.H{"result": err.Error()})
 		return
@@ -90,6 +323,133 @@ func (ctrl *Controller) GetClientArchive(c *gin.Context) {
 	c.JSON(200, gin.H{"result": data})
 }
 
+func (ctrl *Controller) DisableClient(c *gin.Context) {
+	var client switchClient
+	err := c.BindJSON(&client)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	err = ctrl.service.DisableClient(client.Public)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": "ok"})
+}
+
+func (ctrl *Controller) EnableClient(c *gin.Context) {
+	var client switchClient
+	err := c.BindJSON(&client)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	err = ctrl.service.EnableClient(client.Public)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": "ok"})
+}
+
+func (ctrl *Controller) SetClientQuota(c *gin.Context) {
+	var quota clientQuota
+	err := c.BindJSON(&quota)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	err = ctrl.service.SetClientQuota(quota.Public, quota.Quota, quota.Period)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": "ok"})
+}
+
+func (ctrl *Controller) GetClientQR(c *gin.Context) {
+	size := 256
+	if v := c.Query("size"); v != "" {
+		var err error
+		size, err = strconv.Atoi(v)
+		if err != nil {
+			c.JSON(500, gin.H{"result": err.Error()})
+			return
+		}
+	}
+	format := c.DefaultQuery("format", "png")
+	data, err := ctrl.service.GetClientQR(publicParam(c), format, size)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	contentType := "image/png"
+	if format == "svg" {
+		contentType = "image/svg+xml"
+	}
+	c.Data(200, contentType, data)
+}
+
+// publicParam returns public key from url path, url-safe base64 and not escaped '+' are accepted as well
+func publicParam(c *gin.Context) string {
+	return strings.NewReplacer("-", "+", "_", "/", " ", "+").Replace(c.Param("public"))
+}
+
+func (ctrl *Controller) GetClientArchive(c *gin.Context) {
+	opts, err := listOptions(c)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	if len(opts.Fields) == 0 {
+		opts.Fields = usecases.DefaultClientArchiveFields
+	}
+	data, total, err := ctrl.service.GetClientArchive(opts)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	result, err := selectFields(data, opts.Fields)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": result, "total": total})
+}
+
 func (ctrl *Controller) GetVersion(c *gin.Context) {
 	c.JSON(200, gin.H{"result": config.Version})
 }
+
+func (ctrl *Controller) RestoreClient(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	data, err := ctrl.service.RestoreClient(uint(id))
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": data})
+}
+
+func (ctrl *Controller) DeleteClientArchive(c *gin.Context) {
+	if !ctrl.cfg.ClientDelete {
+		c.JSON(500, gin.H{"result": "Don't have permissions for delete client on this server"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	err = ctrl.service.DeleteClientArchive(uint(id))
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": "ok"})
+}
@@ -1,12 +1,14 @@
 package controllers
 
 import (
+	"archive/zip"
 	"bytes"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 	"wireguard_api/config"
 
 	"wireguard_api/usecases"
@@ -70,10 +72,10 @@ func TestGetAllClients_OK(t *testing.T) {
 	mockSvc := NewMockUsecaseService(ctrl)
 
 	mockSvc.EXPECT().
-		GetAllClients().
+		GetAllClients("", "", usecases.ListOptions{Fields: usecases.DefaultClientFields}).
 		Return([]usecases.ClientResponse{
-			{},
-		}, nil)
+			{Public: "pub", Ip: "10.0.0.2/24", Private: "secret", Config: "config"},
+		}, int64(1), nil)
 
 	controller := NewController(mockSvc, &config.ServerConfig{})
 	r, w := setupGin("GET", "/clients", controller.GetAllClients)
@@ -81,6 +83,9 @@ func TestGetAllClients_OK(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/clients", nil)
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"public":"pub"`)
+	assert.NotContains(t, w.Body.String(), `"private"`)
+	assert.NotContains(t, w.Body.String(), `"config"`)
 }
 
 func TestGetAllClients_Error(t *testing.T) {
@@ -90,8 +95,8 @@ func TestGetAllClients_Error(t *testing.T) {
 	mockSvc := NewMockUsecaseService(ctrl)
 
 	mockSvc.EXPECT().
-		GetAllClients().
-		Return(nil, errors.New("error"))
+		GetAllClients("", "", usecases.ListOptions{Fields: usecases.DefaultClientFields}).
+		Return(nil, int64(0), errors.New("error"))
 
 	controller := NewController(mockSvc, &config.ServerConfig{})
 	r, w := setupGin("GET", "/clients", controller.GetAllClients)
@@ -102,6 +107,28 @@ func TestGetAllClients_Error(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
+func TestGetAllClients_Filter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		GetAllClients("alice", "laptop", usecases.ListOptions{Fields: usecases.DefaultClientFields}).
+		Return([]usecases.ClientResponse{
+			{ClientMeta: usecases.ClientMeta{Owner: "alice", Tags: []string{"laptop"}}},
+		}, int64(1), nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("GET", "/clients", controller.GetAllClients)
+
+	req, _ := http.NewRequest("GET", "/clients?owner=alice&tag=laptop", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"owner":"alice"`)
+	assert.Contains(t, w.Body.String(), `"tags":["laptop"]`)
+}
+
 func TestDeleteClient_OK(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -148,7 +175,7 @@ func TestAddClient_OK(t *testing.T) {
 	mockSvc := NewMockUsecaseService(ctrl)
 
 	mockSvc.EXPECT().
-		NewClient("wg0", "10.0.0.2/32", "0.0.0.0/0").
+		NewClient(usecases.ClientSpec{Ifname: "wg0", Ip: "10.0.0.2/32", AllowedIp: "0.0.0.0/0"}).
 		Return(usecases.ClientResponse{Ifname: "wg0"}, nil)
 
 	controller := NewController(mockSvc, &config.ServerConfig{})
@@ -169,6 +196,195 @@ func TestAddClient_OK(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
+func TestGetAllClients_Page(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		GetAllClients("", "", usecases.ListOptions{Limit: 10, Offset: 20, Sort: "-handshake", Fields: []string{"public", "ip"}}).
+		Return([]usecases.ClientResponse{
+			{Public: "pub", Ip: "10.0.0.2/24", Private: "secret", Config: "config"},
+		}, int64(21), nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("GET", "/clients", controller.GetAllClients)
+
+	req, _ := http.NewRequest("GET", "/clients?limit=10&offset=20&sort=-handshake&fields=public,ip", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":[{"public":"pub","ip":"10.0.0.2/24"}],"total":21}`, w.Body.String())
+}
+
+func TestGetAllClients_BadLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("GET", "/clients", controller.GetAllClients)
+
+	req, _ := http.NewRequest("GET", "/clients?limit=-1", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAddClient_Public(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	public := "VFslwVjYebt0+vsjYiLE5kNP6f6E2eJhwQSzNCLOrFs="
+	mockSvc.EXPECT().
+		NewClient(usecases.ClientSpec{Ifname: "wg0", Public: public}).
+		Return(usecases.ClientResponse{Ifname: "wg0", Public: public, Config: "[Interface]\nPrivateKey = <PRIVATE_KEY>\n"}, nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("POST", "/clients/new", controller.AddClient)
+
+	body := `{"ifname":"wg0","public":"` + public + `"}`
+	req, _ := http.NewRequest("POST", "/clients/new", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"private":""`)
+	assert.Contains(t, w.Body.String(), "PRIVATE_KEY")
+}
+
+func TestAddClient_Profile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		NewClient(usecases.ClientSpec{Ifname: "wg0", Profile: "office"}).
+		Return(usecases.ClientResponse{Ifname: "wg0", Profile: "office"}, nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("POST", "/clients/new", controller.AddClient)
+
+	body := `{"ifname":"wg0","profile":"office"}`
+	req, _ := http.NewRequest("POST", "/clients/new", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"profile":"office"`)
+}
+
+func TestAddClient_Meta(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	meta := usecases.ClientMeta{Name: "phone", Owner: "bob", Email: "bob@example.com", Tags: []string{"mobile", "sales"}}
+	mockSvc.EXPECT().
+		NewClient(usecases.ClientSpec{Ifname: "wg0", ClientMeta: meta}).
+		Return(usecases.ClientResponse{ClientMeta: meta, Ifname: "wg0"}, nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("POST", "/clients/new", controller.AddClient)
+
+	body := `{"ifname":"wg0","name":"phone","owner":"bob","email":"bob@example.com","tags":["mobile","sales"]}`
+	req, _ := http.NewRequest("POST", "/clients/new", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"phone"`)
+}
+
+func TestAddClient_Psk(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	psk := true
+	mockSvc.EXPECT().
+		NewClient(usecases.ClientSpec{Ifname: "wg0", Psk: &psk}).
+		Return(usecases.ClientResponse{Ifname: "wg0", PresharedKey: "psk"}, nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+
+	body := `{
+		"ifname":"wg0",
+		"psk":true
+	}`
+
+	r, w := setupGin("POST", "/client", controller.AddClient)
+
+	req, _ := http.NewRequest("POST", "/client", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"preshared_key":"psk"`)
+}
+
+func TestAddClient_Ttl(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		NewClient(gomock.Any()).
+		DoAndReturn(func(spec usecases.ClientSpec) (usecases.ClientResponse, error) {
+			assert.Equal(t, "wg0", spec.Ifname)
+			assert.WithinDuration(t, time.Now().Add(2*time.Hour), *spec.ExpiresAt, time.Minute)
+			return usecases.ClientResponse{Ifname: "wg0", ExpiresAt: spec.ExpiresAt}, nil
+		})
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+
+	body := `{
+		"ifname":"wg0",
+		"ttl":"2h"
+	}`
+
+	r, w := setupGin("POST", "/client", controller.AddClient)
+
+	req, _ := http.NewRequest("POST", "/client", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAddClient_BadTtl(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+
+	body := `{
+		"ifname":"wg0",
+		"ttl":"two hours"
+	}`
+
+	r, w := setupGin("POST", "/client", controller.AddClient)
+
+	req, _ := http.NewRequest("POST", "/client", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
 func TestAddClient_Error(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -176,7 +392,7 @@ func TestAddClient_Error(t *testing.T) {
 	mockSvc := NewMockUsecaseService(ctrl)
 
 	mockSvc.EXPECT().
-		NewClient(gomock.Any(), gomock.Any(), gomock.Any()).
+		NewClient(gomock.Any()).
 		Return(usecases.ClientResponse{}, errors.New("create error"))
 
 	controller := NewController(mockSvc, &config.ServerConfig{})
@@ -197,6 +413,28 @@ func TestAddClient_Error(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
+func TestAddClient_Settings(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	keepalive := 0
+	mockSvc.EXPECT().
+		NewClient(usecases.ClientSpec{Ifname: "wg0", ConfigSettings: usecases.ConfigSettings{Dns: "10.0.0.1", Mtu: 1380, Keepalive: &keepalive}}).
+		Return(usecases.ClientResponse{Ifname: "wg0"}, nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("POST", "/clients/new", controller.AddClient)
+
+	body := `{"ifname":"wg0","dns":"10.0.0.1","mtu":1380,"keepalive":0}`
+	req, _ := http.NewRequest("POST", "/clients/new", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
 func TestAddInterface_OK(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -204,7 +442,7 @@ func TestAddInterface_OK(t *testing.T) {
 	mockSvc := NewMockUsecaseService(ctrl)
 
 	mockSvc.EXPECT().
-		NewInterface("wg0", "10.0.0.1/24", "1.2.3.4", 51820).
+		NewInterface("wg0", "10.0.0.1/24", "1.2.3.4", 51820, false, usecases.ConfigSettings{}, usecases.AddressPools{}).
 		Return(usecases.ServerInterfaces{Ifname: "wg0"}, nil)
 
 	controller := NewController(mockSvc, &config.ServerConfig{})
@@ -233,7 +471,7 @@ func TestAddInterface_Error(t *testing.T) {
 	mockSvc := NewMockUsecaseService(ctrl)
 
 	mockSvc.EXPECT().
-		NewInterface(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		NewInterface(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(usecases.ServerInterfaces{}, errors.New("fail"))
 
 	controller := NewController(mockSvc, &config.ServerConfig{})
@@ -255,6 +493,294 @@ func TestAddInterface_Error(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
+func TestUpdateClient_OK(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	ip := "10.0.0.5/24"
+	mockSvc.EXPECT().
+		UpdateClient("ab+c/d=", &ip, gomock.Nil(), gomock.Nil(), gomock.Nil(), gomock.Nil()).
+		Return(usecases.ClientResponse{Ifname: "wg0", Ip: ip}, nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("PATCH", "/clients/:public", controller.UpdateClient)
+	r.UseRawPath = true
+
+	body := `{"ip":"10.0.0.5/24"}`
+	req, _ := http.NewRequest("PATCH", "/clients/ab%2Bc%2Fd%3D", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"ip":"10.0.0.5/24"`)
+}
+
+func TestUpdateClient_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		UpdateClient("pubkey", gomock.Nil(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(usecases.ClientResponse{}, errors.New("record not found"))
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("PATCH", "/clients/:public", controller.UpdateClient)
+
+	body := `{"alloweip":"10.10.0.0/16"}`
+	req, _ := http.NewRequest("PATCH", "/clients/pubkey", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestRotateClient_OK(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		RotateClient("ab+c/d=").
+		Return(usecases.ClientResponse{Ifname: "wg0", Public: "newkey"}, nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("POST", "/clients/:public/rotate", controller.RotateClient)
+	r.UseRawPath = true
+
+	req, _ := http.NewRequest("POST", "/clients/ab%2Bc%2Fd%3D/rotate", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"public":"newkey"`)
+}
+
+func TestRotateClient_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		RotateClient("pubkey").
+		Return(usecases.ClientResponse{}, errors.New("record not found"))
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("POST", "/clients/:public/rotate", controller.RotateClient)
+
+	req, _ := http.NewRequest("POST", "/clients/pubkey/rotate", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestDisableClient_OK(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		DisableClient("pubkey").
+		Return(nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+
+	body := `{"public":"pubkey"}`
+	r, w := setupGin("POST", "/clients/disable", controller.DisableClient)
+
+	req, _ := http.NewRequest("POST", "/clients/disable", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestDisableClient_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		DisableClient("pubkey").
+		Return(errors.New("record not found"))
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+
+	body := `{"public":"pubkey"}`
+	r, w := setupGin("POST", "/clients/disable", controller.DisableClient)
+
+	req, _ := http.NewRequest("POST", "/clients/disable", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestEnableClient_OK(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		EnableClient("pubkey").
+		Return(nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+
+	body := `{"public":"pubkey"}`
+	r, w := setupGin("POST", "/clients/enable", controller.EnableClient)
+
+	req, _ := http.NewRequest("POST", "/clients/enable", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestEnableClient_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		EnableClient("pubkey").
+		Return(errors.New("record not found"))
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+
+	body := `{"public":"pubkey"}`
+	r, w := setupGin("POST", "/clients/enable", controller.EnableClient)
+
+	req, _ := http.NewRequest("POST", "/clients/enable", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestSetClientQuota_OK(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		SetClientQuota("pubkey", int64(1073741824), "monthly").
+		Return(nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+
+	body := `{"public":"pubkey","quota":1073741824,"period":"monthly"}`
+	r, w := setupGin("POST", "/clients/quota", controller.SetClientQuota)
+
+	req, _ := http.NewRequest("POST", "/clients/quota", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSetClientQuota_BadPeriod(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+
+	body := `{"public":"pubkey","quota":100,"period":"weekly"}`
+	r, w := setupGin("POST", "/clients/quota", controller.SetClientQuota)
+
+	req, _ := http.NewRequest("POST", "/clients/quota", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSetClientQuota_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		SetClientQuota("pubkey", int64(100), "").
+		Return(errors.New("record not found"))
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+
+	body := `{"public":"pubkey","quota":100}`
+	r, w := setupGin("POST", "/clients/quota", controller.SetClientQuota)
+
+	req, _ := http.NewRequest("POST", "/clients/quota", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestGetClientQR_OK(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		GetClientQR("ab+c/d=", "png", 256).
+		Return([]byte("png"), nil)
+	mockSvc.EXPECT().
+		GetClientQR("ab+c/d=", "svg", 512).
+		Return([]byte("<svg/>"), nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, _ := setupGin("GET", "/clients/:public/qr", controller.GetClientQR)
+	r.UseRawPath = true
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/clients/ab%2Bc%2Fd%3D/qr", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/clients/ab-c_d=/qr?format=svg&size=512", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+}
+
+func TestGetClientQR_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		GetClientQR("pubkey", "png", 256).
+		Return(nil, errors.New("client pubkey not found"))
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("GET", "/clients/:public/qr", controller.GetClientQR)
+
+	req, _ := http.NewRequest("GET", "/clients/pubkey/qr", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/clients/pubkey/qr?size=big", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
 func TestGetClientArchive_OK(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -262,10 +788,10 @@ func TestGetClientArchive_OK(t *testing.T) {
 	mockSvc := NewMockUsecaseService(ctrl)
 
 	mockSvc.EXPECT().
-		GetClientArchive().
+		GetClientArchive(usecases.ListOptions{Fields: usecases.DefaultClientArchiveFields}).
 		Return([]usecases.ClientResponse{
-			{Public: "key1"},
-		}, nil)
+			{Public: "key1", Private: "secret", Config: "config", Reason: "rotated"},
+		}, int64(1), nil)
 
 	controller := NewController(mockSvc, &config.ServerConfig{})
 
@@ -275,6 +801,33 @@ func TestGetClientArchive_OK(t *testing.T) {
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"public":"key1"`)
+	assert.Contains(t, w.Body.String(), `"reason":"rotated"`)
+	assert.NotContains(t, w.Body.String(), `"private"`)
+	assert.NotContains(t, w.Body.String(), `"config"`)
+}
+
+func TestGetClientArchive_Secrets(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		GetClientArchive(usecases.ListOptions{Fields: []string{"public", "private", "config"}}).
+		Return([]usecases.ClientResponse{
+			{Public: "key1", Private: "secret", Config: "config"},
+		}, int64(1), nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("GET", "/clients/archive", controller.GetClientArchive)
+
+	req, _ := http.NewRequest("GET", "/clients/archive?fields=public,private,config", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":[{"public":"key1","private":"secret","config":"config"}],"total":1}`, w.Body.String())
 }
 
 func TestGetClientArchive_Error(t *testing.T) {
@@ -284,8 +837,8 @@ func TestGetClientArchive_Error(t *testing.T) {
 	mockSvc := NewMockUsecaseService(ctrl)
 
 	mockSvc.EXPECT().
-		GetClientArchive().
-		Return(nil, errors.New("archive error"))
+		GetClientArchive(usecases.ListOptions{Fields: usecases.DefaultClientArchiveFields}).
+		Return(nil, int64(0), errors.New("archive error"))
 
 	controller := NewController(mockSvc, &config.ServerConfig{})
 
@@ -307,3 +860,173 @@ func TestGetVersion_OK(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestRestoreClient_OK(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		RestoreClient(uint(12)).
+		Return(usecases.ClientResponse{Ifname: "wg0", Ip: "10.0.0.2/24"}, nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("POST", "/clients/archive/:id/restore", controller.RestoreClient)
+
+	req, _ := http.NewRequest("POST", "/clients/archive/12/restore", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"ip":"10.0.0.2/24"`)
+}
+
+func TestRestoreClient_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		RestoreClient(uint(12)).
+		Return(usecases.ClientResponse{}, errors.New("ip 10.0.0.2/24 already used by another client"))
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("POST", "/clients/archive/:id/restore", controller.RestoreClient)
+
+	req, _ := http.NewRequest("POST", "/clients/archive/12/restore", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestDeleteClientArchive_OK(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		DeleteClientArchive(uint(5)).
+		Return(nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{ClientDelete: true})
+	r, w := setupGin("DELETE", "/clients/archive/:id", controller.DeleteClientArchive)
+
+	req, _ := http.NewRequest("DELETE", "/clients/archive/5", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestDeleteClientArchive_NoPermission(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	controller := NewController(mockSvc, &config.ServerConfig{ClientDelete: false})
+	r, w := setupGin("DELETE", "/clients/archive/:id", controller.DeleteClientArchive)
+
+	req, _ := http.NewRequest("DELETE", "/clients/archive/5", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestAddClients_Json(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		NewClients([]usecases.ClientSpec{
+			{Ifname: "wg0", ClientMeta: usecases.ClientMeta{Name: "alice"}},
+			{Ifname: "wg0", Ip: "10.0.0.9/24"},
+		}).
+		Return([]usecases.ClientResponse{{Ifname: "wg0"}, {Ifname: "wg0"}}, nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("POST", "/clients/bulk", controller.AddClients)
+
+	body := `[{"ifname":"wg0","name":"alice"},{"ifname":"wg0","ip":"10.0.0.9/24"}]`
+	req, _ := http.NewRequest("POST", "/clients/bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAddClients_CsvZip(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		NewClients([]usecases.ClientSpec{
+			{Ifname: "wg0", AllowedIp: "10.1.0.0/16", ClientMeta: usecases.ClientMeta{Name: "alice", Tags: []string{"laptop", "office"}}},
+			{Ifname: "wg0", Ip: "10.0.0.9/24"},
+		}).
+		Return([]usecases.ClientResponse{
+			{ClientMeta: usecases.ClientMeta{Name: "alice"}, Ip: "10.0.0.2/24", Config: "config-alice"},
+			{Ip: "10.0.0.9/24", Config: "config-9"},
+		}, nil)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("POST", "/clients/bulk", controller.AddClients)
+
+	body := "ifname,ip,alloweip,name,tags\nwg0,,10.1.0.0/16,alice,laptop;office\nwg0,10.0.0.9/24,,,\n"
+	req, _ := http.NewRequest("POST", "/clients/bulk?format=zip", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	assert.NoError(t, err)
+	assert.Len(t, archive.File, 2)
+	assert.Equal(t, "alice.conf", archive.File[0].Name)
+	assert.Equal(t, "10.0.0.9.conf", archive.File[1].Name)
+}
+
+func TestAddClients_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	mockSvc.EXPECT().
+		NewClients(gomock.Any()).
+		Return(nil, errors.New("row 2: ip 10.0.0.9 already used by another client"))
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("POST", "/clients/bulk", controller.AddClients)
+
+	body := `[{"ifname":"wg0"},{"ifname":"wg0","ip":"10.0.0.9/24"}]`
+	req, _ := http.NewRequest("POST", "/clients/bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "row 2")
+}
+
+func TestAddClients_BadCsv(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSvc := NewMockUsecaseService(ctrl)
+
+	controller := NewController(mockSvc, &config.ServerConfig{})
+	r, w := setupGin("POST", "/clients/bulk", controller.AddClients)
+
+	body := "ifname,color\nwg0,red\n"
+	req, _ := http.NewRequest("POST", "/clients/bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown csv column color")
+}
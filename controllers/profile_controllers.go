@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func (ctrl *Controller) GetProfiles(c *gin.Context) {
+	data, err := ctrl.service.GetProfiles()
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": data})
+}
+
+func (ctrl *Controller) AddProfile(c *gin.Context) {
+	var dataJson addProfile
+	err := c.BindJSON(&dataJson)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	data, err := ctrl.service.NewProfile(dataJson.Name, dataJson.Routes, dataJson.Description)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": data})
+}
+
+func (ctrl *Controller) UpdateProfile(c *gin.Context) {
+	var dataJson updateProfile
+	err := c.BindJSON(&dataJson)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	data, err := ctrl.service.UpdateProfile(c.Param("name"), dataJson.Routes, dataJson.Description)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": data})
+}
+
+func (ctrl *Controller) DeleteProfile(c *gin.Context) {
+	err := ctrl.service.DeleteProfile(c.Param("name"))
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": "ok"})
+}
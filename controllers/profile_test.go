@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"wireguard_api/config"
+	"wireguard_api/usecases"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProfiles_OK(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		GetProfiles().
+		Return([]usecases.RoutingProfile{{Name: "full-tunnel", Routes: []string{"0.0.0.0/0", "::/0"}}}, nil)
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("GET", "/profiles", ctrl.GetProfiles)
+	req, _ := http.NewRequest("GET", "/profiles", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"routes":["0.0.0.0/0","::/0"]`)
+}
+
+func TestAddProfile_OK(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		NewProfile("office", []string{"10.1.0.0/16", "10.2.0.0/16"}, "main office").
+		Return(usecases.RoutingProfile{Name: "office", Routes: []string{"10.1.0.0/16", "10.2.0.0/16"}}, nil)
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("POST", "/profiles/new", ctrl.AddProfile)
+	body := `{"name":"office","routes":["10.1.0.0/16","10.2.0.0/16"],"description":"main office"}`
+	req, _ := http.NewRequest("POST", "/profiles/new", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAddProfile_Error(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		NewProfile("office", []string{"10.1.0.0"}, "").
+		Return(usecases.RoutingProfile{}, errors.New("invalid route 10.1.0.0"))
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("POST", "/profiles/new", ctrl.AddProfile)
+	body := `{"name":"office","routes":["10.1.0.0"]}`
+	req, _ := http.NewRequest("POST", "/profiles/new", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestUpdateProfile_OK(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	routes := []string{"10.1.0.0/16"}
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		UpdateProfile("office", &routes, gomock.Nil()).
+		Return(usecases.ProfileUpdate{
+			RoutingProfile: usecases.RoutingProfile{Name: "office", Routes: routes},
+			Clients:        []string{"pub1"},
+		}, nil)
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("PATCH", "/profiles/:name", ctrl.UpdateProfile)
+	body := `{"routes":["10.1.0.0/16"]}`
+	req, _ := http.NewRequest("PATCH", "/profiles/office", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"clients":["pub1"]`)
+}
+
+func TestDeleteProfile_Error(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		DeleteProfile("office").
+		Return(errors.New("profile office is used by 2 clients"))
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("DELETE", "/profiles/:name", ctrl.DeleteProfile)
+	req, _ := http.NewRequest("DELETE", "/profiles/office", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "used by 2 clients")
+}
@@ -1,11 +1,29 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"wireguard_api/usecases"
+	"wireguard_api/wg"
 
 	"github.com/gin-gonic/gin"
 )
 
+// linkStatus returns HTTP status of error of link operation, other errors are 500
+func linkStatus(err error) int {
+	switch {
+	case errors.Is(err, wg.ErrExists):
+		return 409
+	case errors.Is(err, wg.ErrNoDevice):
+		return 404
+	case errors.Is(err, wg.ErrPermission):
+		return 403
+	}
+	return 500
+}
+
 func (ctrl *Controller) CtrlDeleteServer(c *gin.Context) {
 	if !ctrl.cfg.DeleteInterface {
 		c.JSON(500, gin.H{"result": "Don't have permissions for delete interface on this server"})
@@ -19,12 +37,59 @@ func (ctrl *Controller) CtrlDeleteServer(c *gin.Context) {
 	}
 	err = ctrl.service.DeleteServer(ser.Private, ser.Ifname)
 	if err != nil {
-		c.JSON(500, gin.H{"result": err.Error()})
+		c.JSON(linkStatus(err), gin.H{"result": err.Error()})
 		return
 	}
 	c.JSON(200, gin.H{"result": "ok"})
 }
 
+func (ctrl *Controller) CtrlUpdateInterface(c *gin.Context) {
+	var dataJson updateServer
+	err := c.BindJSON(&dataJson)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	data, err := ctrl.service.UpdateInterface(c.Param("ifname"), usecases.InterfaceChanges{
+		Endpoint:  dataJson.Endpoint,
+		Port:      dataJson.Port,
+		Dns:       dataJson.Dns,
+		Mtu:       dataJson.Mtu,
+		Keepalive: dataJson.Keepalive,
+		Pools:     dataJson.Pools,
+		Excluded:  dataJson.Excluded,
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": data})
+}
+
+func (ctrl *Controller) CtrlRotateInterfaceKey(c *gin.Context) {
+	// device has only one private key, second device with old key would need its own port
+	// and routes to clients still on old key, so grace period is rejected instead of ignored
+	if _, ok := c.GetQuery("grace"); ok {
+		c.JSON(500, gin.H{"result": "grace period is not supported, old key of interface is dropped at once"})
+		return
+	}
+	data, err := ctrl.service.RotateInterfaceKey(c.Param("ifname"))
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": data})
+}
+
+func (ctrl *Controller) CtrlGetDrift(c *gin.Context) {
+	data, err := ctrl.service.GetDrift()
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": data})
+}
+
 func (ctrl *Controller) CtrlStopServer(c *gin.Context) {
 	var ser ServerStartStop
 	err := c.BindJSON(&ser)
@@ -34,7 +99,7 @@ func (ctrl *Controller) CtrlStopServer(c *gin.Context) {
 	}
 	err = ctrl.service.StopInterface(ser.Ifname)
 	if err != nil {
-		c.JSON(500, gin.H{"result": err.Error()})
+		c.JSON(linkStatus(err), gin.H{"result": err.Error()})
 		return
 	}
 	c.JSON(200, gin.H{"result": "ok"})
@@ -49,7 +114,7 @@ func (ctrl *Controller) CtrlStartServer(c *gin.Context) {
 	}
 	err = ctrl.service.StartInterface(ser.Ifname)
 	if err != nil {
-		c.JSON(500, gin.H{"result": err.Error()})
+		c.JSON(linkStatus(err), gin.H{"result": err.Error()})
 		return
 	}
 	c.JSON(200, gin.H{"result": "ok"})
@@ -103,14 +168,107 @@ func (ctrl *Controller) SetMasquerade(c *gin.Context) {
 }
 
 func (ctrl *Controller) CtrlGetServerArchive(c *gin.Context) {
-	data, err := ctrl.service.GetServerArchive()
+	opts, err := listOptions(c)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	if len(opts.Fields) == 0 {
+		opts.Fields = usecases.DefaultServerArchiveFields
+	}
+	data, total, err := ctrl.service.GetServerArchive(opts)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	result, err := selectFields(data, opts.Fields)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": result, "total": total})
+}
+
+func (ctrl *Controller) CtrlRestoreInterface(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	withClients, err := strconv.ParseBool(c.DefaultQuery("clients", "false"))
 	if err != nil {
 		c.JSON(500, gin.H{"result": err.Error()})
 		return
 	}
+	data, err := ctrl.service.RestoreInterface(uint(id), withClients)
+	if err != nil {
+		c.JSON(linkStatus(err), gin.H{"result": err.Error()})
+		return
+	}
 	c.JSON(200, gin.H{"result": data})
 }
 
+func (ctrl *Controller) CtrlImportInterface(c *gin.Context) {
+	var dataJson importServer
+	err := c.BindJSON(&dataJson)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	data, err := ctrl.service.ImportInterface(usecases.ImportSpec{
+		Ifname:   dataJson.Ifname,
+		Endpoint: dataJson.Endpoint,
+		Config:   dataJson.Config,
+		Clients:  dataJson.Clients,
+		Adopt:    dataJson.Adopt,
+	})
+	if err != nil {
+		c.JSON(linkStatus(err), gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": data})
+}
+
+func (ctrl *Controller) CtrlDeleteServerArchive(c *gin.Context) {
+	if !ctrl.cfg.DeleteInterface {
+		c.JSON(500, gin.H{"result": "Don't have permissions for delete interface on this server"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	err = ctrl.service.DeleteServerArchive(uint(id))
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"result": "ok"})
+}
+
+func (ctrl *Controller) CtrlExportInterface(c *gin.Context) {
+	ifname := c.Param("ifname")
+	data, err := ctrl.service.ExportInterface(ifname)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, ifname))
+	c.Data(200, "application/zip", data)
+}
+
+func (ctrl *Controller) CtrlGetServerConfig(c *gin.Context) {
+	ifname := c.Param("ifname")
+	data, err := ctrl.service.GetServerConfig(ifname)
+	if err != nil {
+		c.JSON(500, gin.H{"result": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.conf"`, ifname))
+	c.Data(200, "text/plain; charset=utf-8", []byte(data))
+}
+
 func (ctrl *Controller) CtrlGetInterfaces(c *gin.Context) {
 	data, err := ctrl.service.GetServerInterfaces()
 	if err != nil {
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"wireguard_api/config"
 	"wireguard_api/usecases"
+	"wireguard_api/wg"
 
 	gomock "github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -54,6 +55,36 @@ func TestCtrlStopServer_Error(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
+func TestCtrlStartServer_LinkErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{&wg.LinkError{Op: "add link", Ifname: "wg0", Err: wg.ErrExists}, http.StatusConflict},
+		{&wg.LinkError{Op: "set up", Ifname: "wg0", Err: wg.ErrNoDevice}, http.StatusNotFound},
+		{&wg.LinkError{Op: "add link", Ifname: "wg0", Err: wg.ErrPermission}, http.StatusForbidden},
+		{errors.New("record not found"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		gc := gomock.NewController(t)
+		mockSvc := NewMockUsecaseService(gc)
+		mockSvc.EXPECT().
+			StartInterface("wg0").
+			Return(tt.err)
+
+		ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+		r, w := setupGin("POST", "/start", ctrl.CtrlStartServer)
+		req, _ := http.NewRequest("POST", "/start", strings.NewReader(`{"ifname":"wg0"}`))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.code, w.Code)
+		assert.Contains(t, w.Body.String(), tt.err.Error())
+		gc.Finish()
+	}
+}
+
 func TestCtrlDeleteServer_OK(t *testing.T) {
 	gc := gomock.NewController(t)
 	defer gc.Finish()
@@ -355,10 +386,10 @@ func TestCtrlGetServerArchive_OK(t *testing.T) {
 
 	mockSvc := NewMockUsecaseService(gc)
 	mockSvc.EXPECT().
-		GetServerArchive().
+		GetServerArchive(usecases.ListOptions{Fields: usecases.DefaultServerArchiveFields}).
 		Return([]usecases.ServerInterfaces{
-			{Ifname: "wg0"},
-		}, nil)
+			{Ifname: "wg0", Private: "secret", Config: "config"},
+		}, int64(1), nil)
 
 	ctrl := NewController(mockSvc, &config.ServerConfig{})
 
@@ -367,6 +398,9 @@ func TestCtrlGetServerArchive_OK(t *testing.T) {
 
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"ifname":"wg0"`)
+	assert.NotContains(t, w.Body.String(), `"private"`)
+	assert.NotContains(t, w.Body.String(), `"config"`)
 }
 
 func TestCtrlGetInterfaces_OK(t *testing.T) {
@@ -442,3 +476,399 @@ func TestCtrlGetIptables_Error(t *testing.T) {
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
+
+func TestCtrlRestoreInterface_OK(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		RestoreInterface(uint(3), true).
+		Return(usecases.RestoredInterface{
+			ServerInterfaces: usecases.ServerInterfaces{Ifname: "wg0"},
+			Clients:          []usecases.ClientResponse{{Ifname: "wg0"}},
+		}, nil)
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("POST", "/interface/archive/:id/restore", ctrl.CtrlRestoreInterface)
+	req, _ := http.NewRequest("POST", "/interface/archive/3/restore?clients=true", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"clients":[`)
+}
+
+func TestCtrlRestoreInterface_Error(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		RestoreInterface(uint(3), false).
+		Return(usecases.RestoredInterface{}, errors.New("interface wg0 already exist"))
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("POST", "/interface/archive/:id/restore", ctrl.CtrlRestoreInterface)
+	req, _ := http.NewRequest("POST", "/interface/archive/3/restore", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestCtrlImportInterface_OK(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		ImportInterface(usecases.ImportSpec{Ifname: "wg0", Endpoint: "vpn.example.com", Config: "[Interface]\n", Adopt: true}).
+		Return(usecases.ImportedInterface{
+			ServerInterfaces: usecases.ServerInterfaces{Ifname: "wg0"},
+			Clients:          []usecases.ClientResponse{{Ifname: "wg0", Public: "pub1"}},
+			NoPrivateKey:     []string{"pub1"},
+		}, nil)
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("POST", "/interface/import", ctrl.CtrlImportInterface)
+	body := `{"ifname":"wg0","endpoint":"vpn.example.com","config":"[Interface]\n","adopt":true}`
+	req, _ := http.NewRequest("POST", "/interface/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"no_private_key":["pub1"]`)
+}
+
+func TestCtrlImportInterface_Error(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		ImportInterface(gomock.Any()).
+		Return(usecases.ImportedInterface{}, errors.New("peer pub1 has no address in subnets 10.0.0.1/24"))
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("POST", "/interface/import", ctrl.CtrlImportInterface)
+	body := `{"ifname":"wg0","endpoint":"vpn.example.com","config":"[Interface]\n"}`
+	req, _ := http.NewRequest("POST", "/interface/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestCtrlDeleteServerArchive_OK(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		DeleteServerArchive(uint(3)).
+		Return(nil)
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{DeleteInterface: true})
+
+	r, w := setupGin("DELETE", "/interface/archive/:id", ctrl.CtrlDeleteServerArchive)
+	req, _ := http.NewRequest("DELETE", "/interface/archive/3", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestCtrlDeleteServerArchive_Error(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		DeleteServerArchive(uint(3)).
+		Return(errors.New("record not found"))
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{DeleteInterface: true})
+
+	r, w := setupGin("DELETE", "/interface/archive/:id", ctrl.CtrlDeleteServerArchive)
+	req, _ := http.NewRequest("DELETE", "/interface/archive/3", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestCtrlExportInterface_OK(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		ExportInterface("wg0").
+		Return([]byte("PK"), nil)
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("GET", "/interface/:ifname/export", ctrl.CtrlExportInterface)
+	req, _ := http.NewRequest("GET", "/interface/wg0/export", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="wg0.zip"`, w.Header().Get("Content-Disposition"))
+}
+
+func TestCtrlExportInterface_Error(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		ExportInterface("wg9").
+		Return(nil, errors.New("interface wg9 not found"))
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("GET", "/interface/:ifname/export", ctrl.CtrlExportInterface)
+	req, _ := http.NewRequest("GET", "/interface/wg9/export", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestCtrlGetServerConfig_OK(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		GetServerConfig("wg0").
+		Return("[Interface]\nListenPort = 51820\n\n[Peer]\nPublicKey = pub1\n", nil)
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("GET", "/interface/:ifname/config", ctrl.CtrlGetServerConfig)
+	req, _ := http.NewRequest("GET", "/interface/wg0/config", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `attachment; filename="wg0.conf"`, w.Header().Get("Content-Disposition"))
+	assert.Contains(t, w.Body.String(), "[Peer]\nPublicKey = pub1")
+}
+
+func TestCtrlGetServerConfig_Error(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		GetServerConfig("wg9").
+		Return("", errors.New("interface wg9 not found"))
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("GET", "/interface/:ifname/config", ctrl.CtrlGetServerConfig)
+	req, _ := http.NewRequest("GET", "/interface/wg9/config", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestCtrlUpdateInterface_OK(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	dns := "10.0.0.1, 1.1.1.1"
+	mtu := 1380
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		UpdateInterface("wg0", usecases.InterfaceChanges{Dns: &dns, Mtu: &mtu}).
+		Return(usecases.InterfaceUpdate{
+			ServerInterfaces: usecases.ServerInterfaces{Ifname: "wg0", ConfigSettings: usecases.ConfigSettings{Dns: "10.0.0.1,1.1.1.1", Mtu: 1380}},
+			Clients:          []string{"pub1", "pub2"},
+		}, nil)
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("PATCH", "/interface/:ifname", ctrl.CtrlUpdateInterface)
+	body := `{"dns":"10.0.0.1, 1.1.1.1","mtu":1380}`
+	req, _ := http.NewRequest("PATCH", "/interface/wg0", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"clients":["pub1","pub2"]`)
+	assert.Contains(t, w.Body.String(), `"mtu":1380`)
+}
+
+func TestCtrlUpdateInterface_Pools(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	pools := []string{"10.0.0.100-10.0.0.200"}
+	excluded := []string{"10.0.0.150", "10.0.0.160/30"}
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		UpdateInterface("wg0", usecases.InterfaceChanges{Pools: &pools, Excluded: &excluded}).
+		Return(usecases.InterfaceUpdate{
+			ServerInterfaces: usecases.ServerInterfaces{Ifname: "wg0", AddressPools: usecases.AddressPools{Pools: pools, Excluded: excluded}},
+			Clients:          []string{},
+		}, nil)
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("PATCH", "/interface/:ifname", ctrl.CtrlUpdateInterface)
+	body := `{"pools":["10.0.0.100-10.0.0.200"],"excluded":["10.0.0.150","10.0.0.160/30"]}`
+	req, _ := http.NewRequest("PATCH", "/interface/wg0", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"pools":["10.0.0.100-10.0.0.200"]`)
+	assert.Contains(t, w.Body.String(), `"clients":[]`)
+}
+
+func TestCtrlUpdateInterface_EndpointPort(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	endpoint := "vpn.example.com"
+	port := 51821
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		UpdateInterface("wg0", usecases.InterfaceChanges{Endpoint: &endpoint, Port: &port}).
+		Return(usecases.InterfaceUpdate{
+			ServerInterfaces: usecases.ServerInterfaces{Ifname: "wg0", Endpoint: endpoint, Port: port},
+			Clients:          []string{"pub1"},
+		}, nil)
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("PATCH", "/interface/:ifname", ctrl.CtrlUpdateInterface)
+	req, _ := http.NewRequest("PATCH", "/interface/wg0", strings.NewReader(`{"endpoint":"vpn.example.com","port":51821}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"port":51821`)
+	assert.Contains(t, w.Body.String(), `"clients":["pub1"]`)
+}
+
+func TestCtrlUpdateInterface_Error(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mtu := 100
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		UpdateInterface("wg0", usecases.InterfaceChanges{Mtu: &mtu}).
+		Return(usecases.InterfaceUpdate{}, errors.New("MTU 100 is out of range 576-65535"))
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("PATCH", "/interface/:ifname", ctrl.CtrlUpdateInterface)
+	req, _ := http.NewRequest("PATCH", "/interface/wg0", strings.NewReader(`{"mtu":100}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestCtrlRotateInterfaceKey_OK(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		RotateInterfaceKey("wg0").
+		Return(usecases.InterfaceUpdate{
+			ServerInterfaces: usecases.ServerInterfaces{Ifname: "wg0", Public: "new-public"},
+			Clients:          []string{"pub1", "pub2"},
+		}, nil)
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("POST", "/interface/:ifname/rotate-key", ctrl.CtrlRotateInterfaceKey)
+	req, _ := http.NewRequest("POST", "/interface/wg0/rotate-key", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"public":"new-public"`)
+	assert.Contains(t, w.Body.String(), `"clients":["pub1","pub2"]`)
+}
+
+func TestCtrlRotateInterfaceKey_Error(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		RotateInterfaceKey("wg9").
+		Return(usecases.InterfaceUpdate{}, errors.New("record not found"))
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("POST", "/interface/:ifname/rotate-key", ctrl.CtrlRotateInterfaceKey)
+	req, _ := http.NewRequest("POST", "/interface/wg9/rotate-key", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 500, w.Code)
+	assert.Contains(t, w.Body.String(), "record not found")
+}
+
+func TestCtrlRotateInterfaceKey_Grace(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	// key is not rotated when grace period is asked
+	mockSvc := NewMockUsecaseService(gc)
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("POST", "/interface/:ifname/rotate-key", ctrl.CtrlRotateInterfaceKey)
+	req, _ := http.NewRequest("POST", "/interface/wg0/rotate-key?grace=24h", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 500, w.Code)
+	assert.Contains(t, w.Body.String(), "grace period is not supported")
+}
+
+func TestCtrlGetDrift_OK(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		GetDrift().
+		Return(usecases.DriftReport{Policy: "report", Drift: []usecases.Drift{
+			{Ifname: "wg0", Kind: usecases.DriftListenPort, Expected: "51820", Actual: "51821"},
+			{Ifname: "wg0", Public: "pub1", Kind: usecases.DriftMissingPeer},
+		}}, nil)
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("GET", "/drift", ctrl.CtrlGetDrift)
+	req, _ := http.NewRequest("GET", "/drift", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"kind":"listen_port","expected":"51820","actual":"51821"`)
+	assert.Contains(t, w.Body.String(), `"public":"pub1","kind":"missing_peer"`)
+}
+
+func TestCtrlGetDrift_Error(t *testing.T) {
+	gc := gomock.NewController(t)
+	defer gc.Finish()
+
+	mockSvc := NewMockUsecaseService(gc)
+	mockSvc.EXPECT().
+		GetDrift().
+		Return(usecases.DriftReport{}, errors.New("permission denied"))
+
+	ctrl := NewController(mockSvc, &config.ServerConfig{})
+
+	r, w := setupGin("GET", "/drift", ctrl.CtrlGetDrift)
+	req, _ := http.NewRequest("GET", "/drift", nil)
+
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 500, w.Code)
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"time"
 	"wireguard_api/config"
 	"wireguard_api/usecases"
 )
@@ -11,20 +12,80 @@ type Controller struct {
 }
 
 type addClient struct {
-	Ifname    string `json:"ifname" binding:"required"`
-	Ip        string `json:"ip"`
-	AllowedIp string `json:"alloweip"`
+	Ifname    string     `json:"ifname" binding:"required"`
+	Ip        string     `json:"ip"`
+	AllowedIp string     `json:"alloweip"`
+	Profile   string     `json:"profile"` // name of routing profile
+	Public    string     `json:"public"`  // public key of client, server does not keep private key when it is set
+	Psk       *bool      `json:"psk"`     // nil means use default of interface
+	ExpiresAt *time.Time `json:"expires_at"`
+	Ttl       string     `json:"ttl"` // duration like 72h, used when expires_at is empty
+	usecases.ClientMeta
+	// override settings of interface
+	usecases.ConfigSettings
+}
+
+type updateClient struct {
+	Ip        *string                  `json:"ip"`
+	AllowedIp *string                  `json:"alloweip"`
+	Profile   *string                  `json:"profile"`  // empty string removes profile
+	Settings  *usecases.ConfigSettings `json:"settings"` // replaces all settings of client
+	Meta      *usecases.ClientMeta     `json:"meta"`     // replaces all metadata of client
+}
+
+type addProfile struct {
+	Name        string   `json:"name" binding:"required"`
+	Routes      []string `json:"routes"`
+	Description string   `json:"description"`
+}
+
+type updateProfile struct {
+	Routes      *[]string `json:"routes"`
+	Description *string   `json:"description"`
 }
 
 type deleteClient struct {
 	Public string `json:"public" binding:"required"`
 }
 
+type switchClient struct {
+	Public string `json:"public" binding:"required"`
+}
+
+type clientQuota struct {
+	Public string `json:"public" binding:"required"`
+	Quota  int64  `json:"quota" binding:"min=0"` // bytes, 0 removes quota
+	Period string `json:"period" binding:"omitempty,oneof=monthly"`
+}
+
 type addServer struct {
 	Ifname   string `json:"ifname" binding:"required" `
 	Ip       string `json:"ip" binding:"required"`
 	Endpoint string `json:"endpoint" binding:"required"`
 	Port     int    `json:"port" binding:"required"`
+	Psk      bool   `json:"psk"` // generate preshared key for every new client by default
+	// written to configs of clients
+	usecases.ConfigSettings
+	// addresses of new clients
+	usecases.AddressPools
+}
+
+type updateServer struct {
+	Endpoint  *string   `json:"endpoint"`
+	Port      *int      `json:"port"`
+	Dns       *string   `json:"dns"`
+	Mtu       *int      `json:"mtu"`
+	Keepalive *int      `json:"keepalive"`
+	Pools     *[]string `json:"pools"`
+	Excluded  *[]string `json:"excluded"`
+}
+
+type importServer struct {
+	Ifname   string   `json:"ifname" binding:"required"`
+	Endpoint string   `json:"endpoint" binding:"required"`
+	Config   string   `json:"config" binding:"required"` // wg-quick config of server
+	Clients  []string `json:"clients"`                   // wg-quick configs of clients with their private keys
+	Adopt    bool     `json:"adopt"`                     // use running interface instead of creating it
 }
 
 type deleteServer struct {
@@ -62,3 +123,10 @@ type ServerMasquerade struct {
 	Ifname  string `json:"ifname" binding:"required"`
 	Comment string `json:"comment" binding:"required"`
 }
+
+type listQuery struct {
+	Limit  int    `form:"limit" binding:"min=0"`
+	Offset int    `form:"offset" binding:"min=0"`
+	Sort   string `form:"sort"`   // field name, "-" prefix for descending order
+	Fields string `form:"fields"` // comma separated json names of returned fields
+}
@@ -0,0 +1,223 @@
+package db
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// encryptedPrefix marks values encrypted by master key, values without it are plain text
+const encryptedPrefix = "enc:v1:"
+
+// masterCipher encrypts data keys, nil means new values are stored as plain text
+var masterCipher cipher.AEAD
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// SetMasterKey sets key of envelope encryption, nil key turns encryption off
+func SetMasterKey(key []byte) error {
+	if key == nil {
+		masterCipher = nil
+		return nil
+	}
+	aead, err := newCipher(key)
+	if err != nil {
+		return err
+	}
+	masterCipher = aead
+	return nil
+}
+
+func newCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plain []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func unseal(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+// encrypt seals value by new data key and data key by master key,
+// empty value and value without master key stay as they are
+func encrypt(value string) (string, error) {
+	if masterCipher == nil || value == "" || strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newCipher(dataKey)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(masterCipher, dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(wrapped) + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	if masterCipher == nil {
+		return "", errors.New("database has encrypted keys, master key is not set in config")
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", errors.New("bad format of encrypted value")
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := unseal(masterCipher, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("wrong master key: %w", err)
+	}
+	aead, err := newCipher(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := unseal(aead, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// EncryptedSerializer keeps string fields tagged with `serializer:encrypted` encrypted in database
+type EncryptedSerializer struct{}
+
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("unsupported type %T of encrypted field %s", dbValue, field.Name)
+	}
+	plain, err := decrypt(value)
+	if err != nil {
+		return err
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plain)
+	return nil
+}
+
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %T of encrypted field %s", fieldValue, field.Name)
+	}
+	return encrypt(value)
+}
+
+// encryptUpdates encrypts values of encrypted fields in updates by map,
+// gorm uses serializer only for values of struct fields
+func encryptUpdates(tx *gorm.DB) {
+	values, ok := tx.Statement.Dest.(map[string]interface{})
+	if !ok || tx.Statement.Schema == nil {
+		return
+	}
+	encrypted := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		encrypted[name] = value
+		field := tx.Statement.Schema.LookUpField(name)
+		text, ok := value.(string)
+		if field == nil || !ok {
+			continue
+		}
+		if _, ok := field.Serializer.(EncryptedSerializer); !ok {
+			continue
+		}
+		value, err := encrypt(text)
+		if err != nil {
+			tx.AddError(err)
+			return
+		}
+		encrypted[name] = value
+	}
+	tx.Statement.Dest = encrypted
+}
+
+// encryptedColumns are columns with `serializer:encrypted` tag
+var encryptedColumns = map[string][]string{
+	"server_certs":         {"private", "config"},
+	"client_certs":         {"private", "config", "preshared_key"},
+	"archive_server_certs": {"private", "config"},
+	"archive_client_certs": {"private", "config", "preshared_key"},
+}
+
+// encryptExisting encrypts values which were written as plain text before master key was set
+func encryptExisting(db *gorm.DB) error {
+	if masterCipher == nil {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for table, columns := range encryptedColumns {
+			for _, column := range columns {
+				var rows []struct {
+					ID    uint
+					Value string
+				}
+				err := tx.Table(table).
+					Select("id, "+column+" AS value").
+					Where(column+" <> '' AND "+column+" NOT LIKE ?", encryptedPrefix+"%").
+					Scan(&rows).Error
+				if err != nil {
+					return err
+				}
+				for _, row := range rows {
+					value, err := encrypt(row.Value)
+					if err != nil {
+						return err
+					}
+					err = tx.Table(table).Where("id = ?", row.ID).UpdateColumn(column, value).Error
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -11,20 +11,49 @@ import (
 
 func Init(cfg *config.ServerConfig) DatabaseStruct {
 	dbPath := cfg.Database
-	file, err := os.OpenFile(dbPath, os.O_RDWR|os.O_CREATE, 0755)
+	file, err := os.OpenFile(dbPath, os.O_RDWR|os.O_CREATE, 0600)
 	if err != nil {
 		log.Fatalf("cannot create database: %v", err)
 	}
 	file.Close()
+	// database created by older versions is readable by everyone
+	err = os.Chmod(dbPath, 0600)
+	if err != nil {
+		log.Fatalf("cannot change mode of database: %v", err)
+	}
+
+	key, err := cfg.MasterKey()
+	if err != nil {
+		log.Fatalf("cannot load master key: %v", err)
+	}
+	if key == nil {
+		log.Printf("master key is not set in config, private keys are stored in database as plain text")
+	}
+	err = SetMasterKey(key)
+	if err != nil {
+		log.Fatalf("cannot load master key: %v", err)
+	}
 
 	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
 	if err != nil {
 		log.Fatalf("cannot connect to database: %v", err)
 	}
-	err = db.AutoMigrate(&ServerCert{}, &ClientCert{}, &ArchiveClientCert{}, &ArchiveServerCert{}, Forward{}, Masquerade{})
+	err = db.Callback().Update().Before("gorm:update").Register("encrypt_updates", encryptUpdates)
+	if err != nil {
+		log.Fatalf("cannot register database callback: %v", err)
+	}
+	err = db.AutoMigrate(&ServerCert{}, &ClientCert{}, &ArchiveClientCert{}, &ArchiveServerCert{}, Forward{}, Masquerade{}, &RoutingProfile{})
+	if err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+	err = fillIpSort(db)
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
+	err = encryptExisting(db)
+	if err != nil {
+		log.Fatalf("Failed to encrypt database: %v", err)
+	}
 
 	return DatabaseStruct{DbInstance: db}
 }
@@ -36,3 +65,30 @@ func (d *DatabaseStruct) Close() error {
 	}
 	return sqlDB.Close()
 }
+
+// fillIpSort sets sort key of clients created before the key was added
+func fillIpSort(db *gorm.DB) error {
+	var clients []ClientCert
+	err := db.Where("ip_sort = '' OR ip_sort IS NULL").Find(&clients).Error
+	if err != nil {
+		return err
+	}
+	for _, v := range clients {
+		err = db.Model(&ClientCert{}).Where("id = ?", v.ID).UpdateColumn("ip_sort", IpSortKey(v.IP)).Error
+		if err != nil {
+			return err
+		}
+	}
+	var archive []ArchiveClientCert
+	err = db.Unscoped().Where("ip_sort = '' OR ip_sort IS NULL").Find(&archive).Error
+	if err != nil {
+		return err
+	}
+	for _, v := range archive {
+		err = db.Unscoped().Model(&ArchiveClientCert{}).Where("id = ?", v.ID).UpdateColumn("ip_sort", IpSortKey(v.IP)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
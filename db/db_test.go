@@ -3,6 +3,7 @@ package db
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"wireguard_api/config"
 
@@ -29,3 +30,56 @@ func TestInitAndClose_OK(t *testing.T) {
 	err = sqlDB.Ping()
 	assert.Error(t, err)
 }
+
+func TestIpSortKey(t *testing.T) {
+	assert.Equal(t, "40a000002", IpSortKey("10.0.0.2/24"))
+	assert.Equal(t, "40a000002", IpSortKey("10.0.0.2/24,fd00::2/64"))
+	assert.Less(t, IpSortKey("10.0.0.9/24"), IpSortKey("10.0.0.10/24"))
+	assert.Less(t, IpSortKey("10.0.0.10/24"), IpSortKey("fd00::2/64"))
+	assert.Equal(t, "", IpSortKey("bad"))
+}
+
+func TestEncryptedColumns(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	// rows written before master key was set are encrypted on next start
+	dbStruct := Init(&config.ServerConfig{Database: dbPath})
+	require.NoError(t, dbStruct.DbInstance.Create(&ClientCert{Ifname: "wg0", Private: "old-private", Public: "old-public", IP: "10.0.0.2/24", Config: "old-config"}).Error)
+	require.NoError(t, dbStruct.Close())
+
+	info, err := os.Stat(dbPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	keyFile := filepath.Join(tmpDir, "master.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="), 0600))
+	dbStruct = Init(&config.ServerConfig{Database: dbPath, MasterKeyFile: keyFile})
+	defer SetMasterKey(nil)
+	defer dbStruct.Close()
+	gdb := dbStruct.DbInstance
+
+	require.NoError(t, gdb.Create(&ClientCert{Ifname: "wg0", Private: "new-private", Public: "new-public", IP: "10.0.0.3/24", Config: "new-config", PresharedKey: "psk"}).Error)
+	require.NoError(t, gdb.Model(&ClientCert{}).Where("public = ?", "new-public").Updates(map[string]interface{}{"config": "updated-config"}).Error)
+
+	var raw []struct {
+		Private      string
+		Config       string
+		PresharedKey string
+	}
+	require.NoError(t, gdb.Raw("SELECT private, config, preshared_key FROM client_certs ORDER BY id").Scan(&raw).Error)
+	require.Len(t, raw, 2)
+	for _, v := range raw {
+		assert.True(t, strings.HasPrefix(v.Private, encryptedPrefix))
+		assert.True(t, strings.HasPrefix(v.Config, encryptedPrefix))
+	}
+	assert.True(t, strings.HasPrefix(raw[1].PresharedKey, encryptedPrefix))
+
+	var certs []ClientCert
+	require.NoError(t, gdb.Order("id").Find(&certs).Error)
+	assert.Equal(t, "old-private", certs[0].Private)
+	assert.Equal(t, "old-config", certs[0].Config)
+	assert.Equal(t, "new-private", certs[1].Private)
+	assert.Equal(t, "updated-config", certs[1].Config)
+	assert.Equal(t, "psk", certs[1].PresharedKey)
+}
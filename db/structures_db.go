@@ -1,51 +1,182 @@
 package db
 
-import "gorm.io/gorm"
+import (
+	"encoding/hex"
+	"net"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// reasons why client certificate was moved to archive
+const (
+	ReasonDeleted          = "deleted"
+	ReasonExpired          = "expired"
+	ReasonInterfaceDeleted = "interface deleted"
+	ReasonRotated          = "rotated"
+)
+
+// QuotaMonthly resets client traffic usage at the start of every month
+const QuotaMonthly = "monthly"
+
+// Page selects part of a list, Sort and Columns are column names,
+// zero Limit returns all rows and empty Columns selects every column
+type Page struct {
+	Limit   int
+	Offset  int
+	Sort    string
+	Desc    bool
+	Columns []string
+}
 
 type DatabaseStruct struct {
 	DbInstance *gorm.DB
 }
 
+// private keys, preshared keys and configs with private keys are encrypted
+// by master key when it is set in config, see EncryptedSerializer
 type ServerCert struct {
 	gorm.Model
-	Private  string `gorm:"not null"`
+	Private  string `gorm:"not null;serializer:encrypted"`
 	Public   string `gorm:"not null"`
 	Endpoint string `gorm:"not null"`
 	Ip       string `gorm:"unique;not null"`
-	Config   string `gorm:"not null"`
+	Config   string `gorm:"not null;serializer:encrypted"`
 	Ifname   string `gorm:"unique;not null"`
 	Port     int    `gorm:"unique;not null"`
+	// generate preshared key for new clients when request did not set it
+	DefaultPsk bool
+	// written to client configs: comma separated DNS servers, MTU (0 is not written)
+	// and PersistentKeepalive in seconds (0 is not written)
+	Dns       string
+	Mtu       int
+	Keepalive *int `gorm:"default:20"`
+	// comma separated ranges (a-b), addresses or subnets used for new clients,
+	// empty means the whole subnet of Ip, addresses of Excluded are never allocated
+	Pools    string
+	Excluded string
 }
 
 type ClientCert struct {
 	gorm.Model
-	Ifname     string `gorm:"not null"`
-	Private    string `gorm:"not null"`
-	Public     string `gorm:"not null"`
-	IP         string `gorm:"unique;not null"`
-	AllowedIPs string
-	Config     string `gorm:"not null"`
+	Ifname       string `gorm:"not null"`
+	Private      string `gorm:"not null;serializer:encrypted"`
+	Public       string `gorm:"not null"`
+	IP           string `gorm:"unique;not null"`
+	AllowedIPs   string
+	Config       string     `gorm:"not null;serializer:encrypted"`
+	PresharedKey string     `gorm:"serializer:encrypted"`
+	Disabled     bool       // peer removed from device, keys and config are kept
+	ExpiresAt    *time.Time `gorm:"index"` // nil means client never expires
+	// traffic accounting, LastRx/LastTx keep last counters of device to count delta
+	Quota            int64 // bytes, 0 means unlimited
+	QuotaPeriod      string
+	QuotaExceeded    bool
+	UsageRx          int64
+	UsageTx          int64
+	UsagePeriodStart *time.Time
+	LastRx           int64
+	LastTx           int64
+	// human readable information about client, tags are comma separated
+	Name        string
+	Owner       string `gorm:"index"`
+	Email       string
+	Description string
+	Tags        string
+	// IpSort orders clients by address, filled from IP on save
+	IpSort        string `gorm:"index"`
+	LastHandshake *time.Time
+	// name of RoutingProfile, its routes are added to AllowedIPs of client config
+	Profile string `gorm:"index"`
+	// override settings of interface in client config, empty values use settings of interface
+	Dns       string
+	Mtu       int
+	Keepalive *int
+}
+
+// BeforeSave keeps IpSort in line with IP
+func (c *ClientCert) BeforeSave(tx *gorm.DB) error {
+	if c.IP != "" {
+		c.IpSort = IpSortKey(c.IP)
+	}
+	return nil
 }
 
 type ArchiveClientCert struct {
 	gorm.Model
-	Ifname     string
-	Private    string
-	Public     string
-	IP         string
-	AllowedIPs string
-	Config     string
+	Ifname       string
+	Private      string `gorm:"serializer:encrypted"`
+	Public       string
+	IP           string
+	AllowedIPs   string
+	Config       string `gorm:"serializer:encrypted"`
+	PresharedKey string `gorm:"serializer:encrypted"`
+	ExpiresAt    *time.Time
+	Reason       string
+	Name         string
+	Owner        string
+	Email        string
+	Description  string
+	Tags         string
+	IpSort       string `gorm:"index"`
+	Profile      string
+	Dns          string
+	Mtu          int
+	Keepalive    *int
+	// ArchiveServerId is id of archived interface when client was archived together with it
+	ArchiveServerId *uint `gorm:"index"`
+}
+
+// BeforeSave keeps IpSort in line with IP
+func (c *ArchiveClientCert) BeforeSave(tx *gorm.DB) error {
+	if c.IP != "" {
+		c.IpSort = IpSortKey(c.IP)
+	}
+	return nil
+}
+
+// RoutingProfile is named list of routes for client configs, like full tunnel or
+// office subnets, clients refer to profile by name
+type RoutingProfile struct {
+	gorm.Model
+	Name        string `gorm:"unique;not null"`
+	Routes      string // comma separated subnets
+	Description string
+}
+
+// IpSortKey returns key of the first address in comma separated list which is sorted
+// as text in the same order as addresses, IPv4 goes before IPv6
+func IpSortKey(ip string) string {
+	first := strings.TrimSpace(strings.Split(ip, ",")[0])
+	addr, _, err := net.ParseCIDR(first)
+	if err != nil {
+		addr = net.ParseIP(first)
+	}
+	if addr == nil {
+		return ""
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return "4" + hex.EncodeToString(v4)
+	}
+	return "6" + hex.EncodeToString(addr.To16())
 }
 
 type ArchiveServerCert struct {
 	gorm.Model
-	Private  string
-	Public   string
-	Endpoint string
-	Ip       string
-	Config   string
-	Ifname   string
-	Port     int
+	Private    string `gorm:"serializer:encrypted"`
+	Public     string
+	Endpoint   string
+	Ip         string
+	Config     string `gorm:"serializer:encrypted"`
+	Ifname     string
+	Port       int
+	DefaultPsk bool
+	Dns        string
+	Mtu        int
+	Keepalive  *int
+	Pools      string
+	Excluded   string
 }
 
 type Forward struct {
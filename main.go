@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 	"wireguard_api/config"
 	"wireguard_api/db"
 	"wireguard_api/iptablerules"
@@ -14,6 +15,7 @@ import (
 	"wireguard_api/repository"
 	"wireguard_api/usecases"
 	"wireguard_api/webserver"
+	"wireguard_api/wg"
 )
 
 func main() {
@@ -31,17 +33,27 @@ func main() {
 	}
 
 	uc := &usecases.Usecases{
-		ServerRepo: repository.NewServerCertRepository(db.DbInstance),
-		ClientRepo: repository.NewClientCertRepository(db.DbInstance),
-		IpTables:   iptablerules.Init(ipt),
-		PingStatus: pingstatus.Init(pingstatus.NewICMPFactory()),
+		ServerRepo:        repository.NewServerCertRepository(db.DbInstance),
+		ClientRepo:        repository.NewClientCertRepository(db.DbInstance),
+		IpTables:          iptablerules.Init(ipt),
+		PingStatus:        pingstatus.Init(pingstatus.NewICMPFactory()),
+		Links:             wg.NewLinkManager(),
+		ArchiveRetention:  time.Duration(cfg.ArchiveRetentionDays) * 24 * time.Hour,
+		ReconcileInterval: time.Duration(cfg.ReconcileInterval) * time.Second,
+		ReconcilePolicy:   cfg.ReconcilePolicy,
+		WgQuickDir:        cfg.WgQuickDir,
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGTSTP)
 	go uc.PingLoop(ctx)
+	go uc.ExpireLoop(ctx)
+	go uc.UsageLoop(ctx)
+	go uc.PurgeLoop(ctx)
 	uc.FirstStartIptables()
 	uc.StartInterfaces()
+	// first check runs on started interfaces, otherwise every interface is reported missing
+	go uc.ReconcileLoop(ctx)
 	server := webserver.NewServer(uc)
 	go server.StartWebServer(ctx, cfg)
 	sig := <-sigs
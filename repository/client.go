@@ -2,9 +2,12 @@ package repository
 
 import (
 	"errors"
+	"strings"
+	"time"
 	"wireguard_api/db"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ClientCertRepository struct {
@@ -19,7 +22,22 @@ func (r *ClientCertRepository) CreateClientCert(cert *db.ClientCert) error {
 	return r.db.Create(cert).Error
 }
 
-func (r *ClientCertRepository) DeleteClientCert(public string) (db.ClientCert, error) {
+// CreateClientCerts saves all clients in one transaction, apply is called before commit
+// and its error rolls back the whole batch.
+func (r *ClientCertRepository) CreateClientCerts(certs []db.ClientCert, apply func() error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&certs).Error
+		if err != nil {
+			return err
+		}
+		if apply != nil {
+			return apply()
+		}
+		return nil
+	})
+}
+
+func (r *ClientCertRepository) DeleteClientCert(public, reason string) (db.ClientCert, error) {
 	var cert db.ClientCert
 	var arch db.ArchiveClientCert
 	err := r.db.Transaction(func(tx *gorm.DB) error {
@@ -29,14 +47,7 @@ func (r *ClientCertRepository) DeleteClientCert(public string) (db.ClientCert, e
 		} else if err != nil {
 			return err
 		}
-		arch = db.ArchiveClientCert{
-			Public:     cert.Public,
-			Private:    cert.Private,
-			Ifname:     cert.Ifname,
-			IP:         cert.IP,
-			AllowedIPs: cert.AllowedIPs,
-			Config:     cert.Config,
-		}
+		arch = archiveClient(cert, reason)
 		err = tx.Create(&arch).Error
 		if err != nil {
 			return err
@@ -53,6 +64,65 @@ func (r *ClientCertRepository) DeleteClientCert(public string) (db.ClientCert, e
 	return cert, nil
 }
 
+// RotateClientCert moves old keys of client to archive and saves new keys, IP and settings of client stay the same.
+// apply is called before commit and its error rolls back the rotation.
+func (r *ClientCertRepository) RotateClientCert(public, newPublic, newPrivate, newPresharedKey, config string, apply func() error) (db.ClientCert, error) {
+	var cert db.ClientCert
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("public = ?", public).First(&cert).Error
+		if err != nil {
+			return err
+		}
+		arch := archiveClient(cert, db.ReasonRotated)
+		err = tx.Create(&arch).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&db.ClientCert{}).Where("id = ?", cert.ID).Updates(map[string]interface{}{
+			"public":        newPublic,
+			"private":       newPrivate,
+			"preshared_key": newPresharedKey,
+			"config":        config,
+			"last_rx":       0,
+			"last_tx":       0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if apply != nil {
+			return apply()
+		}
+		return nil
+	})
+	if err != nil {
+		return db.ClientCert{}, err
+	}
+	return cert, nil
+}
+
+func archiveClient(cert db.ClientCert, reason string) db.ArchiveClientCert {
+	return db.ArchiveClientCert{
+		Public:       cert.Public,
+		Private:      cert.Private,
+		Ifname:       cert.Ifname,
+		IP:           cert.IP,
+		AllowedIPs:   cert.AllowedIPs,
+		Config:       cert.Config,
+		PresharedKey: cert.PresharedKey,
+		ExpiresAt:    cert.ExpiresAt,
+		Reason:       reason,
+		Name:         cert.Name,
+		Owner:        cert.Owner,
+		Email:        cert.Email,
+		Description:  cert.Description,
+		Tags:         cert.Tags,
+		Profile:      cert.Profile,
+		Dns:          cert.Dns,
+		Mtu:          cert.Mtu,
+		Keepalive:    cert.Keepalive,
+	}
+}
+
 func (r *ClientCertRepository) GetClientCertsByIfname(ifname string) ([]db.ClientCert, error) {
 	var certs []db.ClientCert
 	err := r.db.Where("ifname = ?", ifname).Find(&certs).Error
@@ -87,11 +157,277 @@ func (r *ClientCertRepository) GetAllClient() ([]db.ClientCert, error) {
 	return certs, nil
 }
 
-func (r *ClientCertRepository) GetClientArchive() ([]db.ArchiveClientCert, error) {
+// FindClients returns page of clients of owner with tag and total number of them,
+// empty owner or tag is not used in filter.
+func (r *ClientCertRepository) FindClients(owner, tag string, page db.Page) ([]db.ClientCert, int64, error) {
+	var certs []db.ClientCert
+	var total int64
+	query := r.db.Model(&db.ClientCert{})
+	if owner != "" {
+		query = query.Where("owner = ?", owner)
+	}
+	if tag != "" {
+		query = query.Where(`(',' || tags || ',') LIKE ? ESCAPE '\'`, "%,"+likeEscaper.Replace(tag)+",%")
+	}
+	err := query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = paginate(query, page).Find(&certs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return certs, total, nil
+}
+
+// likeEscaper escapes wildcards of LIKE, so they are matched as they are
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// paginate applies columns, order and limits of page to query, id keeps order of equal rows stable
+func paginate(query *gorm.DB, page db.Page) *gorm.DB {
+	if len(page.Columns) > 0 {
+		query = query.Select(page.Columns)
+	}
+	if page.Sort != "" {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: page.Sort}, Desc: page.Desc})
+	}
+	query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: page.Desc})
+	if page.Limit > 0 {
+		query = query.Limit(page.Limit)
+	}
+	if page.Offset > 0 {
+		query = query.Offset(page.Offset)
+	}
+	return query
+}
+
+func (r *ClientCertRepository) UpdateClientMeta(public, name, owner, email, description, tags string) error {
+	result := r.db.Model(&db.ClientCert{}).
+		Where("public = ?", public).
+		Updates(map[string]interface{}{"name": name, "owner": owner, "email": email, "description": description, "tags": tags})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *ClientCertRepository) SetClientDisabled(public string, disabled bool) (db.ClientCert, error) {
+	var cert db.ClientCert
+	err := r.db.Where("public = ?", public).First(&cert).Error
+	if err != nil {
+		return db.ClientCert{}, err
+	}
+	// peer is removed or added again so device counters start from zero
+	err = r.db.Model(&cert).Updates(map[string]interface{}{"disabled": disabled, "last_rx": 0, "last_tx": 0}).Error
+	if err != nil {
+		return db.ClientCert{}, err
+	}
+	return cert, nil
+}
+
+func (r *ClientCertRepository) SetClientQuota(public string, quota int64, period string) (db.ClientCert, error) {
+	var cert db.ClientCert
+	err := r.db.Where("public = ?", public).First(&cert).Error
+	if err != nil {
+		return db.ClientCert{}, err
+	}
+	err = r.db.Model(&cert).Updates(map[string]interface{}{"quota": quota, "quota_period": period}).Error
+	if err != nil {
+		return db.ClientCert{}, err
+	}
+	return cert, nil
+}
+
+// UpdateClientUsage saves traffic counters of cert, disabled and quota_exceeded are not written
+// so enable or disable of client by another request is not reverted.
+func (r *ClientCertRepository) UpdateClientUsage(cert *db.ClientCert) error {
+	return r.db.Model(cert).
+		Select("usage_rx", "usage_tx", "usage_period_start", "last_rx", "last_tx", "last_handshake").
+		Updates(cert).Error
+}
+
+// SetClientQuotaExceeded disables enabled client which exceeded quota or enables client disabled
+// by quota, returns false when client state was already changed by another request.
+func (r *ClientCertRepository) SetClientQuotaExceeded(id uint, exceeded bool) (bool, error) {
+	query := r.db.Model(&db.ClientCert{}).Where("id = ?", id)
+	if exceeded {
+		query = query.Where("disabled = ?", false)
+	} else {
+		query = query.Where("quota_exceeded = ?", true)
+	}
+	// peer is removed or added again so device counters start from zero
+	result := query.Updates(map[string]interface{}{"disabled": exceeded, "quota_exceeded": exceeded, "last_rx": 0, "last_tx": 0})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *ClientCertRepository) ResetClientCounters(ifname string) error {
+	return r.db.Model(&db.ClientCert{}).
+		Where("ifname = ?", ifname).
+		Updates(map[string]interface{}{"last_rx": 0, "last_tx": 0}).Error
+}
+
+func (r *ClientCertRepository) GetExpiredClients(now time.Time) ([]db.ClientCert, error) {
+	var certs []db.ClientCert
+	err := r.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Find(&certs).Error
+	if err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// UpdateClientCert saves addresses, routes, config settings and config of cert to client with public key,
+// name, owner, email, description and tags of cert are saved when withMeta is set. apply is called
+// before commit and its error rolls back the update.
+func (r *ClientCertRepository) UpdateClientCert(public string, cert db.ClientCert, withMeta bool, apply func() error) error {
+	values := map[string]interface{}{
+		"ip":          cert.IP,
+		"ip_sort":     db.IpSortKey(cert.IP),
+		"allowed_ips": cert.AllowedIPs,
+		"profile":     cert.Profile,
+		"dns":         cert.Dns,
+		"mtu":         cert.Mtu,
+		"keepalive":   cert.Keepalive,
+		"config":      cert.Config,
+	}
+	if withMeta {
+		values["name"] = cert.Name
+		values["owner"] = cert.Owner
+		values["email"] = cert.Email
+		values["description"] = cert.Description
+		values["tags"] = cert.Tags
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&db.ClientCert{}).Where("public = ?", public).Updates(values)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if apply != nil {
+			return apply()
+		}
+		return nil
+	})
+}
+
+func (r *ClientCertRepository) GetClientByPublic(public string) (db.ClientCert, error) {
+	var cert db.ClientCert
+	err := r.db.Where("public = ?", public).First(&cert).Error
+	return cert, err
+}
+
+func (r *ClientCertRepository) GetArchiveClientByPublic(public string) (db.ArchiveClientCert, error) {
+	var cert db.ArchiveClientCert
+	err := r.db.Unscoped().Where("public = ?", public).Order("id DESC").First(&cert).Error
+	return cert, err
+}
+
+func (r *ClientCertRepository) GetClientArchive(page db.Page) ([]db.ArchiveClientCert, int64, error) {
 	var archive []db.ArchiveClientCert
-	err := r.db.Unscoped().Find(&archive).Error
+	var total int64
+	query := r.db.Unscoped().Model(&db.ArchiveClientCert{})
+	err := query.Count(&total).Error
+	if err != nil {
+		return []db.ArchiveClientCert{}, 0, err
+	}
+	err = paginate(query, page).Find(&archive).Error
+	if err != nil {
+		return []db.ArchiveClientCert{}, 0, err
+	}
+	return archive, total, nil
+}
+
+func (r *ClientCertRepository) GetArchiveClientById(id uint) (db.ArchiveClientCert, error) {
+	var cert db.ArchiveClientCert
+	err := r.db.Unscoped().Where("id = ?", id).First(&cert).Error
+	return cert, err
+}
+
+// GetArchiveClientsOfServer returns clients which were moved to archive together with archived interface
+func (r *ClientCertRepository) GetArchiveClientsOfServer(serverArchiveId uint) ([]db.ArchiveClientCert, error) {
+	var certs []db.ArchiveClientCert
+	err := archivedWithServer(r.db.Unscoped(), serverArchiveId).Order("id").Find(&certs).Error
 	if err != nil {
-		return []db.ArchiveClientCert{}, err
+		return nil, err
 	}
-	return archive, nil
+	return certs, nil
+}
+
+// archivedWithServer selects clients archived together with archived interface,
+// records archived before archive_server_id was added are matched by time of archiving
+func archivedWithServer(query *gorm.DB, serverArchiveId uint) *gorm.DB {
+	return query.
+		Where("reason = ?", db.ReasonInterfaceDeleted).
+		Where("ifname = (SELECT ifname FROM archive_server_certs WHERE id = ?)", serverArchiveId).
+		Where("archive_server_id = ? OR (archive_server_id IS NULL AND deleted_at = (SELECT deleted_at FROM archive_server_certs WHERE id = ?))", serverArchiveId, serverArchiveId)
+}
+
+// RestoreClientCert creates client from archive record and removes the record from archive.
+// apply is called before commit and its error rolls back the restore.
+func (r *ClientCertRepository) RestoreClientCert(archiveId uint, cert *db.ClientCert, apply func() error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(cert).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("id = ?", archiveId).Delete(&db.ArchiveClientCert{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if apply != nil {
+			return apply()
+		}
+		return nil
+	})
+}
+
+// archivedBefore selects archive records moved to archive before the time, records created by
+// DeleteServer keep created time of client and have deleted_at set to time of archiving
+func archivedBefore(query *gorm.DB, before time.Time) *gorm.DB {
+	return query.Where("datetime(COALESCE(deleted_at, created_at)) < datetime(?)", before.UTC().Format("2006-01-02 15:04:05"))
+}
+
+// PurgeClientArchive removes archive records older than before and returns removed records.
+func (r *ClientCertRepository) PurgeClientArchive(before time.Time) ([]db.ArchiveClientCert, error) {
+	var certs []db.ArchiveClientCert
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := archivedBefore(tx.Unscoped(), before).Find(&certs).Error
+		if err != nil || len(certs) == 0 {
+			return err
+		}
+		ids := make([]uint, 0, len(certs))
+		for _, v := range certs {
+			ids = append(ids, v.ID)
+		}
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&db.ArchiveClientCert{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+func (r *ClientCertRepository) DeleteArchiveClient(id uint) (db.ArchiveClientCert, error) {
+	var cert db.ArchiveClientCert
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("id = ?", id).First(&cert).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&cert).Error
+	})
+	if err != nil {
+		return db.ArchiveClientCert{}, err
+	}
+	return cert, nil
 }
@@ -1,7 +1,9 @@
 package repository
 
 import (
+	"errors"
 	"testing"
+	"time"
 	dbtest "wireguard_api/db"
 
 	"github.com/stretchr/testify/assert"
@@ -19,7 +21,7 @@ func setupTestDB() *gorm.DB {
 		panic("Failed to connect to database: " + err.Error())
 	}
 
-	err = db.AutoMigrate(&dbtest.ClientCert{}, &dbtest.ServerCert{}, &dbtest.ArchiveClientCert{}, &dbtest.ArchiveServerCert{})
+	err = db.AutoMigrate(&dbtest.ClientCert{}, &dbtest.ServerCert{}, &dbtest.ArchiveClientCert{}, &dbtest.ArchiveServerCert{}, &dbtest.RoutingProfile{})
 	if err != nil {
 		panic("Failed to migrate database: " + err.Error())
 	}
@@ -65,18 +67,19 @@ func TestDeleteClientCert(t *testing.T) {
 	repo := NewClientCertRepository(db)
 
 	clientCert := &dbtest.ClientCert{
-		Public:     "public_key",
-		Private:    "private_key",
-		Ifname:     "ifname",
-		IP:         "192.168.1.12",
-		AllowedIPs: "192.168.1.0/24",
-		Config:     "test-config",
+		Public:       "public_key",
+		Private:      "private_key",
+		Ifname:       "ifname",
+		IP:           "192.168.1.12",
+		AllowedIPs:   "192.168.1.0/24",
+		Config:       "test-config",
+		PresharedKey: "preshared_key",
 	}
 
 	err := repo.CreateClientCert(clientCert)
 	assert.NoError(t, err)
 
-	client, err := repo.DeleteClientCert("public_key")
+	client, err := repo.DeleteClientCert("public_key", dbtest.ReasonDeleted)
 	assert.Equal(t, client.Ifname, "ifname")
 	assert.NoError(t, err)
 
@@ -84,7 +87,7 @@ func TestDeleteClientCert(t *testing.T) {
 	err = db.First(&cert, "public = ?", "public_key").Error
 	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
 
-	data, err := repo.GetClientArchive()
+	data, _, err := repo.GetClientArchive(dbtest.Page{})
 	assert.NoError(t, err)
 	assert.Len(t, data, 1)
 
@@ -95,6 +98,8 @@ func TestDeleteClientCert(t *testing.T) {
 	assert.Equal(t, "192.168.1.12", archivedCert.IP)
 	assert.Equal(t, "192.168.1.0/24", archivedCert.AllowedIPs)
 	assert.Equal(t, "test-config", archivedCert.Config)
+	assert.Equal(t, "preshared_key", archivedCert.PresharedKey)
+	assert.Equal(t, dbtest.ReasonDeleted, archivedCert.Reason)
 }
 func TestGetClientCertsByIfname(t *testing.T) {
 	db := setupTestDB()
@@ -166,8 +171,414 @@ func TestGetClientArchive(t *testing.T) {
 	}
 	db.Create(archivedCert)
 
-	archive, err := repo.GetClientArchive()
+	archive, _, err := repo.GetClientArchive(dbtest.Page{})
 	assert.NoError(t, err)
 	assert.Len(t, archive, 1)
 	assert.Equal(t, "test-archived-public", archive[0].Public)
 }
+func TestSetClientDisabled(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	clientCert := &dbtest.ClientCert{Public: "test-public", Ifname: "test-ifname", IP: "192.168.1.1"}
+	db.Create(clientCert)
+
+	cert, err := repo.SetClientDisabled("test-public", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-ifname", cert.Ifname)
+
+	var stored dbtest.ClientCert
+	err = db.First(&stored, "public = ?", "test-public").Error
+	assert.NoError(t, err)
+	assert.True(t, stored.Disabled)
+
+	_, err = repo.SetClientDisabled("test-public", false)
+	assert.NoError(t, err)
+	err = db.First(&stored, "public = ?", "test-public").Error
+	assert.NoError(t, err)
+	assert.False(t, stored.Disabled)
+
+	_, err = repo.SetClientDisabled("unknown", true)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+func TestGetExpiredClients(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	db.Create(&dbtest.ClientCert{Public: "test-public-1", Ifname: "test-ifname", IP: "192.168.1.1", ExpiresAt: &past})
+	db.Create(&dbtest.ClientCert{Public: "test-public-2", Ifname: "test-ifname", IP: "192.168.1.2", ExpiresAt: &future})
+	db.Create(&dbtest.ClientCert{Public: "test-public-3", Ifname: "test-ifname", IP: "192.168.1.3"})
+
+	certs, err := repo.GetExpiredClients(time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, certs, 1)
+	assert.Equal(t, "test-public-1", certs[0].Public)
+
+	_, err = repo.DeleteClientCert("test-public-1", dbtest.ReasonExpired)
+	assert.NoError(t, err)
+	archive, _, err := repo.GetClientArchive(dbtest.Page{})
+	assert.NoError(t, err)
+	assert.Len(t, archive, 1)
+	assert.Equal(t, dbtest.ReasonExpired, archive[0].Reason)
+	assert.NotNil(t, archive[0].ExpiresAt)
+}
+func TestClientUsage(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	db.Create(&dbtest.ClientCert{Public: "test-public-1", Ifname: "test-ifname", IP: "192.168.1.1"})
+	db.Create(&dbtest.ClientCert{Public: "test-public-2", Ifname: "other-ifname", IP: "192.168.2.1", LastRx: 5, LastTx: 5})
+
+	cert, err := repo.SetClientQuota("test-public-1", 1000, dbtest.QuotaMonthly)
+	assert.NoError(t, err)
+
+	start := time.Now()
+	cert.UsageRx = 100
+	cert.UsageTx = 200
+	cert.LastRx = 10
+	cert.LastTx = 20
+	cert.UsagePeriodStart = &start
+	cert.QuotaExceeded = true
+	cert.Disabled = true
+	err = repo.UpdateClientUsage(&cert)
+	assert.NoError(t, err)
+
+	var stored dbtest.ClientCert
+	err = db.First(&stored, "public = ?", "test-public-1").Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), stored.Quota)
+	assert.Equal(t, dbtest.QuotaMonthly, stored.QuotaPeriod)
+	assert.Equal(t, int64(100), stored.UsageRx)
+	assert.Equal(t, int64(200), stored.UsageTx)
+	assert.False(t, stored.QuotaExceeded)
+	assert.False(t, stored.Disabled)
+	assert.NotNil(t, stored.UsagePeriodStart)
+
+	changed, err := repo.SetClientQuotaExceeded(cert.ID, true)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	err = db.First(&stored, "public = ?", "test-public-1").Error
+	assert.NoError(t, err)
+	assert.True(t, stored.QuotaExceeded)
+	assert.True(t, stored.Disabled)
+	assert.Equal(t, int64(0), stored.LastRx)
+
+	// client which is already disabled, e.g. by DisableClient, is not changed
+	changed, err = repo.SetClientQuotaExceeded(cert.ID, true)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	changed, err = repo.SetClientQuotaExceeded(cert.ID, false)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = repo.SetClientQuotaExceeded(cert.ID, false)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	err = db.First(&stored, "public = ?", "test-public-1").Error
+	assert.NoError(t, err)
+	assert.False(t, stored.QuotaExceeded)
+	assert.False(t, stored.Disabled)
+
+	err = repo.ResetClientCounters("test-ifname")
+	assert.NoError(t, err)
+	err = db.First(&stored, "public = ?", "test-public-1").Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), stored.LastRx)
+	assert.Equal(t, int64(0), stored.LastTx)
+	assert.Equal(t, int64(100), stored.UsageRx)
+
+	var other dbtest.ClientCert
+	err = db.First(&other, "public = ?", "test-public-2").Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), other.LastRx)
+}
+func TestGetClientByPublic(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	db.Create(&dbtest.ClientCert{Public: "test-public", Ifname: "test-ifname", IP: "192.168.1.1", Config: "active-config"})
+	db.Create(&dbtest.ArchiveClientCert{Public: "test-archived", Ifname: "test-ifname", IP: "192.168.1.2", Config: "old-config"})
+	db.Create(&dbtest.ArchiveClientCert{Public: "test-archived", Ifname: "test-ifname", IP: "192.168.1.2", Config: "new-config"})
+
+	cert, err := repo.GetClientByPublic("test-public")
+	assert.NoError(t, err)
+	assert.Equal(t, "active-config", cert.Config)
+
+	_, err = repo.GetClientByPublic("test-archived")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	archived, err := repo.GetArchiveClientByPublic("test-archived")
+	assert.NoError(t, err)
+	assert.Equal(t, "new-config", archived.Config)
+}
+func TestUpdateClientCert(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	db.Create(&dbtest.ClientCert{Public: "test-public", Private: "test-private", Ifname: "test-ifname", IP: "192.168.1.2/24", AllowedIPs: "", Config: "old-config"})
+
+	err := repo.UpdateClientCert("test-public", dbtest.ClientCert{IP: "192.168.1.5/24", AllowedIPs: "10.0.0.0/8", Profile: "office", Dns: "10.0.0.1", Config: "new-config", Name: "ignored"}, false, nil)
+	assert.NoError(t, err)
+
+	cert, err := repo.GetClientByPublic("test-public")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.5/24", cert.IP)
+	assert.Equal(t, "10.0.0.0/8", cert.AllowedIPs)
+	assert.Equal(t, "new-config", cert.Config)
+	assert.Equal(t, "office", cert.Profile)
+	assert.Equal(t, "10.0.0.1", cert.Dns)
+	assert.Equal(t, "test-private", cert.Private)
+	assert.Empty(t, cert.Name)
+
+	err = repo.UpdateClientCert("test-public", dbtest.ClientCert{IP: "192.168.1.5/24", Config: "new-config", Name: "laptop", Owner: "alice", Tags: "office"}, true, nil)
+	assert.NoError(t, err)
+	cert, err = repo.GetClientByPublic("test-public")
+	assert.NoError(t, err)
+	assert.Equal(t, "laptop", cert.Name)
+	assert.Equal(t, "alice", cert.Owner)
+	assert.Equal(t, "office", cert.Tags)
+
+	// error of apply rolls back addresses and meta
+	err = repo.UpdateClientCert("test-public", dbtest.ClientCert{IP: "192.168.1.9/24", Config: "other-config", Name: "phone"}, true, func() error {
+		return errors.New("device error")
+	})
+	assert.EqualError(t, err, "device error")
+	cert, err = repo.GetClientByPublic("test-public")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.5/24", cert.IP)
+	assert.Equal(t, "new-config", cert.Config)
+	assert.Equal(t, "laptop", cert.Name)
+
+	err = repo.UpdateClientCert("unknown", dbtest.ClientCert{IP: "192.168.1.6/24", Config: "config"}, false, nil)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+func TestRotateClientCert(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	db.Create(&dbtest.ClientCert{Public: "old-public", Private: "old-private", Ifname: "test-ifname", IP: "192.168.1.2/24", AllowedIPs: "10.0.0.0/8", Config: "old-config", Quota: 100, LastRx: 10})
+
+	// error of apply rolls back the rotation
+	_, err := repo.RotateClientCert("old-public", "new-public", "new-private", "new-psk", "new-config", func() error {
+		return errors.New("device error")
+	})
+	assert.EqualError(t, err, "device error")
+	cert, err := repo.GetClientByPublic("old-public")
+	assert.NoError(t, err)
+	assert.Equal(t, "old-private", cert.Private)
+	_, err = repo.GetArchiveClientByPublic("old-public")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	old, err := repo.RotateClientCert("old-public", "new-public", "new-private", "new-psk", "new-config", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "old-private", old.Private)
+
+	cert, err = repo.GetClientByPublic("new-public")
+	assert.NoError(t, err)
+	assert.Equal(t, old.ID, cert.ID)
+	assert.Equal(t, "new-private", cert.Private)
+	assert.Equal(t, "new-psk", cert.PresharedKey)
+	assert.Equal(t, "new-config", cert.Config)
+	assert.Equal(t, "192.168.1.2/24", cert.IP)
+	assert.Equal(t, "10.0.0.0/8", cert.AllowedIPs)
+	assert.Equal(t, int64(100), cert.Quota)
+	assert.Equal(t, int64(0), cert.LastRx)
+
+	archived, err := repo.GetArchiveClientByPublic("old-public")
+	assert.NoError(t, err)
+	assert.Equal(t, "old-private", archived.Private)
+	assert.Equal(t, "old-config", archived.Config)
+	assert.Equal(t, dbtest.ReasonRotated, archived.Reason)
+
+	_, err = repo.RotateClientCert("old-public", "x", "y", "", "z", nil)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+func TestFindClients(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	db.Create(&dbtest.ClientCert{Public: "pub1", Ifname: "wg0", IP: "10.0.0.2/32", Owner: "alice", Tags: "laptop,office"})
+	db.Create(&dbtest.ClientCert{Public: "pub2", Ifname: "wg0", IP: "10.0.0.3/32", Owner: "alice", Tags: "phone"})
+	db.Create(&dbtest.ClientCert{Public: "pub3", Ifname: "wg0", IP: "10.0.0.4/32", Owner: "bob", Tags: "laptops"})
+
+	certs, _, err := repo.FindClients("", "", dbtest.Page{})
+	assert.NoError(t, err)
+	assert.Len(t, certs, 3)
+
+	certs, _, err = repo.FindClients("alice", "", dbtest.Page{})
+	assert.NoError(t, err)
+	assert.Len(t, certs, 2)
+
+	certs, _, err = repo.FindClients("", "laptop", dbtest.Page{})
+	assert.NoError(t, err)
+	assert.Len(t, certs, 1)
+	assert.Equal(t, "pub1", certs[0].Public)
+
+	certs, _, err = repo.FindClients("bob", "office", dbtest.Page{})
+	assert.NoError(t, err)
+	assert.Len(t, certs, 0)
+
+	// wildcards of LIKE in tag are matched as they are
+	db.Create(&dbtest.ClientCert{Public: "pub4", Ifname: "wg0", IP: "10.0.0.5/32", Tags: "a,50%_off,back\\slash"})
+	for tag, want := range map[string][]string{"_": nil, "%": nil, "______": nil, "50%_off": {"pub4"}, "50%\\_off": nil, "back\\slash": {"pub4"}, "back_slash": nil} {
+		certs, _, err = repo.FindClients("", tag, dbtest.Page{})
+		assert.NoError(t, err)
+		var publics []string
+		for _, v := range certs {
+			publics = append(publics, v.Public)
+		}
+		assert.Equal(t, want, publics, tag)
+	}
+}
+func TestUpdateClientMeta(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	db.Create(&dbtest.ClientCert{Public: "test-public", Ifname: "wg0", IP: "10.0.0.2/32", Name: "old"})
+
+	err := repo.UpdateClientMeta("test-public", "laptop", "alice", "alice@example.com", "", "office")
+	assert.NoError(t, err)
+
+	cert, err := repo.GetClientByPublic("test-public")
+	assert.NoError(t, err)
+	assert.Equal(t, "laptop", cert.Name)
+	assert.Equal(t, "alice", cert.Owner)
+	assert.Equal(t, "office", cert.Tags)
+
+	_, err = repo.DeleteClientCert("test-public", dbtest.ReasonDeleted)
+	assert.NoError(t, err)
+	archived, err := repo.GetArchiveClientByPublic("test-public")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", archived.Owner)
+
+	err = repo.UpdateClientMeta("missing", "", "", "", "", "")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+func TestFindClients_Page(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	repo.CreateClientCert(&dbtest.ClientCert{Public: "pub10", Private: "priv", Ifname: "wg0", IP: "10.0.0.10/24", Config: "config"})
+	repo.CreateClientCert(&dbtest.ClientCert{Public: "pub2", Private: "priv", Ifname: "wg0", IP: "10.0.0.2/24", Config: "config"})
+	repo.CreateClientCert(&dbtest.ClientCert{Public: "pub9", Private: "priv", Ifname: "wg0", IP: "10.0.0.9/24", Config: "config"})
+
+	certs, total, err := repo.FindClients("", "", dbtest.Page{Sort: "ip_sort", Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Len(t, certs, 2)
+	assert.Equal(t, "pub2", certs[0].Public)
+	assert.Equal(t, "pub9", certs[1].Public)
+
+	certs, _, err = repo.FindClients("", "", dbtest.Page{Sort: "ip_sort", Desc: true, Offset: 2})
+	assert.NoError(t, err)
+	assert.Len(t, certs, 1)
+	assert.Equal(t, "pub2", certs[0].Public)
+
+	certs, _, err = repo.FindClients("", "", dbtest.Page{Columns: []string{"public", "ip"}})
+	assert.NoError(t, err)
+	assert.Len(t, certs, 3)
+	assert.Equal(t, "pub10", certs[0].Public)
+	assert.Empty(t, certs[0].Private)
+	assert.Empty(t, certs[0].Config)
+
+	err = repo.UpdateClientCert("pub10", dbtest.ClientCert{IP: "10.0.0.1/24", Config: "config"}, false, nil)
+	assert.NoError(t, err)
+	certs, _, err = repo.FindClients("", "", dbtest.Page{Sort: "ip_sort", Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "pub10", certs[0].Public)
+}
+func TestRestoreClientCert(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	db.Create(&dbtest.ClientCert{Public: "test-public", Private: "test-private", Ifname: "wg0", IP: "10.0.0.2/24", Config: "config"})
+	_, err := repo.DeleteClientCert("test-public", dbtest.ReasonDeleted)
+	assert.NoError(t, err)
+	arch, err := repo.GetArchiveClientByPublic("test-public")
+	assert.NoError(t, err)
+
+	byId, err := repo.GetArchiveClientById(arch.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-private", byId.Private)
+
+	// error of apply keeps the record in archive
+	err = repo.RestoreClientCert(arch.ID, &dbtest.ClientCert{Public: arch.Public, Private: arch.Private, Ifname: arch.Ifname, IP: arch.IP, Config: "new-config"}, func() error {
+		return errors.New("device error")
+	})
+	assert.EqualError(t, err, "device error")
+	_, err = repo.GetClientByPublic("test-public")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	err = repo.RestoreClientCert(arch.ID, &dbtest.ClientCert{Public: arch.Public, Private: arch.Private, Ifname: arch.Ifname, IP: arch.IP, Config: "new-config"}, nil)
+	assert.NoError(t, err)
+	cert, err := repo.GetClientByPublic("test-public")
+	assert.NoError(t, err)
+	assert.Equal(t, "new-config", cert.Config)
+	_, err = repo.GetArchiveClientById(arch.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// record is already restored, new client is not saved
+	err = repo.RestoreClientCert(arch.ID, &dbtest.ClientCert{Public: "other", Private: "other", Ifname: "wg0", IP: "10.0.0.3/24", Config: "config"}, nil)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repo.GetClientByPublic("other")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+func TestPurgeClientArchive(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	old := time.Now().Add(-48 * time.Hour)
+	db.Create(&dbtest.ArchiveClientCert{Model: gorm.Model{CreatedAt: old}, Public: "old", Ifname: "wg0", IP: "10.0.0.2/24"})
+	db.Create(&dbtest.ArchiveClientCert{Public: "new", Ifname: "wg0", IP: "10.0.0.3/24"})
+
+	removed, err := repo.PurgeClientArchive(time.Now().Add(-24 * time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, removed, 1)
+	assert.Equal(t, "old", removed[0].Public)
+
+	archive, total, err := repo.GetClientArchive(dbtest.Page{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "new", archive[0].Public)
+
+	cert, err := repo.DeleteArchiveClient(archive[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", cert.Public)
+	_, err = repo.DeleteArchiveClient(archive[0].ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+func TestCreateClientCerts(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	certs := []dbtest.ClientCert{
+		{Public: "pub1", Private: "priv1", Ifname: "wg0", IP: "10.0.0.2/24", Config: "config"},
+		{Public: "pub2", Private: "priv2", Ifname: "wg0", IP: "10.0.0.3/24", Config: "config"},
+	}
+	err := repo.CreateClientCerts(certs, func() error { return errors.New("device error") })
+	assert.EqualError(t, err, "device error")
+	all, err := repo.GetAllClient()
+	assert.NoError(t, err)
+	assert.Len(t, all, 0)
+
+	applied := false
+	err = repo.CreateClientCerts(certs, func() error {
+		applied = true
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, applied)
+	all, err = repo.GetAllClient()
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	// duplicate address fails the whole batch
+	err = repo.CreateClientCerts([]dbtest.ClientCert{
+		{Public: "pub3", Private: "priv3", Ifname: "wg0", IP: "10.0.0.4/24", Config: "config"},
+		{Public: "pub4", Private: "priv4", Ifname: "wg0", IP: "10.0.0.2/24", Config: "config"},
+	}, nil)
+	assert.Error(t, err)
+	_, err = repo.GetClientByPublic("pub3")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"fmt"
+	"wireguard_api/db"
+
+	"gorm.io/gorm"
+)
+
+func (r *ClientCertRepository) CreateProfile(profile *db.RoutingProfile) error {
+	return r.db.Create(profile).Error
+}
+
+func (r *ClientCertRepository) GetProfiles() ([]db.RoutingProfile, error) {
+	var profiles []db.RoutingProfile
+	err := r.db.Order("name").Find(&profiles).Error
+	return profiles, err
+}
+
+func (r *ClientCertRepository) GetProfileByName(name string) (db.RoutingProfile, error) {
+	var profile db.RoutingProfile
+	err := r.db.Where("name = ?", name).First(&profile).Error
+	return profile, err
+}
+
+// UpdateProfile saves routes and description of profile and config made by render for every
+// client of the profile in one transaction, returns clients with updated config.
+func (r *ClientCertRepository) UpdateProfile(name, routes, description string, render func(cert db.ClientCert) (string, error)) ([]db.ClientCert, error) {
+	var certs []db.ClientCert
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&db.RoutingProfile{}).
+			Where("name = ?", name).
+			Updates(map[string]interface{}{"routes": routes, "description": description})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		err := tx.Where("profile = ?", name).Find(&certs).Error
+		if err != nil {
+			return err
+		}
+		for i := range certs {
+			config, err := render(certs[i])
+			if err != nil {
+				return fmt.Errorf("client %s: %w", certs[i].Public, err)
+			}
+			err = tx.Model(&db.ClientCert{}).Where("id = ?", certs[i].ID).Update("config", config).Error
+			if err != nil {
+				return err
+			}
+			certs[i].Config = config
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// DeleteProfile removes profile which is not used by clients.
+func (r *ClientCertRepository) DeleteProfile(name string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var used int64
+		err := tx.Model(&db.ClientCert{}).Where("profile = ?", name).Count(&used).Error
+		if err != nil {
+			return err
+		}
+		if used > 0 {
+			return fmt.Errorf("profile %s is used by %d clients", name, used)
+		}
+		result := tx.Unscoped().Where("name = ?", name).Delete(&db.RoutingProfile{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	dbtest "wireguard_api/db"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestCreateProfile(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	err := repo.CreateProfile(&dbtest.RoutingProfile{Name: "office", Routes: "10.1.0.0/16,10.2.0.0/16"})
+	assert.NoError(t, err)
+	err = repo.CreateProfile(&dbtest.RoutingProfile{Name: "full-tunnel", Routes: "0.0.0.0/0,::/0"})
+	assert.NoError(t, err)
+	err = repo.CreateProfile(&dbtest.RoutingProfile{Name: "office"})
+	assert.Error(t, err)
+
+	profiles, err := repo.GetProfiles()
+	assert.NoError(t, err)
+	assert.Len(t, profiles, 2)
+	assert.Equal(t, "full-tunnel", profiles[0].Name)
+
+	profile, err := repo.GetProfileByName("office")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.1.0.0/16,10.2.0.0/16", profile.Routes)
+}
+
+func TestUpdateProfile(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	assert.NoError(t, repo.CreateProfile(&dbtest.RoutingProfile{Name: "office", Routes: "10.1.0.0/16"}))
+	db.Create(&dbtest.ClientCert{Public: "pub1", Private: "priv1", Ifname: "wg0", IP: "10.0.0.2/24", Config: "old", Profile: "office"})
+	db.Create(&dbtest.ClientCert{Public: "pub2", Private: "priv2", Ifname: "wg0", IP: "10.0.0.3/24", Config: "old"})
+
+	certs, err := repo.UpdateProfile("office", "10.1.0.0/16,10.3.0.0/16", "main office", func(cert dbtest.ClientCert) (string, error) {
+		return "new " + cert.Public, nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, certs, 1)
+	assert.Equal(t, "new pub1", certs[0].Config)
+
+	cert, err := repo.GetClientByPublic("pub1")
+	assert.NoError(t, err)
+	assert.Equal(t, "new pub1", cert.Config)
+	cert, err = repo.GetClientByPublic("pub2")
+	assert.NoError(t, err)
+	assert.Equal(t, "old", cert.Config)
+	profile, err := repo.GetProfileByName("office")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.1.0.0/16,10.3.0.0/16", profile.Routes)
+	assert.Equal(t, "main office", profile.Description)
+
+	// error of render rolls back profile and configs
+	_, err = repo.UpdateProfile("office", "10.9.0.0/16", "", func(cert dbtest.ClientCert) (string, error) {
+		return "", errors.New("interface wg0 not found")
+	})
+	assert.Error(t, err)
+	profile, err = repo.GetProfileByName("office")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.1.0.0/16,10.3.0.0/16", profile.Routes)
+
+	_, err = repo.UpdateProfile("unknown", "", "", nil)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestDeleteProfile(t *testing.T) {
+	db := setupTestDB()
+	repo := NewClientCertRepository(db)
+
+	assert.NoError(t, repo.CreateProfile(&dbtest.RoutingProfile{Name: "office", Routes: "10.1.0.0/16"}))
+	db.Create(&dbtest.ClientCert{Public: "pub1", Private: "priv1", Ifname: "wg0", IP: "10.0.0.2/24", Config: "config", Profile: "office"})
+
+	err := repo.DeleteProfile("office")
+	assert.EqualError(t, err, "profile office is used by 1 clients")
+
+	db.Unscoped().Where("public = ?", "pub1").Delete(&dbtest.ClientCert{})
+	assert.NoError(t, repo.DeleteProfile("office"))
+	_, err = repo.GetProfileByName("office")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// name of removed profile can be used again
+	assert.NoError(t, repo.CreateProfile(&dbtest.RoutingProfile{Name: "office"}))
+
+	err = repo.DeleteProfile("unknown")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"fmt"
 	"net"
+	"time"
 	"wireguard_api/db"
 
 	"gorm.io/gorm"
@@ -20,6 +21,27 @@ func (r *ServerCertRepository) CreateServerCert(cert *db.ServerCert) error {
 	return r.db.Create(cert).Error
 }
 
+// ImportServer saves interface with its clients in one transaction, apply is called before commit
+// and its error rolls back the import.
+func (r *ServerCertRepository) ImportServer(serv *db.ServerCert, certs []db.ClientCert, apply func() error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(serv).Error
+		if err != nil {
+			return err
+		}
+		if len(certs) > 0 {
+			err = tx.Create(&certs).Error
+			if err != nil {
+				return err
+			}
+		}
+		if apply != nil {
+			return apply()
+		}
+		return nil
+	})
+}
+
 func (r *ServerCertRepository) GetServerCertByIfname(ifname string) (db.ServerCert, error) {
 	var cert db.ServerCert
 	err := r.db.Where("ifname = ?", ifname).First(&cert).Error
@@ -38,19 +60,26 @@ func (r *ServerCertRepository) DeleteServer(private, ifname string) error {
 			return fmt.Errorf("did not find record with correct ifname: %s  and private %s in database", ifname, private)
 		}
 
+		// interface and its clients are archived with the same time and clients keep id of archived interface
+		now := time.Now().UTC()
 		errTx := tx.Exec(`
-			INSERT INTO archive_client_certs (created_at, ifname, private, public, ip, allowed_ips, config, deleted_at)
-			SELECT created_at, ifname, private, public, ip, allowed_ips, config, DATETIME('now')
-			FROM client_certs
-			WHERE ifname = ?;`, ifname)
+			INSERT INTO archive_server_certs (created_at, ifname, private, public, endpoint, ip, config, port, default_psk, dns, mtu, keepalive, pools, excluded, deleted_at)
+			SELECT created_at, ifname, private, public, endpoint, ip, config, port, default_psk, dns, mtu, keepalive, pools, excluded, ?
+			FROM server_certs
+			WHERE ifname = ?;`, now, ifname)
 		if errTx.Error != nil {
 			return errTx.Error
 		}
+		var archived db.ArchiveServerCert
+		err = tx.Unscoped().Where("ifname = ?", ifname).Order("id DESC").First(&archived).Error
+		if err != nil {
+			return err
+		}
 		errTx = tx.Exec(`
-			INSERT INTO archive_server_certs (created_at, ifname, private, public, endpoint, ip, config, port, deleted_at)
-			SELECT created_at, ifname, private, public, endpoint, ip, config, port, DATETIME('now')
-			FROM server_certs
-			WHERE ifname = ?;`, ifname)
+			INSERT INTO archive_client_certs (created_at, ifname, private, public, ip, allowed_ips, config, preshared_key, expires_at, name, owner, email, description, tags, ip_sort, profile, dns, mtu, keepalive, reason, deleted_at, archive_server_id)
+			SELECT created_at, ifname, private, public, ip, allowed_ips, config, preshared_key, expires_at, name, owner, email, description, tags, ip_sort, profile, dns, mtu, keepalive, ?, ?, ?
+			FROM client_certs
+			WHERE ifname = ?;`, db.ReasonInterfaceDeleted, now, archived.ID, ifname)
 		if errTx.Error != nil {
 			return errTx.Error
 		}
@@ -58,7 +87,7 @@ func (r *ServerCertRepository) DeleteServer(private, ifname string) error {
 		if err != nil {
 			return err
 		}
-		err = tx.Unscoped().Where("private = ? AND ifname = ?", private, ifname).Delete(&db.ServerCert{}).Error
+		err = tx.Unscoped().Delete(&serverCertExists).Error
 		if err != nil {
 			return err
 		}
@@ -67,13 +96,63 @@ func (r *ServerCertRepository) DeleteServer(private, ifname string) error {
 	})
 }
 
-func (r *ServerCertRepository) GetServerArchive() ([]db.ArchiveServerCert, error) {
+// UpdateServer saves values of interface and config made by render for every client
+// of the interface in one transaction, returns clients which config was changed.
+// apply is called before commit and its error rolls back the update.
+func (r *ServerCertRepository) UpdateServer(ifname string, values map[string]interface{}, render func(cert db.ClientCert) (string, error), apply func() error) ([]db.ClientCert, error) {
+	var changed []db.ClientCert
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&db.ServerCert{}).Where("ifname = ?", ifname).Updates(values)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		var certs []db.ClientCert
+		err := tx.Where("ifname = ?", ifname).Find(&certs).Error
+		if err != nil {
+			return err
+		}
+		for _, cert := range certs {
+			config, err := render(cert)
+			if err != nil {
+				return fmt.Errorf("client %s: %w", cert.Public, err)
+			}
+			if config == cert.Config {
+				continue
+			}
+			err = tx.Model(&db.ClientCert{}).Where("id = ?", cert.ID).Update("config", config).Error
+			if err != nil {
+				return err
+			}
+			cert.Config = config
+			changed = append(changed, cert)
+		}
+		if apply != nil {
+			return apply()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+func (r *ServerCertRepository) GetServerArchive(page db.Page) ([]db.ArchiveServerCert, int64, error) {
 	var archive []db.ArchiveServerCert
-	err := r.db.Unscoped().Find(&archive).Error
+	var total int64
+	query := r.db.Unscoped().Model(&db.ArchiveServerCert{})
+	err := query.Count(&total).Error
+	if err != nil {
+		return []db.ArchiveServerCert{}, 0, err
+	}
+	err = paginate(query, page).Find(&archive).Error
 	if err != nil {
-		return []db.ArchiveServerCert{}, err
+		return []db.ArchiveServerCert{}, 0, err
 	}
-	return archive, nil
+	return archive, total, nil
 }
 
 func (r *ServerCertRepository) GetServerInterfaces() ([]db.ServerCert, error) {
@@ -204,3 +283,78 @@ func (r *ServerCertRepository) GetForward() ([]db.Forward, error) {
 	}
 	return fwrd, nil
 }
+
+func (r *ServerCertRepository) GetArchiveServerById(id uint) (db.ArchiveServerCert, error) {
+	var cert db.ArchiveServerCert
+	err := r.db.Unscoped().Where("id = ?", id).First(&cert).Error
+	return cert, err
+}
+
+// RestoreServerCert creates interface from archive record and removes the record from archive.
+func (r *ServerCertRepository) RestoreServerCert(archiveId uint, cert *db.ServerCert) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(cert).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("id = ?", archiveId).Delete(&db.ArchiveServerCert{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// PurgeServerArchive removes archive records older than before and returns removed records.
+func (r *ServerCertRepository) PurgeServerArchive(before time.Time) ([]db.ArchiveServerCert, error) {
+	var certs []db.ArchiveServerCert
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := archivedBefore(tx.Unscoped(), before).Find(&certs).Error
+		if err != nil || len(certs) == 0 {
+			return err
+		}
+		ids := make([]uint, 0, len(certs))
+		for _, v := range certs {
+			ids = append(ids, v.ID)
+		}
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&db.ArchiveServerCert{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// DeleteArchiveServer removes archived interface together with clients archived when it was deleted.
+func (r *ServerCertRepository) DeleteArchiveServer(id uint) (db.ArchiveServerCert, []db.ArchiveClientCert, error) {
+	var cert db.ArchiveServerCert
+	var clients []db.ArchiveClientCert
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("id = ?", id).First(&cert).Error
+		if err != nil {
+			return err
+		}
+		err = archivedWithServer(tx.Unscoped(), id).Find(&clients).Error
+		if err != nil {
+			return err
+		}
+		if len(clients) > 0 {
+			ids := make([]uint, 0, len(clients))
+			for _, v := range clients {
+				ids = append(ids, v.ID)
+			}
+			err = tx.Unscoped().Where("id IN ?", ids).Delete(&db.ArchiveClientCert{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(&cert).Error
+	})
+	if err != nil {
+		return db.ArchiveServerCert{}, nil, err
+	}
+	return cert, clients, nil
+}
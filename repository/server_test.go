@@ -1,10 +1,13 @@
 package repository
 
 import (
+	"errors"
 	"testing"
+	"time"
 	dbtest "wireguard_api/db"
 
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 func TestCreateServerCert(t *testing.T) {
@@ -90,11 +93,234 @@ func TestDeleteServerCert(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, certs, 0)
 
-	aCerts, err := repoClient.GetClientArchive()
+	aCerts, _, err := repoClient.GetClientArchive(dbtest.Page{})
 	assert.NoError(t, err)
 	assert.Len(t, aCerts, 2)
+	assert.Equal(t, dbtest.ReasonInterfaceDeleted, aCerts[0].Reason)
 
-	aServ, err := repoServ.GetServerArchive()
+	aServ, _, err := repoServ.GetServerArchive(dbtest.Page{})
 	assert.NoError(t, err)
 	assert.Len(t, aServ, 1)
 }
+
+func TestRestoreServerCert(t *testing.T) {
+	db := setupTestDB()
+	repoServ := NewServerCertRepository(db)
+	repoClient := NewClientCertRepository(db)
+
+	serv := &dbtest.ServerCert{Public: "test-public", Private: "test-private", Ifname: "wg0", Endpoint: "10.0.0.1", Ip: "192.168.1.1/24", Config: "test-config", Port: 1000}
+	assert.NoError(t, repoServ.CreateServerCert(serv))
+	assert.NoError(t, repoClient.CreateClientCert(&dbtest.ClientCert{Public: "pub1", Private: "priv1", Ifname: "wg0", IP: "192.168.1.2/24", Config: "config"}))
+	assert.NoError(t, repoClient.CreateClientCert(&dbtest.ClientCert{Public: "pub2", Private: "priv2", Ifname: "wg0", IP: "192.168.1.3/24", Config: "config"}))
+	_, err := repoClient.DeleteClientCert("pub2", dbtest.ReasonDeleted)
+	assert.NoError(t, err)
+	assert.NoError(t, repoServ.DeleteServer(serv.Private, serv.Ifname))
+
+	aServ, _, err := repoServ.GetServerArchive(dbtest.Page{})
+	assert.NoError(t, err)
+	assert.Len(t, aServ, 1)
+
+	clients, err := repoClient.GetArchiveClientsOfServer(aServ[0].ID)
+	assert.NoError(t, err)
+	assert.Len(t, clients, 1)
+	assert.Equal(t, "pub1", clients[0].Public)
+
+	arch, err := repoServ.GetArchiveServerById(aServ[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-private", arch.Private)
+
+	err = repoServ.RestoreServerCert(arch.ID, &dbtest.ServerCert{Public: arch.Public, Private: arch.Private, Ifname: arch.Ifname, Endpoint: arch.Endpoint, Ip: arch.Ip, Config: arch.Config, Port: arch.Port})
+	assert.NoError(t, err)
+	restored, err := repoServ.GetServerCertByIfname("wg0")
+	assert.NoError(t, err)
+	assert.Equal(t, "test-private", restored.Private)
+
+	_, err = repoServ.GetArchiveServerById(arch.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestArchiveClientsOfServer(t *testing.T) {
+	db := setupTestDB()
+	repoServ := NewServerCertRepository(db)
+	repoClient := NewClientCertRepository(db)
+
+	// same interface is deleted twice within one second
+	for _, public := range []string{"pub1", "pub2"} {
+		serv := &dbtest.ServerCert{Public: "test-public", Private: "test-private", Ifname: "wg0", Endpoint: "10.0.0.1", Ip: "192.168.1.1/24", Config: "test-config", Port: 1000}
+		assert.NoError(t, repoServ.CreateServerCert(serv))
+		assert.NoError(t, repoClient.CreateClientCert(&dbtest.ClientCert{Public: public, Private: "priv", Ifname: "wg0", IP: "192.168.1.2/24", Config: "config"}))
+		assert.NoError(t, repoServ.DeleteServer(serv.Private, serv.Ifname))
+	}
+
+	aServ, _, err := repoServ.GetServerArchive(dbtest.Page{})
+	assert.NoError(t, err)
+	assert.Len(t, aServ, 2)
+	for i, public := range []string{"pub1", "pub2"} {
+		clients, err := repoClient.GetArchiveClientsOfServer(aServ[i].ID)
+		assert.NoError(t, err)
+		assert.Len(t, clients, 1)
+		assert.Equal(t, public, clients[0].Public)
+		assert.Equal(t, aServ[i].ID, *clients[0].ArchiveServerId)
+		assert.Equal(t, aServ[i].DeletedAt.Time.Unix(), clients[0].DeletedAt.Time.Unix())
+	}
+
+	// record archived without id of interface is matched by time of archiving
+	legacy := dbtest.ArchiveServerCert{Ifname: "wg1"}
+	legacy.DeletedAt = gorm.DeletedAt{Time: time.Now().UTC().Truncate(time.Second), Valid: true}
+	db.Create(&legacy)
+	client := dbtest.ArchiveClientCert{Public: "pub3", Ifname: "wg1", IP: "192.168.2.2/24", Reason: dbtest.ReasonInterfaceDeleted}
+	client.DeletedAt = legacy.DeletedAt
+	db.Create(&client)
+
+	_, clients, err := repoServ.DeleteArchiveServer(legacy.ID)
+	assert.NoError(t, err)
+	assert.Len(t, clients, 1)
+	assert.Equal(t, "pub3", clients[0].Public)
+
+	_, clients, err = repoServ.DeleteArchiveServer(aServ[0].ID)
+	assert.NoError(t, err)
+	assert.Len(t, clients, 1)
+	assert.Equal(t, "pub1", clients[0].Public)
+	clients, err = repoClient.GetArchiveClientsOfServer(aServ[1].ID)
+	assert.NoError(t, err)
+	assert.Len(t, clients, 1)
+}
+
+func TestPurgeServerArchive(t *testing.T) {
+	db := setupTestDB()
+	repoServ := NewServerCertRepository(db)
+	repoClient := NewClientCertRepository(db)
+
+	serv := &dbtest.ServerCert{Public: "test-public", Private: "test-private", Ifname: "wg0", Endpoint: "10.0.0.1", Ip: "192.168.1.1/24", Config: "test-config", Port: 1000}
+	assert.NoError(t, repoServ.CreateServerCert(serv))
+	assert.NoError(t, repoClient.CreateClientCert(&dbtest.ClientCert{Public: "pub1", Private: "priv1", Ifname: "wg0", IP: "192.168.1.2/24", Config: "config"}))
+	assert.NoError(t, repoServ.DeleteServer(serv.Private, serv.Ifname))
+	db.Create(&dbtest.ArchiveClientCert{Public: "other", Ifname: "wg0", IP: "192.168.1.3/24", Reason: dbtest.ReasonDeleted})
+
+	removed, err := repoServ.PurgeServerArchive(time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, removed, 0)
+
+	aServ, _, err := repoServ.GetServerArchive(dbtest.Page{})
+	assert.NoError(t, err)
+	cert, clients, err := repoServ.DeleteArchiveServer(aServ[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "wg0", cert.Ifname)
+	assert.Len(t, clients, 1)
+	assert.Equal(t, "pub1", clients[0].Public)
+
+	archive, _, err := repoClient.GetClientArchive(dbtest.Page{})
+	assert.NoError(t, err)
+	assert.Len(t, archive, 1)
+	assert.Equal(t, "other", archive[0].Public)
+
+	db.Create(&dbtest.ArchiveServerCert{Model: gorm.Model{CreatedAt: time.Now().Add(-48 * time.Hour)}, Ifname: "wg1"})
+	removed, err = repoServ.PurgeServerArchive(time.Now().Add(-24 * time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, removed, 1)
+	assert.Equal(t, "wg1", removed[0].Ifname)
+}
+
+func TestImportServer(t *testing.T) {
+	db := setupTestDB()
+	repoServ := NewServerCertRepository(db)
+	repoClient := NewClientCertRepository(db)
+
+	serv := &dbtest.ServerCert{Public: "pub-wg0", Private: "priv-wg0", Ifname: "wg0", Endpoint: "vpn.example.com", Ip: "10.0.0.1/24", Config: "config", Port: 51820}
+	certs := []dbtest.ClientCert{
+		{Public: "pub1", Ifname: "wg0", IP: "10.0.0.2/24", Config: "config1"},
+		{Public: "pub2", Private: "priv2", Ifname: "wg0", IP: "10.0.0.3/24", Config: "config2"},
+	}
+	applied := false
+	err := repoServ.ImportServer(serv, certs, func() error {
+		applied = true
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, applied)
+	assert.NotZero(t, serv.ID)
+	clients, err := repoClient.GetClientCertsByIfname("wg0")
+	assert.NoError(t, err)
+	assert.Len(t, clients, 2)
+
+	// error of apply rolls back interface and clients
+	serv = &dbtest.ServerCert{Public: "pub-wg1", Private: "priv-wg1", Ifname: "wg1", Endpoint: "vpn.example.com", Ip: "10.1.0.1/24", Config: "config", Port: 51821}
+	err = repoServ.ImportServer(serv, []dbtest.ClientCert{{Public: "pub3", Ifname: "wg1", IP: "10.1.0.2/24", Config: "config3"}}, func() error {
+		return errors.New("add link wg1: already exists")
+	})
+	assert.EqualError(t, err, "add link wg1: already exists")
+	_, err = repoServ.GetServerCertByIfname("wg1")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repoClient.GetClientByPublic("pub3")
+	assert.Error(t, err)
+
+	// address of client is unique
+	serv = &dbtest.ServerCert{Public: "pub-wg2", Private: "priv-wg2", Ifname: "wg2", Endpoint: "vpn.example.com", Ip: "10.2.0.1/24", Config: "config", Port: 51822}
+	err = repoServ.ImportServer(serv, []dbtest.ClientCert{{Public: "pub4", Ifname: "wg2", IP: "10.0.0.2/24", Config: "config4"}}, nil)
+	assert.Error(t, err)
+}
+
+func TestUpdateServer(t *testing.T) {
+	db := setupTestDB()
+	repoServ := NewServerCertRepository(db)
+	repoClient := NewClientCertRepository(db)
+
+	serv := &dbtest.ServerCert{Public: "test-public", Private: "test-private", Ifname: "wg0", Endpoint: "10.0.0.1", Ip: "192.168.1.1/24", Config: "test-config", Port: 1000}
+	assert.NoError(t, repoServ.CreateServerCert(serv))
+	assert.Equal(t, 20, *serv.Keepalive)
+	assert.NoError(t, repoClient.CreateClientCert(&dbtest.ClientCert{Public: "pub1", Private: "priv1", Ifname: "wg0", IP: "192.168.1.2/24", Config: "old"}))
+	assert.NoError(t, repoClient.CreateClientCert(&dbtest.ClientCert{Public: "pub2", Private: "priv2", Ifname: "wg1", IP: "192.168.2.2/24", Config: "old"}))
+
+	certs, err := repoServ.UpdateServer("wg0", map[string]interface{}{"dns": "192.168.1.1", "mtu": 1380, "keepalive": 0}, func(cert dbtest.ClientCert) (string, error) {
+		return "new " + cert.Public, nil
+	}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, certs, 1)
+
+	updated, err := repoServ.GetServerCertByIfname("wg0")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.1", updated.Dns)
+	assert.Equal(t, 1380, updated.Mtu)
+	assert.Equal(t, 0, *updated.Keepalive)
+	cert, err := repoClient.GetClientByPublic("pub1")
+	assert.NoError(t, err)
+	assert.Equal(t, "new pub1", cert.Config)
+	cert, err = repoClient.GetClientByPublic("pub2")
+	assert.NoError(t, err)
+	assert.Equal(t, "old", cert.Config)
+
+	// clients with the same config are not returned
+	certs, err = repoServ.UpdateServer("wg0", map[string]interface{}{"pools": "192.168.1.100-192.168.1.200"}, func(cert dbtest.ClientCert) (string, error) {
+		return "new " + cert.Public, nil
+	}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, certs, 0)
+	updated, err = repoServ.GetServerCertByIfname("wg0")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.100-192.168.1.200", updated.Pools)
+
+	_, err = repoServ.UpdateServer("wg0", map[string]interface{}{"mtu": 1280}, func(cert dbtest.ClientCert) (string, error) {
+		return "", errors.New("interface wg0 not found")
+	}, nil)
+	assert.Error(t, err)
+	updated, err = repoServ.GetServerCertByIfname("wg0")
+	assert.NoError(t, err)
+	assert.Equal(t, 1380, updated.Mtu)
+
+	// error of apply rolls back interface and configs
+	_, err = repoServ.UpdateServer("wg0", map[string]interface{}{"port": 2000}, func(cert dbtest.ClientCert) (string, error) {
+		return "port 2000 " + cert.Public, nil
+	}, func() error {
+		return errors.New("address already in use")
+	})
+	assert.EqualError(t, err, "address already in use")
+	updated, err = repoServ.GetServerCertByIfname("wg0")
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, updated.Port)
+	cert, err = repoClient.GetClientByPublic("pub1")
+	assert.NoError(t, err)
+	assert.Equal(t, "new pub1", cert.Config)
+
+	_, err = repoServ.UpdateServer("unknown", map[string]interface{}{"mtu": 1280}, nil, nil)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
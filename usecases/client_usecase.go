@@ -1,176 +1,804 @@
 package usecases
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/base64"
 	"fmt"
 	"log"
 	"net"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"wireguard_api/db"
 
-	"inet.af/netaddr"
+	"github.com/skip2/go-qrcode"
 
 	"golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
-func (u *Usecases) NewClient(ifname, ip, allowedIp string) (ClientResponse, error) {
+// PrivateKeyPlaceholder is written to config of client which keeps its private key itself
+const PrivateKeyPlaceholder = "<PRIVATE_KEY>"
 
-	ifname = strings.TrimSpace(ifname)
-	ip = strings.TrimSpace(ip)
-	allowedIp = strings.TrimSpace(allowedIp)
+// DefaultKeepalive is PersistentKeepalive of interface which did not set it
+const DefaultKeepalive = 20
 
-	re := regexp.MustCompile(`[ ,]+`)
-	normalAlloweIp := re.ReplaceAllString(allowedIp, ",")
+func (u *Usecases) NewClient(spec ClientSpec) (ClientResponse, error) {
+	// address is free until client is saved, so allocation and saving are not split
+	u.allocMu.Lock()
+	defer u.allocMu.Unlock()
 
-	privateKey, err := wgtypes.GeneratePrivateKey()
+	cert, err := u.newClientCert(spec, make(map[string]*ipPool))
+	if err != nil {
+		return ClientResponse{}, err
+	}
+
+	// peer is added before commit, so failed device leaves neither client nor its address
+	err = u.ClientRepo.CreateClientCerts([]db.ClientCert{cert}, func() error {
+		return u.setClient(cert.Ifname, cert.IP, cert.AllowedIPs, cert.Public, cert.PresharedKey)
+	})
 	if err != nil {
 		log.Printf("NewClient %v", err)
 		return ClientResponse{}, err
 	}
-	publicKey := privateKey.PublicKey()
+	u.syncWgQuick(cert.Ifname)
+
+	return newClientResponse(cert), nil
+}
+
+// newClientCert checks spec and makes keys, addresses and config of new client, addresses
+// are taken from pools of interfaces, pools keep addresses of clients which are not saved yet.
+func (u *Usecases) newClientCert(spec ClientSpec, pools map[string]*ipPool) (db.ClientCert, error) {
+
+	ifname := strings.TrimSpace(spec.Ifname)
+	ip := strings.TrimSpace(spec.Ip)
+	allowedIp := strings.TrimSpace(spec.AllowedIp)
+	profile := strings.TrimSpace(spec.Profile)
+	public := strings.TrimSpace(spec.Public)
+	expiresAt := spec.ExpiresAt
+
+	re := regexp.MustCompile(`[ ,]+`)
+	normalAlloweIp := re.ReplaceAllString(allowedIp, ",")
+	ip = re.ReplaceAllString(ip, ",")
+
+	meta := normalizeMeta(spec.ClientMeta)
+	settings, err := normalizeSettings(spec.ConfigSettings)
+	if err != nil {
+		return db.ClientCert{}, err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return db.ClientCert{}, fmt.Errorf("expiration time %s is in the past", expiresAt.Format(time.RFC3339))
+	}
+
+	// server keeps no private key when client sent its public key
+	var private string
+	if public != "" {
+		publicKey, err := wgtypes.ParseKey(public)
+		if err != nil {
+			log.Printf("NewClient %v", err)
+			return db.ClientCert{}, fmt.Errorf("bad public key: %w", err)
+		}
+		public = publicKey.String()
+		if _, err := u.ClientRepo.GetClientByPublic(public); err == nil {
+			return db.ClientCert{}, fmt.Errorf("client with public key %s already exists", public)
+		}
+	} else {
+		privateKey, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			log.Printf("NewClient %v", err)
+			return db.ClientCert{}, err
+		}
+		private = privateKey.String()
+		public = privateKey.PublicKey().String()
+	}
 
 	err = u.checkIpMask(ifname, ip)
 	if err != nil {
 		log.Printf("NewClient %v", err)
-		return ClientResponse{}, err
+		return db.ClientCert{}, err
 	}
 
 	servData, err := u.ClientRepo.GetPublicEnpointPort(ifname)
 	if err != nil {
 		log.Printf("NewClient %v", err)
-		return ClientResponse{}, err
+		return db.ClientCert{}, err
 	}
 
-	if ip == "" {
-		data, err := u.ClientRepo.GetPublicEnpointPort(ifname)
+	pool, err := u.loadPool(pools, servData)
+	if err != nil {
+		log.Printf("NewClient %v", err)
+		return db.ClientCert{}, err
+	}
+	err = pool.reserve(ip, "")
+	if err != nil {
+		return db.ClientCert{}, err
+	}
+	ip, err = pool.complete(ip)
+	if err != nil {
+		log.Printf("NewClient %v", err)
+		return db.ClientCert{}, err
+	}
+
+	ipList, err := u.configRoutes(ifname, profile, normalAlloweIp)
+	if err != nil {
+		log.Printf("NewClient %v", err)
+		return db.ClientCert{}, err
+	}
+
+	var presharedKey string
+	if (spec.Psk == nil && servData.DefaultPsk) || (spec.Psk != nil && *spec.Psk) {
+		key, err := wgtypes.GenerateKey()
 		if err != nil {
 			log.Printf("NewClient %v", err)
+			return db.ClientCert{}, err
+		}
+		presharedKey = key.String()
+	}
+
+	config := u.createConfig(private, ip, servData.Public, ipList, servData.Endpoint, servData.Port, presharedKey,
+		configSettings(servData, settings.Dns, settings.Mtu, settings.Keepalive))
+	return db.ClientCert{
+		Ifname:       ifname,
+		Private:      private,
+		Public:       public,
+		IP:           ip,
+		AllowedIPs:   normalAlloweIp,
+		Profile:      profile,
+		Dns:          settings.Dns,
+		Mtu:          settings.Mtu,
+		Keepalive:    settings.Keepalive,
+		Config:       config,
+		PresharedKey: presharedKey,
+		ExpiresAt:    expiresAt,
+		Name:         meta.Name,
+		Owner:        meta.Owner,
+		Email:        meta.Email,
+		Description:  meta.Description,
+		Tags:         strings.Join(meta.Tags, ","),
+	}, nil
+}
+
+func newClientResponse(cert db.ClientCert) ClientResponse {
+	return ClientResponse{
+		ClientMeta:     clientMeta(cert.Name, cert.Owner, cert.Email, cert.Description, cert.Tags),
+		ConfigSettings: ConfigSettings{Dns: cert.Dns, Mtu: cert.Mtu, Keepalive: cert.Keepalive},
+		Ifname:         cert.Ifname,
+		Private:        cert.Private,
+		Public:         cert.Public,
+		Config:         cert.Config,
+		Ip:             cert.IP,
+		AllowedIPs:     cert.AllowedIPs,
+		Profile:        cert.Profile,
+		PresharedKey:   cert.PresharedKey,
+		ExpiresAt:      cert.ExpiresAt,
+	}
+}
+
+// NewClients creates all clients of specs in one transaction, error of any client rolls back
+// the whole batch. Peers are added to interfaces before the transaction is committed.
+func (u *Usecases) NewClients(specs []ClientSpec) ([]ClientResponse, error) {
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("list of clients is empty")
+	}
+	u.allocMu.Lock()
+	defer u.allocMu.Unlock()
+
+	pools := make(map[string]*ipPool)
+	publics := make(map[string]struct{})
+	certs := make([]db.ClientCert, 0, len(specs))
+	for i, spec := range specs {
+		cert, err := u.newClientCert(spec, pools)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		if _, ok := publics[cert.Public]; ok {
+			return nil, fmt.Errorf("row %d: public key %s is used twice", i+1, cert.Public)
+		}
+		publics[cert.Public] = struct{}{}
+		certs = append(certs, cert)
+	}
+
+	err := u.ClientRepo.CreateClientCerts(certs, func() error {
+		return u.setClients(certs)
+	})
+	if err != nil {
+		log.Printf("NewClients %v", err)
+		return nil, err
+	}
+	log.Printf("NewClients: %d clients created", len(certs))
+
+	clients := make([]ClientResponse, 0, len(certs))
+	synced := make(map[string]struct{})
+	for _, cert := range certs {
+		clients = append(clients, newClientResponse(cert))
+		if _, ok := synced[cert.Ifname]; !ok {
+			synced[cert.Ifname] = struct{}{}
+			u.syncWgQuick(cert.Ifname)
+		}
+	}
+	return clients, nil
+}
+
+// ConfigsZip packs config of every client into zip archive, files are named by client name or address.
+func ConfigsZip(clients []ClientResponse) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	if _, err := writeConfigs(archive, clients); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeConfigs adds config files of clients to archive and returns file names in order of clients.
+func writeConfigs(archive *zip.Writer, clients []ClientResponse) ([]string, error) {
+	used := make(map[string]int)
+	names := make([]string, 0, len(clients))
+	for _, client := range clients {
+		name := configFileName(client, used)
+		file, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Write([]byte(client.Config)); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// configFileName returns unique file name of client config, used counts names which are taken.
+func configFileName(client ClientResponse, used map[string]int) string {
+	name := client.Name
+	if name == "" {
+		name = strings.Split(splitIps(client.Ip + ",")[0], "/")[0]
+	}
+	name = regexp.MustCompile(`[^A-Za-z0-9._-]+`).ReplaceAllString(name, "_")
+	used[name]++
+	if used[name] > 1 {
+		name = fmt.Sprintf("%s-%d", name, used[name])
+	}
+	return name + ".conf"
+}
+
+// setClients adds peers of clients with one update of every interface, peers added
+// to other interfaces are removed when update of an interface fails.
+func (u *Usecases) setClients(certs []db.ClientCert) error {
+	client, err := wgctrl.New()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var ifnames []string
+	peers := make(map[string][]wgtypes.PeerConfig)
+	for _, cert := range certs {
+		peer, err := u.peerConfig(cert.IP, cert.AllowedIPs, cert.Public, cert.PresharedKey)
+		if err != nil {
+			return err
+		}
+		if _, ok := peers[cert.Ifname]; !ok {
+			ifnames = append(ifnames, cert.Ifname)
+		}
+		peers[cert.Ifname] = append(peers[cert.Ifname], peer)
+	}
+
+	for i, ifname := range ifnames {
+		err = client.ConfigureDevice(ifname, wgtypes.Config{Peers: peers[ifname]})
+		if err == nil {
+			continue
+		}
+		for _, applied := range ifnames[:i] {
+			var remove []wgtypes.PeerConfig
+			for _, peer := range peers[applied] {
+				remove = append(remove, wgtypes.PeerConfig{PublicKey: peer.PublicKey, Remove: true})
+			}
+			if err := client.ConfigureDevice(applied, wgtypes.Config{Peers: remove}); err != nil {
+				log.Printf("setClients %v", err)
+			}
+		}
+		return fmt.Errorf("interface %s: %w", ifname, err)
+	}
+	return nil
+}
+
+func (u *Usecases) UpdateClient(public string, ip, allowedIp, profile *string, settings *ConfigSettings, meta *ClientMeta) (ClientResponse, error) {
+	public = strings.TrimSpace(public)
+	re := regexp.MustCompile(`[ ,]+`)
+
+	u.allocMu.Lock()
+	defer u.allocMu.Unlock()
+
+	cert, err := u.ClientRepo.GetClientByPublic(public)
+	if err != nil {
+		log.Printf("UpdateClient %v", err)
+		return ClientResponse{}, err
+	}
+	servData, err := u.ClientRepo.GetPublicEnpointPort(cert.Ifname)
+	if err != nil {
+		log.Printf("UpdateClient %v", err)
+		return ClientResponse{}, err
+	}
+
+	newIp := cert.IP
+	if ip != nil {
+		newIp = re.ReplaceAllString(strings.TrimSpace(*ip), ",")
+		err = u.checkIpMask(cert.Ifname, newIp)
+		if err != nil {
+			log.Printf("UpdateClient %v", err)
 			return ClientResponse{}, err
 		}
-		ip, err = u.generateIPs(ifname, data.Ip, servData.Ip)
+		newIp, err = mergeFamilies(newIp, cert.IP)
 		if err != nil {
-			log.Printf("NewClient %v", err)
+			log.Printf("UpdateClient %v", err)
+			return ClientResponse{}, err
+		}
+		pool, err := u.loadPool(make(map[string]*ipPool), servData)
+		if err != nil {
+			log.Printf("UpdateClient %v", err)
+			return ClientResponse{}, err
+		}
+		err = pool.reserve(newIp, cert.IP)
+		if err != nil {
+			log.Printf("UpdateClient %v", err)
 			return ClientResponse{}, err
 		}
+		newIp, err = pool.complete(newIp)
+		if err != nil {
+			log.Printf("UpdateClient %v", err)
+			return ClientResponse{}, err
+		}
+	}
 
+	newAllowedIp := cert.AllowedIPs
+	if allowedIp != nil {
+		newAllowedIp = re.ReplaceAllString(strings.TrimSpace(*allowedIp), ",")
 	}
 
-	_, ipList, err := u.containsIp(normalAlloweIp, ifname)
+	newProfile := cert.Profile
+	if profile != nil {
+		newProfile = strings.TrimSpace(*profile)
+	}
+
+	newSettings := ConfigSettings{Dns: cert.Dns, Mtu: cert.Mtu, Keepalive: cert.Keepalive}
+	if settings != nil {
+		newSettings, err = normalizeSettings(*settings)
+		if err != nil {
+			return ClientResponse{}, err
+		}
+	}
+
+	ipList, err := u.configRoutes(cert.Ifname, newProfile, newAllowedIp)
 	if err != nil {
-		log.Printf("NewClient %v", err)
+		log.Printf("UpdateClient %v", err)
 		return ClientResponse{}, err
 	}
+	config := u.createConfig(cert.Private, newIp, servData.Public, ipList, servData.Endpoint, servData.Port, cert.PresharedKey,
+		configSettings(servData, newSettings.Dns, newSettings.Mtu, newSettings.Keepalive))
 
-	config := u.createConfig(privateKey.String(), ip, servData.Public, ipList, servData.Endpoint, servData.Port)
-	err = u.ClientRepo.CreateClientCert(&db.ClientCert{
-		Ifname:     ifname,
-		Private:    privateKey.String(),
-		Public:     publicKey.String(),
-		IP:         ip,
-		AllowedIPs: normalAlloweIp,
-		Config:     config,
+	newMeta := clientMeta(cert.Name, cert.Owner, cert.Email, cert.Description, cert.Tags)
+	if meta != nil {
+		newMeta = normalizeMeta(*meta)
+	}
+
+	// peer is updated before commit, error of device rolls back the whole update
+	err = u.ClientRepo.UpdateClientCert(public, db.ClientCert{
+		IP:          newIp,
+		AllowedIPs:  newAllowedIp,
+		Profile:     newProfile,
+		Dns:         newSettings.Dns,
+		Mtu:         newSettings.Mtu,
+		Keepalive:   newSettings.Keepalive,
+		Config:      config,
+		Name:        newMeta.Name,
+		Owner:       newMeta.Owner,
+		Email:       newMeta.Email,
+		Description: newMeta.Description,
+		Tags:        strings.Join(newMeta.Tags, ","),
+	}, meta != nil, func() error {
+		if cert.Disabled {
+			return nil
+		}
+		return u.setClient(cert.Ifname, newIp, newAllowedIp, public, cert.PresharedKey)
 	})
 	if err != nil {
-		log.Printf("NewClient %v", err)
+		log.Printf("UpdateClient %v", err)
 		return ClientResponse{}, err
 	}
+	u.syncWgQuick(cert.Ifname)
+	if oldIp := pingIp(cert.IP); oldIp != "" && oldIp != pingIp(newIp) {
+		u.PingStatus.Delete(oldIp)
+	}
+
+	return ClientResponse{
+		ClientMeta:     newMeta,
+		ConfigSettings: newSettings,
+		Ifname:         cert.Ifname,
+		Private:        cert.Private,
+		Public:         cert.Public,
+		Ip:             newIp,
+		AllowedIPs:     newAllowedIp,
+		Profile:        newProfile,
+		Config:         config,
+		PresharedKey:   cert.PresharedKey,
+		Disabled:       cert.Disabled,
+		ExpiresAt:      cert.ExpiresAt,
+	}, nil
+}
 
-	err = u.setClient(ifname, ip, normalAlloweIp, publicKey.String())
+func (u *Usecases) RotateClient(public string) (ClientResponse, error) {
+	public = strings.TrimSpace(public)
+	// peer is changed before commit, reconcile must not see the device and old row meanwhile
+	u.allocMu.Lock()
+	defer u.allocMu.Unlock()
+
+	cert, err := u.ClientRepo.GetClientByPublic(public)
 	if err != nil {
-		log.Printf("NewClient %v", err)
+		log.Printf("RotateClient %v", err)
+		return ClientResponse{}, err
+	}
+	if cert.Private == "" {
+		return ClientResponse{}, fmt.Errorf("client %s keeps its own private key, create new client with new public key instead", public)
+	}
+	servData, err := u.ClientRepo.GetPublicEnpointPort(cert.Ifname)
+	if err != nil {
+		log.Printf("RotateClient %v", err)
 		return ClientResponse{}, err
 	}
 
-	return ClientResponse{Ifname: ifname, Private: privateKey.String(), Public: publicKey.String(), Config: config, Ip: ip, AllowedIPs: normalAlloweIp}, nil
-
-}
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		log.Printf("RotateClient %v", err)
+		return ClientResponse{}, err
+	}
+	publicKey := privateKey.PublicKey()
+	presharedKey := ""
+	if cert.PresharedKey != "" {
+		key, err := wgtypes.GenerateKey()
+		if err != nil {
+			log.Printf("RotateClient %v", err)
+			return ClientResponse{}, err
+		}
+		presharedKey = key.String()
+	}
 
-func (u *Usecases) getInterfaceSubnet(interfaceName string) (*net.IPNet, error) {
-	iface, err := net.InterfaceByName(interfaceName)
+	ipList, err := u.configRoutes(cert.Ifname, cert.Profile, cert.AllowedIPs)
+	if err != nil {
+		log.Printf("RotateClient %v", err)
+		return ClientResponse{}, err
+	}
+	config := u.createConfig(privateKey.String(), cert.IP, servData.Public, ipList, servData.Endpoint, servData.Port, presharedKey,
+		configSettings(servData, cert.Dns, cert.Mtu, cert.Keepalive))
 
+	newPeer, err := u.peerConfig(cert.IP, cert.AllowedIPs, publicKey.String(), presharedKey)
 	if err != nil {
-		log.Printf("getInterfaceSubnet %v", err)
-		return nil, fmt.Errorf("did not find interface %s: %w", interfaceName, err)
+		log.Printf("RotateClient %v", err)
+		return ClientResponse{}, err
 	}
-	addrs, err := iface.Addrs()
+	oldKey, err := wgtypes.ParseKey(cert.Public)
 	if err != nil {
-		log.Printf("getInterfaceSubnet %v", err)
-		return nil, fmt.Errorf("cannnot get address %s: %w", interfaceName, err)
+		log.Printf("RotateClient %v", err)
+		return ClientResponse{}, err
 	}
-	for _, addr := range addrs {
-		if ipNet, ok := addr.(*net.IPNet); ok {
-			if ipNet.IP.To4() != nil {
-				return ipNet, nil
+
+	// peers are swapped before commit, error of device rolls back the new keys
+	_, err = u.ClientRepo.RotateClientCert(public, publicKey.String(), privateKey.String(), presharedKey, config, func() error {
+		if cert.Disabled {
+			return nil
+		}
+		client, err := wgctrl.New()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		// old peer is removed and new one is added by one device update
+		return client.ConfigureDevice(cert.Ifname, wgtypes.Config{
+			Peers: []wgtypes.PeerConfig{{PublicKey: oldKey, Remove: true}, newPeer},
+		})
+	})
+	if err != nil {
+		log.Printf("RotateClient %v", err)
+		return ClientResponse{}, err
+	}
+	u.syncWgQuick(cert.Ifname)
+
+	return ClientResponse{
+		ClientMeta:     clientMeta(cert.Name, cert.Owner, cert.Email, cert.Description, cert.Tags),
+		ConfigSettings: ConfigSettings{Dns: cert.Dns, Mtu: cert.Mtu, Keepalive: cert.Keepalive},
+		Ifname:         cert.Ifname,
+		Private:        privateKey.String(),
+		Public:         publicKey.String(),
+		Ip:             cert.IP,
+		AllowedIPs:     cert.AllowedIPs,
+		Profile:        cert.Profile,
+		Config:         config,
+		PresharedKey:   presharedKey,
+		Disabled:       cert.Disabled,
+		ExpiresAt:      cert.ExpiresAt,
+	}, nil
+}
+
+// normalizeMeta trims metadata of client and removes empty and repeated tags.
+func normalizeMeta(meta ClientMeta) ClientMeta {
+	meta.Name = strings.TrimSpace(meta.Name)
+	meta.Owner = strings.TrimSpace(meta.Owner)
+	meta.Email = strings.TrimSpace(meta.Email)
+	meta.Description = strings.TrimSpace(meta.Description)
+	tags := []string{}
+	seen := make(map[string]struct{})
+	for _, tag := range meta.Tags {
+		for _, v := range splitIps(tag) {
+			if _, ok := seen[v]; !ok {
+				seen[v] = struct{}{}
+				tags = append(tags, v)
 			}
 		}
 	}
-	return nil, fmt.Errorf("subnet %s not found", interfaceName)
+	meta.Tags = tags
+	return meta
 }
 
-func (u *Usecases) generateIPs(ifname, ipmask, serverIp string) (string, error) {
-	prefix, err := netaddr.ParseIPPrefix(ipmask)
-	if err != nil {
-		log.Printf("generateIPs %v", err)
-		return "", fmt.Errorf("invalid CIDR format: %v", err)
+func clientMeta(name, owner, email, description, tags string) ClientMeta {
+	list := splitIps(tags)
+	if list == nil {
+		list = []string{}
 	}
-	_, networkIp, err := net.ParseCIDR(ipmask)
+	return ClientMeta{Name: name, Owner: owner, Email: email, Description: description, Tags: list}
+}
+
+// mergeFamilies keeps addresses of the current list for the families which are not set in ip.
+func mergeFamilies(ip, current string) (string, error) {
+	ip4, ip6, err := splitFamilies(ip)
 	if err != nil {
-		log.Printf("generateIPs %v", err)
-		return "", fmt.Errorf("invalid CIDR format: %v", err)
+		return "", err
 	}
-
-	listIp, err := u.ClientRepo.GetListIp(ifname)
+	cur4, cur6, err := splitFamilies(current)
 	if err != nil {
 		return "", err
 	}
-	ipSet := make(map[string]struct{})
-	for _, ip := range listIp {
-		ipSet[ip] = struct{}{}
+	if ip4 == "" {
+		ip4 = cur4
+	}
+	if ip6 == "" {
+		ip6 = cur6
 	}
+	return joinIps(ip4, ip6), nil
+}
+
+// splitIps splits a comma separated address list and drops empty entries.
+func splitIps(ips string) []string {
+	var list []string
+	for _, v := range strings.Split(ips, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// joinIps joins the non-empty addresses into the comma separated form stored in the database.
+func joinIps(ips ...string) string {
+	var list []string
+	for _, v := range ips {
+		if v != "" {
+			list = append(list, v)
+		}
+	}
+	return strings.Join(list, ",")
+}
 
-	ipSet[networkIp.String()] = struct{}{}
-	ipSet[serverIp] = struct{}{}
-	ipRange := prefix.Range()
-	for ip := ipRange.From(); prefix.Contains(ip); ip = ip.Next() {
-		newIp := fmt.Sprintf("%s/%d", ip.String(), prefix.Bits())
-		if _, exists := ipSet[newIp]; !exists {
-			return newIp, nil
+// splitFamilies splits a comma separated CIDR list into at most one IPv4 and one IPv6 address.
+func splitFamilies(ips string) (string, string, error) {
+	var ip4, ip6 string
+	for _, v := range splitIps(ips) {
+		ip, _, err := net.ParseCIDR(v)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid CIDR format: %v", err)
+		}
+		if ip.To4() != nil {
+			if ip4 != "" {
+				return "", "", fmt.Errorf("only one IPv4 address allowed in %s", ips)
+			}
+			ip4 = v
+		} else {
+			if ip6 != "" {
+				return "", "", fmt.Errorf("only one IPv6 address allowed in %s", ips)
+			}
+			ip6 = v
 		}
 	}
+	return ip4, ip6, nil
+}
 
-	return "", fmt.Errorf("cannot find free ip for interface %s subnet %s", ifname, networkIp)
+// pingIp returns the IPv4 address of a client without mask, the ping service works only with IPv4.
+func pingIp(ips string) string {
+	for _, v := range splitIps(ips) {
+		ip, _, err := net.ParseCIDR(v)
+		if err == nil && ip.To4() != nil {
+			return ip.String()
+		}
+	}
+	return ""
 }
 
-func (u *Usecases) createConfig(private, ip, public, allowedIp, endpoint string, port int) string {
-	endpoint = fmt.Sprintf("%s:%d", endpoint, port)
+func (u *Usecases) getInterfaceSubnets(interfaceName string) ([]*net.IPNet, error) {
+	iface, err := net.InterfaceByName(interfaceName)
+
+	if err != nil {
+		log.Printf("getInterfaceSubnets %v", err)
+		return nil, fmt.Errorf("did not find interface %s: %w", interfaceName, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		log.Printf("getInterfaceSubnets %v", err)
+		return nil, fmt.Errorf("cannnot get address %s: %w", interfaceName, err)
+	}
+	var subnets []*net.IPNet
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			if ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			subnets = append(subnets, ipNet)
+		}
+	}
+	if len(subnets) == 0 {
+		return nil, fmt.Errorf("subnet %s not found", interfaceName)
+	}
+	return subnets, nil
+}
+
+// serverSubnets returns subnets of interface from its addresses in database, the same as
+// getInterfaceSubnets returns for the running device, so configs of stopped interface can be made.
+func serverSubnets(serverIp string) ([]*net.IPNet, error) {
+	var subnets []*net.IPNet
+	for _, v := range splitIps(serverIp) {
+		ip, subnet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR format: %v", err)
+		}
+		subnets = append(subnets, &net.IPNet{IP: ip, Mask: subnet.Mask})
+	}
+	if len(subnets) == 0 {
+		return nil, fmt.Errorf("interface has no address")
+	}
+	return subnets, nil
+}
+
+func (u *Usecases) createConfig(private, ip, public, allowedIp, endpoint string, port int, presharedKey string, settings ConfigSettings) string {
+	if private == "" {
+		private = PrivateKeyPlaceholder
+	}
+	keepalive := DefaultKeepalive
+	if settings.Keepalive != nil {
+		keepalive = *settings.Keepalive
+	}
+	// IPv6 endpoint is put in brackets before port
+	endpoint = net.JoinHostPort(strings.Trim(endpoint, "[]"), strconv.Itoa(port))
 	var builder strings.Builder
 	builder.WriteString("[Interface]\n")
 	builder.WriteString(fmt.Sprintf("PrivateKey = %s\n", private))
 	builder.WriteString(fmt.Sprintf("Address = %s\n", ip))
+	if settings.Dns != "" {
+		builder.WriteString(fmt.Sprintf("DNS = %s\n", strings.Join(splitIps(settings.Dns), ", ")))
+	}
+	if settings.Mtu > 0 {
+		builder.WriteString(fmt.Sprintf("MTU = %d\n", settings.Mtu))
+	}
 	builder.WriteString("[Peer]\n")
 	builder.WriteString(fmt.Sprintf("PublicKey = %s\n", public))
+	if presharedKey != "" {
+		builder.WriteString(fmt.Sprintf("PresharedKey = %s\n", presharedKey))
+	}
 	builder.WriteString(fmt.Sprintf("AllowedIPs = %s\n", allowedIp))
 	builder.WriteString(fmt.Sprintf("Endpoint = %s\n", endpoint))
-	builder.WriteString("PersistentKeepalive = 20\n")
+	if keepalive > 0 {
+		builder.WriteString(fmt.Sprintf("PersistentKeepalive = %d\n", keepalive))
+	}
 	return builder.String()
 }
 
-func (u *Usecases) containsIp(allowedIp, ifname string) ([]net.IPNet, string, error) {
-	interfaceSubnet, err := u.getInterfaceSubnet(ifname)
+// configSettings returns settings of client config, settings of client override settings of interface.
+func configSettings(serv db.ServerCert, dns string, mtu int, keepalive *int) ConfigSettings {
+	settings := ConfigSettings{Dns: serv.Dns, Mtu: serv.Mtu, Keepalive: serv.Keepalive}
+	if dns != "" {
+		settings.Dns = dns
+	}
+	if mtu != 0 {
+		settings.Mtu = mtu
+	}
+	if keepalive != nil {
+		settings.Keepalive = keepalive
+	}
+	return settings
+}
+
+var dnsName = regexp.MustCompile(`^[A-Za-z0-9.:_-]+$`)
+
+// normalizeSettings checks DNS servers, MTU and keepalive, DNS servers are returned comma separated.
+// DNS entries which are not addresses are search domains of wg-quick.
+func normalizeSettings(settings ConfigSettings) (ConfigSettings, error) {
+	var dns []string
+	for _, v := range strings.FieldsFunc(settings.Dns, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if !dnsName.MatchString(v) {
+			return ConfigSettings{}, fmt.Errorf("bad DNS server %q", v)
+		}
+		dns = append(dns, v)
+	}
+	settings.Dns = strings.Join(dns, ",")
+	if settings.Mtu != 0 && (settings.Mtu < 576 || settings.Mtu > 65535) {
+		return ConfigSettings{}, fmt.Errorf("MTU %d is out of range 576-65535", settings.Mtu)
+	}
+	if settings.Keepalive != nil && (*settings.Keepalive < 0 || *settings.Keepalive > 65535) {
+		return ConfigSettings{}, fmt.Errorf("keepalive %d is out of range 0-65535", *settings.Keepalive)
+	}
+	return settings, nil
+}
+
+// renderConfig returns function which makes config of client of serv with routes of profiles,
+// it reads nothing from database and is used when configs are made inside transaction.
+// Subnets are taken from serv, so interface does not have to be running.
+func (u *Usecases) renderConfig(serv db.ServerCert, profiles map[string]string) func(cert db.ClientCert) (string, error) {
+	subnets, subnetErr := serverSubnets(serv.Ip)
+	return func(cert db.ClientCert) (string, error) {
+		if subnetErr != nil {
+			return "", fmt.Errorf("interface %s: %w", serv.Ifname, subnetErr)
+		}
+		_, ipList, err := mergeRoutes(subnets, joinIps(profiles[cert.Profile], cert.AllowedIPs))
+		if err != nil {
+			return "", err
+		}
+		return u.createConfig(cert.Private, cert.IP, serv.Public, ipList, serv.Endpoint, serv.Port, cert.PresharedKey,
+			configSettings(serv, cert.Dns, cert.Mtu, cert.Keepalive)), nil
+	}
+}
+
+// profileRoutes returns routes of all routing profiles by name.
+func (u *Usecases) profileRoutes() (map[string]string, error) {
+	profiles, err := u.ClientRepo.GetProfiles()
 	if err != nil {
-		log.Printf("createConfig %v", err)
-		return nil, "", err
+		return nil, err
+	}
+	routes := make(map[string]string, len(profiles))
+	for _, v := range profiles {
+		routes[v.Name] = v.Routes
 	}
+	return routes, nil
+}
 
-	_, subnetInt, err := net.ParseCIDR(interfaceSubnet.String())
+func (u *Usecases) containsIp(allowedIp, ifname string) ([]net.IPNet, string, error) {
+	interfaceSubnets, err := u.getInterfaceSubnets(ifname)
 	if err != nil {
+		log.Printf("createConfig %v", err)
 		return nil, "", err
 	}
+	return mergeRoutes(interfaceSubnets, allowedIp)
+}
 
+// mergeRoutes returns subnets of interface and subnets of allowedIp without repeats,
+// sorted so the same routes always give the same config.
+func mergeRoutes(interfaceSubnets []*net.IPNet, allowedIp string) ([]net.IPNet, string, error) {
 	mapIP := make(map[string]net.IPNet)
-	mapIP[subnetInt.String()] = *subnetInt
+	var has4, has6 bool
+	for _, interfaceSubnet := range interfaceSubnets {
+		_, subnetInt, err := net.ParseCIDR(interfaceSubnet.String())
+		if err != nil {
+			return nil, "", err
+		}
+		mapIP[subnetInt.String()] = *subnetInt
+		if subnetInt.IP.To4() != nil {
+			has4 = true
+		} else {
+			has6 = true
+		}
+	}
 
 	allowedIpRaw := strings.Split(allowedIp, ",")
 	for i := range allowedIpRaw {
@@ -189,39 +817,90 @@ func (u *Usecases) containsIp(allowedIp, ifname string) ([]net.IPNet, string, er
 		mapIP[subnet.String()] = *subnet
 	}
 
+	// on dual-stack interface the default route is set for both families,
+	// otherwise traffic of the other family leaks outside the tunnel
+	_, default4, _ := net.ParseCIDR("0.0.0.0/0")
+	_, default6, _ := net.ParseCIDR("::/0")
+	_, full4 := mapIP[default4.String()]
+	_, full6 := mapIP[default6.String()]
+	if (full4 || full6) && has4 && has6 {
+		mapIP[default4.String()] = *default4
+		mapIP[default6.String()] = *default6
+	}
+
 	var arrayModify []net.IPNet
 	var stringModify []string
-	for sub, valueNet := range mapIP {
-		arrayModify = append(arrayModify, valueNet)
+	for sub := range mapIP {
 		stringModify = append(stringModify, sub)
 	}
+	sort.Strings(stringModify)
+	for _, sub := range stringModify {
+		arrayModify = append(arrayModify, mapIP[sub])
+	}
 
 	return arrayModify, strings.Join(stringModify, ","), nil
 }
 
-func (u *Usecases) setClient(ifname string, ipClient, allowedIp, publicKey string) error {
+// configRoutes returns AllowedIPs of client config: subnets of interface, routes of profile
+// and own routes of client. Profile routes are not added to the peer on the server.
+func (u *Usecases) configRoutes(ifname, profile, allowedIp string) (string, error) {
+	routes := allowedIp
+	if profile != "" {
+		p, err := u.ClientRepo.GetProfileByName(profile)
+		if err != nil {
+			return "", fmt.Errorf("routing profile %s: %w", profile, err)
+		}
+		routes = joinIps(p.Routes, allowedIp)
+	}
+	_, ipList, err := u.containsIp(routes, ifname)
+	return ipList, err
+}
+
+func (u *Usecases) setClient(ifname string, ipClient, allowedIp, publicKey, presharedKey string) error {
 	client, err := wgctrl.New()
 	if err != nil {
 		return err
 	}
 	defer client.Close()
 
-	decodedKey, err := base64.StdEncoding.DecodeString(publicKey)
+	peer, err := u.peerConfig(ipClient, allowedIp, publicKey, presharedKey)
 	if err != nil {
-		log.Printf("setClient %v", err)
 		return err
 	}
 
-	ip, clientSubnet, err := net.ParseCIDR(ipClient)
+	err = client.ConfigureDevice(ifname, wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{peer},
+	})
 	if err != nil {
-		log.Printf("setClient %v", err)
 		return err
 	}
-	clientSubnet.IP = ip
-	clientSubnet.Mask = net.CIDRMask(32, 32)
+
+	return nil
+}
+
+func (u *Usecases) peerConfig(ipClient, allowedIp, publicKey, presharedKey string) (wgtypes.PeerConfig, error) {
+	decodedKey, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		log.Printf("setClient %v", err)
+		return wgtypes.PeerConfig{}, err
+	}
 
 	var arraNetIpNet []net.IPNet
-	arraNetIpNet = append(arraNetIpNet, *clientSubnet)
+	var clientIps []net.IP
+	for _, v := range splitIps(ipClient) {
+		ip, _, err := net.ParseCIDR(v)
+		if err != nil {
+			log.Printf("setClient %v", err)
+			return wgtypes.PeerConfig{}, err
+		}
+		bits := net.IPv6len * 8
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = net.IPv4len * 8
+		}
+		clientIps = append(clientIps, ip)
+		arraNetIpNet = append(arraNetIpNet, net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
 
 	allowedIp = strings.TrimSpace(allowedIp)
 	allowedIps := strings.Split(allowedIp, ",")
@@ -233,7 +912,13 @@ func (u *Usecases) setClient(ifname string, ipClient, allowedIp, publicKey strin
 					log.Printf("setClient %v", err)
 					continue
 				}
-				if !sub.Contains(ip.To4()) {
+				containsClient := false
+				for _, ip := range clientIps {
+					if sub.Contains(ip) {
+						containsClient = true
+					}
+				}
+				if !containsClient {
 					o, b := sub.Mask.Size()
 					sub.Mask = net.CIDRMask(o, b)
 					arraNetIpNet = append(arraNetIpNet, *sub)
@@ -250,28 +935,28 @@ func (u *Usecases) setClient(ifname string, ipClient, allowedIp, publicKey strin
 		AllowedIPs:        arraNetIpNet,
 		ReplaceAllowedIPs: true,
 	}
-
-	err = client.ConfigureDevice(ifname, wgtypes.Config{
-		Peers: []wgtypes.PeerConfig{peer},
-	})
-	if err != nil {
-		return err
+	if presharedKey != "" {
+		psk, err := wgtypes.ParseKey(presharedKey)
+		if err != nil {
+			log.Printf("setClient %v", err)
+			return wgtypes.PeerConfig{}, err
+		}
+		peer.PresharedKey = &psk
 	}
 
-	return nil
+	return peer, nil
 }
 
 func (u *Usecases) checkIpMask(ifname, ip string) error {
-	var clientIp net.IP
-	var networkIp *net.IPNet
-	var err error
+	var clientIps []string
 
 	if ip != "" {
-		clientIp, networkIp, err = net.ParseCIDR(ip)
+		ip4, ip6, err := splitFamilies(ip)
 		if err != nil {
 			log.Printf("checkIpMask %v", err)
-			return fmt.Errorf("invalid CIDR format: %v", err)
+			return err
 		}
+		clientIps = splitIps(joinIps(ip4, ip6))
 	}
 
 	interfaces, err := net.Interfaces()
@@ -282,39 +967,54 @@ func (u *Usecases) checkIpMask(ifname, ip string) error {
 
 	for _, iface := range interfaces {
 		if iface.Name == ifname {
-			if ip != "" {
-				addrs, err := iface.Addrs()
-				if err != nil {
-					log.Printf("checkIpMask %v", err)
-					return fmt.Errorf("error getting addresses for interface %s: %v", ifname, err)
-				}
-				for _, addr := range addrs {
-					ipAddr, _, err := net.ParseCIDR(addr.String())
-					if err != nil {
-						log.Printf("checkIpMask %v", err)
-						return fmt.Errorf("error parsing address %s: %v", addr.String(), err)
-					}
-					if ipAddr.To4() != nil {
-						addr, ipNet, _ := net.ParseCIDR(addr.String())
-
-						if networkIp.String() != ipNet.String() {
-							return fmt.Errorf("incorrect subnet your ip %s and interface %s", networkIp.String(), ipNet.String())
-						}
-						if clientIp.String() == addr.String() {
-
-							return fmt.Errorf("ip %s cannot be same as interface %s", clientIp.String(), ipNet.IP.String())
-						}
-					}
-
-				}
+			if len(clientIps) == 0 {
+				return nil
 			}
-			return nil
+			addrs, err := iface.Addrs()
+			if err != nil {
+				log.Printf("checkIpMask %v", err)
+				return fmt.Errorf("error getting addresses for interface %s: %v", ifname, err)
+			}
+			return checkIpSubnets(ifname, addrs, clientIps)
 		}
 	}
 	return fmt.Errorf("interface %s not found", ifname)
 
 }
 
+// checkIpSubnets checks that every address of clientIps is inside the subnet of its family
+// among addrs of interface and is not the address of interface itself.
+func checkIpSubnets(ifname string, addrs []net.Addr, clientIps []string) error {
+	for _, v := range clientIps {
+		clientIp, networkIp, err := net.ParseCIDR(v)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR format: %v", err)
+		}
+		found := false
+		for _, addr := range addrs {
+			ipAddr, ipNet, err := net.ParseCIDR(addr.String())
+			if err != nil {
+				log.Printf("checkIpMask %v", err)
+				return fmt.Errorf("error parsing address %s: %v", addr.String(), err)
+			}
+			if ipAddr.IsLinkLocalUnicast() || (ipAddr.To4() != nil) != (clientIp.To4() != nil) {
+				continue
+			}
+			found = true
+			if networkIp.String() != ipNet.String() {
+				return fmt.Errorf("incorrect subnet your ip %s and interface %s", networkIp.String(), ipNet.String())
+			}
+			if clientIp.Equal(ipAddr) {
+				return fmt.Errorf("ip %s cannot be same as interface %s", clientIp.String(), ipNet.IP.String())
+			}
+		}
+		if !found {
+			return fmt.Errorf("interface %s has no subnet for ip %s", ifname, v)
+		}
+	}
+	return nil
+}
+
 func (u *Usecases) GetStatus() ([]InterfaceListStatus, error) {
 	client, err := wgctrl.New()
 	if err != nil {
@@ -365,21 +1065,134 @@ func (u *Usecases) GetStatus() ([]InterfaceListStatus, error) {
 	return ifnameStatus, nil
 }
 
-func (u *Usecases) GetAllClients() ([]ClientResponse, error) {
-	allClients, err := u.ClientRepo.GetAllClient()
+// sort keys and fields of client list with columns they are read from
+var (
+	clientSorts = map[string]string{
+		"ip":        "ip_sort",
+		"created":   "created_at",
+		"handshake": "last_handshake",
+	}
+	clientFields = map[string][]string{
+		"name":           {"name"},
+		"owner":          {"owner"},
+		"email":          {"email"},
+		"description":    {"description"},
+		"tags":           {"tags"},
+		"ifname":         {"ifname"},
+		"private":        {"private"},
+		"public":         {"public"},
+		"ip":             {"ip"},
+		"alloweip":       {"allowed_ips"},
+		"profile":        {"profile"},
+		"dns":            {"dns"},
+		"mtu":            {"mtu"},
+		"keepalive":      {"keepalive"},
+		"config":         {"config"},
+		"preshared_key":  {"preshared_key"},
+		"disabled":       {"disabled"},
+		"expires_at":     {"expires_at"},
+		"quota":          {"quota", "quota_period", "quota_exceeded", "usage_rx", "usage_tx"},
+		"ping_status":    {"ip"},
+		"created_at":     {"created_at"},
+		"last_handshake": {"last_handshake"},
+	}
+	archiveSorts = map[string]string{
+		"ip":      "ip_sort",
+		"created": "created_at",
+		"deleted": "deleted_at",
+	}
+	archiveFields = map[string][]string{
+		"name":          {"name"},
+		"owner":         {"owner"},
+		"email":         {"email"},
+		"description":   {"description"},
+		"tags":          {"tags"},
+		"ifname":        {"ifname"},
+		"private":       {"private"},
+		"public":        {"public"},
+		"ip":            {"ip"},
+		"alloweip":      {"allowed_ips"},
+		"profile":       {"profile"},
+		"dns":           {"dns"},
+		"mtu":           {"mtu"},
+		"keepalive":     {"keepalive"},
+		"config":        {"config"},
+		"preshared_key": {"preshared_key"},
+		"expires_at":    {"expires_at"},
+		"reason":        {"reason"},
+		"created_at":    {"created_at"},
+		"deleted_at":    {"deleted_at"},
+		"archive_id":    {"id"},
+	}
+)
+
+// DefaultClientFields are fields of client list returned when fields are not requested,
+// private key and config are returned only on request
+var DefaultClientFields = []string{
+	"name", "owner", "email", "description", "tags", "ifname", "public", "ip", "alloweip", "profile",
+	"dns", "mtu", "keepalive", "preshared_key", "disabled", "expires_at", "quota", "ping_status",
+	"created_at", "last_handshake",
+}
+
+// DefaultClientArchiveFields are fields of client archive returned when fields are not requested,
+// private key and config, which stay valid for rotated keys, are returned only on request
+var DefaultClientArchiveFields = []string{
+	"name", "owner", "email", "description", "tags", "ifname", "public", "ip", "alloweip", "profile",
+	"dns", "mtu", "keepalive", "preshared_key", "expires_at", "reason", "created_at", "deleted_at", "archive_id",
+}
+
+// listPage checks sort and fields of opts and returns page with column names
+func listPage(opts ListOptions, sorts map[string]string, fields map[string][]string) (db.Page, error) {
+	if opts.Limit < 0 || opts.Offset < 0 {
+		return db.Page{}, fmt.Errorf("limit and offset can not be negative")
+	}
+	page := db.Page{Limit: opts.Limit, Offset: opts.Offset}
+	if opts.Sort != "" {
+		sort := strings.TrimPrefix(opts.Sort, "-")
+		column, ok := sorts[sort]
+		if !ok {
+			return db.Page{}, fmt.Errorf("can not sort by %s", sort)
+		}
+		page.Sort = column
+		page.Desc = strings.HasPrefix(opts.Sort, "-")
+	}
+	seen := make(map[string]struct{})
+	for _, field := range opts.Fields {
+		columns, ok := fields[field]
+		if !ok {
+			return db.Page{}, fmt.Errorf("unknown field %s", field)
+		}
+		for _, column := range columns {
+			if _, ok := seen[column]; !ok {
+				seen[column] = struct{}{}
+				page.Columns = append(page.Columns, column)
+			}
+		}
+	}
+	return page, nil
+}
+
+func (u *Usecases) GetAllClients(owner, tag string, opts ListOptions) ([]ClientResponse, int64, error) {
+	if len(opts.Fields) == 0 {
+		opts.Fields = DefaultClientFields
+	}
+	page, err := listPage(opts, clientSorts, clientFields)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	allClients, total, err := u.ClientRepo.FindClients(strings.TrimSpace(owner), strings.TrimSpace(tag), page)
+	if err != nil {
+		return nil, 0, err
 	}
 	if len(allClients) == 0 {
-		return []ClientResponse{}, nil
+		return []ClientResponse{}, total, nil
 	}
 	var clientList []ClientResponse
 	for _, v := range allClients {
 		var tStatus bool
 		var pTime int64
-		ipData := strings.Split(v.IP, "/")
-		if len(ipData) > 1 {
-			status, pingTime := u.PingStatus.Read(ipData[0])
+		if ip := pingIp(v.IP); ip != "" {
+			status, pingTime := u.PingStatus.Read(ip)
 			pTime = pingTime.Microseconds()
 			tStatus = status
 		} else {
@@ -388,36 +1201,238 @@ func (u *Usecases) GetAllClients() ([]ClientResponse, error) {
 		}
 
 		clientList = append(clientList, ClientResponse{
-			Ifname:     v.Ifname,
-			Private:    v.Private,
-			Public:     v.Public,
-			Ip:         v.IP,
-			AllowedIPs: v.AllowedIPs,
-			Config:     v.Config,
+			ClientMeta:     clientMeta(v.Name, v.Owner, v.Email, v.Description, v.Tags),
+			ConfigSettings: ConfigSettings{Dns: v.Dns, Mtu: v.Mtu, Keepalive: v.Keepalive},
+			Ifname:         v.Ifname,
+			Private:        v.Private,
+			Public:         v.Public,
+			Ip:             v.IP,
+			AllowedIPs:     v.AllowedIPs,
+			Profile:        v.Profile,
+			Config:         v.Config,
+			PresharedKey:   v.PresharedKey,
+			Disabled:       v.Disabled,
+			ExpiresAt:      v.ExpiresAt,
+			Quota: &ClientQuota{
+				Quota:    v.Quota,
+				Period:   v.QuotaPeriod,
+				Exceeded: v.QuotaExceeded,
+				UsageRx:  v.UsageRx,
+				UsageTx:  v.UsageTx,
+			},
 			PingStatus: ClientResponsePing{
 				Status:   tStatus,
 				PintTime: pTime,
 			},
+			CreatedAt:     timeOf(v.CreatedAt),
+			LastHandshake: v.LastHandshake,
 		})
 	}
-	return clientList, nil
+	return clientList, total, nil
+}
+
+// timeOf returns nil for zero time, it is not selected from database
+func timeOf(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
 }
 
 func (u *Usecases) DeleteClient(public string) error {
-	public = strings.TrimSpace(public)
-	cert, err := u.ClientRepo.DeleteClientCert(public)
+	return u.deleteClient(strings.TrimSpace(public), db.ReasonDeleted)
+}
+
+func (u *Usecases) deleteClient(public, reason string) error {
+	cert, err := u.ClientRepo.DeleteClientCert(public, reason)
 	if err != nil {
 		log.Printf("DeleteClient %v", err)
 		return err
 	}
-	client, err := wgctrl.New()
+	if cert.Public == "" {
+		return fmt.Errorf("client %s not found", public)
+	}
+	defer u.syncWgQuick(cert.Ifname)
+	err = u.removePeer(cert.Ifname, cert.Public)
 	if err != nil {
 		log.Printf("DeleteClient %v", err)
+		return err
+	}
+	if ip := pingIp(cert.IP); ip != "" {
+		u.PingStatus.Delete(ip)
+	}
+
+	return nil
+
+}
+
+func (u *Usecases) DisableClient(public string) error {
+	public = strings.TrimSpace(public)
+	cert, err := u.ClientRepo.SetClientDisabled(public, true)
+	if err != nil {
+		log.Printf("DisableClient %v", err)
+		return err
+	}
+	defer u.syncWgQuick(cert.Ifname)
+	err = u.removePeer(cert.Ifname, cert.Public)
+	if err != nil {
+		log.Printf("DisableClient %v", err)
+		return err
+	}
+	if ip := pingIp(cert.IP); ip != "" {
+		u.PingStatus.Delete(ip)
+	}
+	return nil
+}
+
+func (u *Usecases) EnableClient(public string) error {
+	public = strings.TrimSpace(public)
+	cert, err := u.ClientRepo.SetClientDisabled(public, false)
+	if err != nil {
+		log.Printf("EnableClient %v", err)
+		return err
+	}
+	defer u.syncWgQuick(cert.Ifname)
+	err = u.setClient(cert.Ifname, cert.IP, cert.AllowedIPs, cert.Public, cert.PresharedKey)
+	if err != nil {
+		log.Printf("EnableClient %v", err)
+		return err
+	}
+	return nil
+}
+
+func (u *Usecases) SetClientQuota(public string, quota int64, period string) error {
+	public = strings.TrimSpace(public)
+	if quota < 0 {
+		return fmt.Errorf("quota cannot be negative")
+	}
+	if period != "" && period != db.QuotaMonthly {
+		return fmt.Errorf("unknown quota period %s", period)
+	}
+	cert, err := u.ClientRepo.SetClientQuota(public, quota, period)
+	if err != nil {
+		log.Printf("SetClientQuota %v", err)
+		return err
+	}
+	if cert.QuotaExceeded && (quota == 0 || cert.UsageRx+cert.UsageTx < quota) {
+		changed, err := u.ClientRepo.SetClientQuotaExceeded(cert.ID, false)
+		if err != nil {
+			log.Printf("SetClientQuota %v", err)
+			return err
+		}
+		if !changed {
+			return nil
+		}
+		defer u.syncWgQuick(cert.Ifname)
+		err = u.setClient(cert.Ifname, cert.IP, cert.AllowedIPs, cert.Public, cert.PresharedKey)
+		if err != nil {
+			log.Printf("SetClientQuota %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// accountUsage adds traffic of device counters to usage of clients and
+// disables clients which exceeded their quota.
+func (u *Usecases) accountUsage(now time.Time) error {
+	client, err := wgctrl.New()
+	if err != nil {
+		return err
 	}
 	defer client.Close()
-	peerPubKey, err := wgtypes.ParseKey(cert.Public)
+	devices, err := client.Devices()
 	if err != nil {
-		log.Printf("DeleteClient %v", err)
+		return err
+	}
+	counters := make(map[string]wgtypes.Peer)
+	for _, device := range devices {
+		for _, peer := range device.Peers {
+			counters[device.Name+"/"+peer.PublicKey.String()] = peer
+		}
+	}
+
+	clients, err := u.ClientRepo.GetAllClient()
+	if err != nil {
+		return err
+	}
+	periodStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	for _, cert := range clients {
+		enable := false
+		if cert.UsagePeriodStart == nil || (cert.QuotaPeriod == db.QuotaMonthly && cert.UsagePeriodStart.Before(periodStart)) {
+			if cert.UsagePeriodStart != nil {
+				cert.UsageRx, cert.UsageTx = 0, 0
+				enable = cert.QuotaExceeded
+			}
+			cert.UsagePeriodStart = &periodStart
+		}
+		if peer, ok := counters[cert.Ifname+"/"+cert.Public]; ok && !cert.Disabled {
+			// counters start from zero when device was recreated
+			if peer.ReceiveBytes < cert.LastRx || peer.TransmitBytes < cert.LastTx {
+				cert.LastRx, cert.LastTx = 0, 0
+			}
+			cert.UsageRx += peer.ReceiveBytes - cert.LastRx
+			cert.UsageTx += peer.TransmitBytes - cert.LastTx
+			cert.LastRx, cert.LastTx = peer.ReceiveBytes, peer.TransmitBytes
+			if !peer.LastHandshakeTime.IsZero() {
+				handshake := peer.LastHandshakeTime
+				cert.LastHandshake = &handshake
+			}
+		}
+		exceeded := cert.Quota > 0 && cert.UsageRx+cert.UsageTx >= cert.Quota
+		disable := exceeded && !cert.Disabled
+		enable = enable && !exceeded
+		if enable || disable {
+			cert.LastRx, cert.LastTx = 0, 0
+		}
+		err = u.ClientRepo.UpdateClientUsage(&cert)
+		if err != nil {
+			log.Printf("accountUsage %v", err)
+			continue
+		}
+		if enable || disable {
+			// client read above can be enabled or disabled by request meanwhile,
+			// its state is changed only when it is still the same
+			changed, err := u.ClientRepo.SetClientQuotaExceeded(cert.ID, disable)
+			if err != nil {
+				log.Printf("accountUsage %v", err)
+				continue
+			}
+			if !changed {
+				continue
+			}
+		}
+		if disable {
+			log.Printf("accountUsage: client %s %s exceeded quota %d bytes, disabled", cert.Ifname, cert.IP, cert.Quota)
+			err = u.removePeer(cert.Ifname, cert.Public)
+			if err != nil {
+				log.Printf("accountUsage %v", err)
+			}
+			u.syncWgQuick(cert.Ifname)
+		} else if enable {
+			log.Printf("accountUsage: quota period of client %s %s restarted, enabled", cert.Ifname, cert.IP)
+			err = u.setClient(cert.Ifname, cert.IP, cert.AllowedIPs, cert.Public, cert.PresharedKey)
+			if err != nil {
+				log.Printf("accountUsage %v", err)
+			}
+			u.syncWgQuick(cert.Ifname)
+		}
+	}
+	return nil
+}
+
+// removePeer removes peer from the device, keys and config of the client stay untouched.
+func (u *Usecases) removePeer(ifname, public string) error {
+	client, err := wgctrl.New()
+	if err != nil {
+		log.Printf("removePeer %v", err)
+		return err
+	}
+	defer client.Close()
+	peerPubKey, err := wgtypes.ParseKey(public)
+	if err != nil {
+		log.Printf("removePeer %v", err)
+		return err
 	}
 	cfg := wgtypes.Config{
 		Peers: []wgtypes.PeerConfig{
@@ -427,40 +1442,208 @@ func (u *Usecases) DeleteClient(public string) error {
 			},
 		},
 	}
-	err = client.ConfigureDevice(cert.Ifname, cfg)
-	if err != nil {
-		log.Printf("DeleteClient %v", err)
-		return err
+	return client.ConfigureDevice(ifname, cfg)
+}
+
+func (u *Usecases) GetClientQR(public, format string, size int) ([]byte, error) {
+	public = strings.TrimSpace(public)
+	if format != "png" && format != "svg" {
+		return nil, fmt.Errorf("unknown qr format %s, use png or svg", format)
 	}
-	ip := strings.Split(cert.IP, "/")
-	if len(ip) > 0 {
-		u.PingStatus.Delete(ip[0])
+	if size < 64 || size > 2048 {
+		return nil, fmt.Errorf("qr size %d must be between 64 and 2048", size)
 	}
 
-	return nil
+	var config string
+	cert, err := u.ClientRepo.GetClientByPublic(public)
+	if err == nil {
+		config = cert.Config
+	} else {
+		archive, errArchive := u.ClientRepo.GetArchiveClientByPublic(public)
+		if errArchive != nil {
+			log.Printf("GetClientQR %v %v", err, errArchive)
+			return nil, fmt.Errorf("client %s not found", public)
+		}
+		config = archive.Config
+	}
+
+	qr, err := qrcode.New(config, qrcode.Medium)
+	if err != nil {
+		log.Printf("GetClientQR %v", err)
+		return nil, err
+	}
+	if format == "svg" {
+		return qrSvg(qr, size), nil
+	}
+	return qr.PNG(size)
+}
 
+// qrSvg renders qr code bitmap as svg image, one module is one unit of viewBox.
+func qrSvg(qr *qrcode.QRCode, size int) []byte {
+	bitmap := qr.Bitmap()
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, len(bitmap), len(bitmap)))
+	builder.WriteString(`<rect width="100%" height="100%" fill="#ffffff"/>`)
+	builder.WriteString(`<path fill="#000000" d="`)
+	for y, row := range bitmap {
+		for x, black := range row {
+			if black {
+				builder.WriteString(fmt.Sprintf("M%d %dh1v1h-1z", x, y))
+			}
+		}
+	}
+	builder.WriteString(`"/></svg>`)
+	return []byte(builder.String())
 }
 
-func (u *Usecases) GetClientArchive() ([]ClientResponse, error) {
-	data, err := u.ClientRepo.GetClientArchive()
+func (u *Usecases) GetClientArchive(opts ListOptions) ([]ClientResponse, int64, error) {
+	if len(opts.Fields) == 0 {
+		opts.Fields = DefaultClientArchiveFields
+	}
+	page, err := listPage(opts, archiveSorts, archiveFields)
+	if err != nil {
+		return []ClientResponse{}, 0, err
+	}
+	data, total, err := u.ClientRepo.GetClientArchive(page)
 	if err != nil {
 		log.Printf("GetClientArchive %v", err)
-		return []ClientResponse{}, err
+		return []ClientResponse{}, 0, err
 	}
 	if len(data) == 0 {
-		return []ClientResponse{}, nil
+		return []ClientResponse{}, total, nil
 	}
 	var clientArchive []ClientResponse
 	for _, v := range data {
 		clientArchive = append(clientArchive, ClientResponse{
-			Ifname:     v.Ifname,
-			Private:    v.Private,
-			Public:     v.Public,
-			Ip:         v.IP,
-			AllowedIPs: v.AllowedIPs,
-			Config:     v.Config,
+			ClientMeta:     clientMeta(v.Name, v.Owner, v.Email, v.Description, v.Tags),
+			ConfigSettings: ConfigSettings{Dns: v.Dns, Mtu: v.Mtu, Keepalive: v.Keepalive},
+			Ifname:         v.Ifname,
+			Private:        v.Private,
+			Public:         v.Public,
+			Ip:             v.IP,
+			AllowedIPs:     v.AllowedIPs,
+			Profile:        v.Profile,
+			Config:         v.Config,
+			PresharedKey:   v.PresharedKey,
+			ExpiresAt:      v.ExpiresAt,
+			Reason:         v.Reason,
+			CreatedAt:      timeOf(v.CreatedAt),
+			DeletedAt:      timeOf(v.DeletedAt.Time),
+			ArchiveId:      v.ID,
 		})
 	}
-	return clientArchive, err
+	return clientArchive, total, err
+
+}
+
+func (u *Usecases) RestoreClient(archiveId uint) (ClientResponse, error) {
+	arch, err := u.ClientRepo.GetArchiveClientById(archiveId)
+	if err != nil {
+		log.Printf("RestoreClient %v", err)
+		return ClientResponse{}, err
+	}
+	defer u.syncWgQuick(arch.Ifname)
+	return u.restoreClient(arch)
+}
+
+// restoreClient creates client from archive record with config for current keys and endpoint of interface,
+// expiration time which already passed is removed.
+func (u *Usecases) restoreClient(arch db.ArchiveClientCert) (ClientResponse, error) {
+	u.allocMu.Lock()
+	defer u.allocMu.Unlock()
 
+	servData, err := u.ServerRepo.GetServerCertByIfname(arch.Ifname)
+	if err != nil {
+		log.Printf("restoreClient %v", err)
+		return ClientResponse{}, fmt.Errorf("interface %s of client does not exist: %w", arch.Ifname, err)
+	}
+	if _, err := u.ClientRepo.GetClientByPublic(arch.Public); err == nil {
+		return ClientResponse{}, fmt.Errorf("client with public key %s already exists", arch.Public)
+	}
+	err = u.checkIpMask(arch.Ifname, arch.IP)
+	if err != nil {
+		log.Printf("restoreClient %v", err)
+		return ClientResponse{}, err
+	}
+	pool, err := u.loadPool(make(map[string]*ipPool), servData)
+	if err != nil {
+		log.Printf("restoreClient %v", err)
+		return ClientResponse{}, err
+	}
+	err = pool.reserve(arch.IP, "")
+	if err != nil {
+		log.Printf("restoreClient %v", err)
+		return ClientResponse{}, err
+	}
+	profile := arch.Profile
+	if profile != "" {
+		if _, err := u.ClientRepo.GetProfileByName(profile); err != nil {
+			log.Printf("restoreClient: profile %s of client %s is not found, client is restored without profile", profile, arch.Public)
+			profile = ""
+		}
+	}
+	ipList, err := u.configRoutes(arch.Ifname, profile, arch.AllowedIPs)
+	if err != nil {
+		log.Printf("restoreClient %v", err)
+		return ClientResponse{}, err
+	}
+	expiresAt := arch.ExpiresAt
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		expiresAt = nil
+	}
+
+	config := u.createConfig(arch.Private, arch.IP, servData.Public, ipList, servData.Endpoint, servData.Port, arch.PresharedKey,
+		configSettings(servData, arch.Dns, arch.Mtu, arch.Keepalive))
+	cert := &db.ClientCert{
+		Ifname:       arch.Ifname,
+		Private:      arch.Private,
+		Public:       arch.Public,
+		IP:           arch.IP,
+		AllowedIPs:   arch.AllowedIPs,
+		Profile:      profile,
+		Dns:          arch.Dns,
+		Mtu:          arch.Mtu,
+		Keepalive:    arch.Keepalive,
+		Config:       config,
+		PresharedKey: arch.PresharedKey,
+		ExpiresAt:    expiresAt,
+		Name:         arch.Name,
+		Owner:        arch.Owner,
+		Email:        arch.Email,
+		Description:  arch.Description,
+		Tags:         arch.Tags,
+	}
+	// peer is added before commit, so failed restore leaves client in archive
+	err = u.ClientRepo.RestoreClientCert(arch.ID, cert, func() error {
+		return u.setClient(cert.Ifname, cert.IP, cert.AllowedIPs, cert.Public, cert.PresharedKey)
+	})
+	if err != nil {
+		log.Printf("restoreClient %v", err)
+		return ClientResponse{}, err
+	}
+	log.Printf("restoreClient: client %s %s restored from archive", cert.Ifname, cert.IP)
+
+	return ClientResponse{
+		ClientMeta:     clientMeta(cert.Name, cert.Owner, cert.Email, cert.Description, cert.Tags),
+		ConfigSettings: ConfigSettings{Dns: cert.Dns, Mtu: cert.Mtu, Keepalive: cert.Keepalive},
+		Ifname:         cert.Ifname,
+		Private:        cert.Private,
+		Public:         cert.Public,
+		Ip:             cert.IP,
+		AllowedIPs:     cert.AllowedIPs,
+		Profile:        cert.Profile,
+		Config:         cert.Config,
+		PresharedKey:   cert.PresharedKey,
+		ExpiresAt:      cert.ExpiresAt,
+	}, nil
+}
+
+func (u *Usecases) DeleteClientArchive(archiveId uint) error {
+	cert, err := u.ClientRepo.DeleteArchiveClient(archiveId)
+	if err != nil {
+		log.Printf("DeleteClientArchive %v", err)
+		return err
+	}
+	log.Printf("DeleteClientArchive: archived client %d %s %s %s removed", cert.ID, cert.Ifname, cert.IP, cert.Public)
+	return nil
 }
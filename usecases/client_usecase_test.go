@@ -0,0 +1,199 @@
+package usecases
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPublic = "ZaKCjAUIvDtYg8BmGOXLk6GPowDIAwoz0qN8eLt8/3w="
+	testPsk    = "It5GHel+rl6B3d6GQ6X904jZpPv5VN5UCxRgjDf1UhM="
+)
+
+// interfaceAddrs returns addresses of interface like net.Interface.Addrs does
+func interfaceAddrs(t *testing.T, cidrs ...string) []net.Addr {
+	var addrs []net.Addr
+	for _, v := range cidrs {
+		ip, subnet, err := net.ParseCIDR(v)
+		require.NoError(t, err)
+		addrs = append(addrs, &net.IPNet{IP: ip, Mask: subnet.Mask})
+	}
+	return addrs
+}
+
+func interfaceSubnets(t *testing.T, cidrs ...string) []*net.IPNet {
+	var subnets []*net.IPNet
+	for _, v := range interfaceAddrs(t, cidrs...) {
+		subnets = append(subnets, v.(*net.IPNet))
+	}
+	return subnets
+}
+
+func TestSplitFamilies(t *testing.T) {
+	tests := []struct {
+		name    string
+		ips     string
+		ip4     string
+		ip6     string
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "v4 only", ips: "10.0.0.2/24", ip4: "10.0.0.2/24"},
+		{name: "v6 only", ips: "fd00::2/64", ip6: "fd00::2/64"},
+		{name: "dual-stack", ips: "10.0.0.2/24, fd00::2/64", ip4: "10.0.0.2/24", ip6: "fd00::2/64"},
+		{name: "dual-stack v6 first", ips: "fd00::2/64,10.0.0.2/24", ip4: "10.0.0.2/24", ip6: "fd00::2/64"},
+		{name: "two v4", ips: "10.0.0.2/24,10.0.0.3/24", wantErr: true},
+		{name: "two v6", ips: "fd00::2/64,fd00::3/64", wantErr: true},
+		{name: "no mask", ips: "10.0.0.2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip4, ip6, err := splitFamilies(tt.ips)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.ip4, ip4)
+			assert.Equal(t, tt.ip6, ip6)
+		})
+	}
+}
+
+func TestMergeFamilies(t *testing.T) {
+	tests := []struct {
+		name    string
+		ip      string
+		current string
+		want    string
+		wantErr bool
+	}{
+		{name: "v4 only replaces v4", ip: "10.0.0.5/24", current: "10.0.0.2/24", want: "10.0.0.5/24"},
+		{name: "v6 only replaces v6", ip: "fd00::5/64", current: "fd00::2/64", want: "fd00::5/64"},
+		{name: "dual-stack keeps v6", ip: "10.0.0.5/24", current: "10.0.0.2/24,fd00::2/64", want: "10.0.0.5/24,fd00::2/64"},
+		{name: "dual-stack keeps v4", ip: "fd00::5/64", current: "10.0.0.2/24,fd00::2/64", want: "10.0.0.2/24,fd00::5/64"},
+		{name: "dual-stack replaces both", ip: "fd00::5/64,10.0.0.5/24", current: "10.0.0.2/24,fd00::2/64", want: "10.0.0.5/24,fd00::5/64"},
+		{name: "other family is added", ip: "fd00::5/64", current: "10.0.0.2/24", want: "10.0.0.2/24,fd00::5/64"},
+		{name: "bad ip", ip: "10.0.0.5/24,10.0.0.6/24", current: "10.0.0.2/24", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeFamilies(tt.ip, tt.current)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMergeRoutes(t *testing.T) {
+	tests := []struct {
+		name      string
+		subnets   []string
+		allowedIp string
+		want      string
+	}{
+		{name: "v4 only", subnets: []string{"10.0.0.1/24"}, allowedIp: "192.168.1.0/24", want: "10.0.0.0/24,192.168.1.0/24"},
+		{name: "v6 only", subnets: []string{"fd00::1/64"}, allowedIp: "fd01::/64", want: "fd00::/64,fd01::/64"},
+		{name: "dual-stack", subnets: []string{"10.0.0.1/24", "fd00::1/64"}, want: "10.0.0.0/24,fd00::/64"},
+		{name: "repeats and host bits", subnets: []string{"10.0.0.1/24"}, allowedIp: "10.0.0.7/24, 192.168.1.0/24,192.168.1.0/24", want: "10.0.0.0/24,192.168.1.0/24"},
+		{name: "bad route is skipped", subnets: []string{"10.0.0.1/24"}, allowedIp: "bad,192.168.1.0/24", want: "10.0.0.0/24,192.168.1.0/24"},
+		{name: "v4 default route on v4 only", subnets: []string{"10.0.0.1/24"}, allowedIp: "0.0.0.0/0", want: "0.0.0.0/0,10.0.0.0/24"},
+		{name: "v4 default route on dual-stack", subnets: []string{"10.0.0.1/24", "fd00::1/64"}, allowedIp: "0.0.0.0/0", want: "0.0.0.0/0,10.0.0.0/24,::/0,fd00::/64"},
+		{name: "v6 default route on dual-stack", subnets: []string{"10.0.0.1/24", "fd00::1/64"}, allowedIp: "::/0", want: "0.0.0.0/0,10.0.0.0/24,::/0,fd00::/64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes, list, err := mergeRoutes(interfaceSubnets(t, tt.subnets...), tt.allowedIp)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, list)
+			assert.Equal(t, tt.want, ipNetJoin(routes))
+		})
+	}
+}
+
+func ipNetJoin(list []net.IPNet) string {
+	var result string
+	for i, v := range list {
+		if i > 0 {
+			result += ","
+		}
+		result += v.String()
+	}
+	return result
+}
+
+func TestPeerConfig(t *testing.T) {
+	u := &Usecases{}
+	tests := []struct {
+		name      string
+		ip        string
+		allowedIp string
+		psk       string
+		want      string
+		wantErr   bool
+	}{
+		{name: "v4 only", ip: "10.0.0.2/24", want: "10.0.0.2/32"},
+		{name: "v6 only", ip: "fd00::2/64", want: "fd00::2/128"},
+		{name: "dual-stack", ip: "10.0.0.2/24,fd00::2/64", want: "10.0.0.2/32,fd00::2/128"},
+		{name: "routes behind client", ip: "10.0.0.2/24,fd00::2/64", allowedIp: "192.168.5.0/24,fd01::/64", want: "10.0.0.2/32,fd00::2/128,192.168.5.0/24,fd01::/64"},
+		{name: "route with address of client is dropped", ip: "10.0.0.2/24", allowedIp: "10.0.0.0/24,192.168.5.0/24", want: "10.0.0.2/32,192.168.5.0/24"},
+		{name: "preshared key", ip: "10.0.0.2/24", psk: testPsk, want: "10.0.0.2/32"},
+		{name: "bad ip", ip: "10.0.0.2", wantErr: true},
+		{name: "bad preshared key", ip: "10.0.0.2/24", psk: "bad", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer, err := u.peerConfig(tt.ip, tt.allowedIp, testPublic, tt.psk)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testPublic, peer.PublicKey.String())
+			assert.True(t, peer.ReplaceAllowedIPs)
+			assert.Equal(t, tt.want, ipNetJoin(peer.AllowedIPs))
+			if tt.psk != "" {
+				require.NotNil(t, peer.PresharedKey)
+				assert.Equal(t, tt.psk, peer.PresharedKey.String())
+			} else {
+				assert.Nil(t, peer.PresharedKey)
+			}
+		})
+	}
+}
+
+func TestCheckIpSubnets(t *testing.T) {
+	tests := []struct {
+		name    string
+		addrs   []string
+		ips     []string
+		wantErr string
+	}{
+		{name: "v4 only", addrs: []string{"10.0.0.1/24"}, ips: []string{"10.0.0.2/24"}},
+		{name: "v6 only", addrs: []string{"fd00::1/64", "fe80::1/64"}, ips: []string{"fd00::2/64"}},
+		{name: "dual-stack", addrs: []string{"10.0.0.1/24", "fd00::1/64"}, ips: []string{"10.0.0.2/24", "fd00::2/64"}},
+		{name: "v6 client on v4 only interface", addrs: []string{"10.0.0.1/24"}, ips: []string{"fd00::2/64"}, wantErr: "has no subnet"},
+		{name: "v4 client on v6 only interface", addrs: []string{"fd00::1/64"}, ips: []string{"10.0.0.2/24"}, wantErr: "has no subnet"},
+		{name: "other subnet", addrs: []string{"10.0.0.1/24"}, ips: []string{"10.0.1.2/24"}, wantErr: "incorrect subnet"},
+		{name: "other mask", addrs: []string{"10.0.0.1/24"}, ips: []string{"10.0.0.2/16"}, wantErr: "incorrect subnet"},
+		{name: "address of interface", addrs: []string{"10.0.0.1/24", "fd00::1/64"}, ips: []string{"fd00::1/64"}, wantErr: "cannot be same"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkIpSubnets("wg0", interfaceAddrs(t, tt.addrs...), tt.ips)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package usecases
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"wireguard_api/db"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+type wgQuickPeer struct {
+	Name         string
+	Public       string
+	PresharedKey string
+	AllowedIPs   []string
+}
+
+// wgQuickConfig is wg-quick config, Ignored lists keys which are not used
+type wgQuickConfig struct {
+	Private string
+	Address []string
+	Port    int
+	Peers   []wgQuickPeer
+	Ignored []string
+}
+
+var peerName = regexp.MustCompile(`^#\s*(?i:name)\s*[=:]\s*(.+)$`)
+
+// parseWgQuick parses wg-quick config. Name of peer is taken from "# Name = ..." right before
+// [Peer] or inside the peer, otherwise from comment line right before [Peer].
+func parseWgQuick(text string) (wgQuickConfig, error) {
+	var cfg wgQuickConfig
+	var section, comment, name string
+	var peer *wgQuickPeer
+	ignored := make(map[string]struct{})
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			if m := peerName.FindStringSubmatch(line); m != nil {
+				name = strings.TrimSpace(m[1])
+			} else {
+				comment = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			}
+			continue
+		}
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			comment = ""
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(strings.Trim(line, "[]"))
+			switch section {
+			case "interface":
+				peer = nil
+			case "peer":
+				if name == "" {
+					name = comment
+				}
+				cfg.Peers = append(cfg.Peers, wgQuickPeer{Name: name})
+				peer = &cfg.Peers[len(cfg.Peers)-1]
+			default:
+				return wgQuickConfig{}, fmt.Errorf("line %d: unknown section %s", n, line)
+			}
+			comment, name = "", ""
+			continue
+		}
+		comment = ""
+		if name != "" && peer != nil {
+			peer.Name, name = name, ""
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return wgQuickConfig{}, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		var err error
+		switch {
+		case section == "interface" && strings.EqualFold(key, "PrivateKey"):
+			cfg.Private = value
+		case section == "interface" && strings.EqualFold(key, "Address"):
+			cfg.Address = append(cfg.Address, splitIps(value)...)
+		case section == "interface" && strings.EqualFold(key, "ListenPort"):
+			cfg.Port, err = strconv.Atoi(value)
+		case section == "peer" && strings.EqualFold(key, "PublicKey"):
+			peer.Public = value
+		case section == "peer" && strings.EqualFold(key, "PresharedKey"):
+			peer.PresharedKey = value
+		case section == "peer" && strings.EqualFold(key, "AllowedIPs"):
+			peer.AllowedIPs = append(peer.AllowedIPs, splitIps(value)...)
+		case section == "":
+			return wgQuickConfig{}, fmt.Errorf("line %d: %s is outside of section", n, key)
+		default:
+			name := "[Interface] " + key
+			if section == "peer" {
+				name = "[Peer] " + key
+			}
+			if _, ok := ignored[name]; !ok {
+				ignored[name] = struct{}{}
+				cfg.Ignored = append(cfg.Ignored, name)
+			}
+		}
+		if err != nil {
+			return wgQuickConfig{}, fmt.Errorf("line %d: bad %s: %v", n, key, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return wgQuickConfig{}, err
+	}
+	return cfg, nil
+}
+
+// ImportInterface creates interface and its clients from wg-quick config of server, keys and
+// addresses of peers are kept. Private keys of peers are taken from configs of clients in spec,
+// configs of other peers have placeholder instead of private key. Running device is used as it is
+// when spec.Adopt is set, otherwise interface is created and brought up.
+func (u *Usecases) ImportInterface(spec ImportSpec) (ImportedInterface, error) {
+	ifname := strings.ToLower(strings.TrimSpace(spec.Ifname))
+	endpoint := strings.TrimSpace(spec.Endpoint)
+	if err := checkEndpoint(endpoint); err != nil {
+		return ImportedInterface{}, err
+	}
+	if _, err := u.ServerRepo.GetServerCertByIfname(ifname); err == nil {
+		return ImportedInterface{}, fmt.Errorf("interface %s already exist", ifname)
+	}
+	cfg, err := parseWgQuick(spec.Config)
+	if err != nil {
+		return ImportedInterface{}, err
+	}
+	privateKey, err := wgtypes.ParseKey(cfg.Private)
+	if err != nil {
+		return ImportedInterface{}, fmt.Errorf("bad PrivateKey of interface: %w", err)
+	}
+	ip4, ip6, err := splitFamilies(strings.Join(cfg.Address, ","))
+	if err != nil {
+		return ImportedInterface{}, err
+	}
+	ip := joinIps(ip4, ip6)
+	if ip == "" {
+		return ImportedInterface{}, fmt.Errorf("interface has no Address")
+	}
+
+	if spec.Adopt {
+		client, err := wgctrl.New()
+		if err != nil {
+			log.Printf("ImportInterface %v", err)
+			return ImportedInterface{}, err
+		}
+		device, err := client.Device(ifname)
+		client.Close()
+		if err != nil {
+			return ImportedInterface{}, fmt.Errorf("running interface %s not found: %w", ifname, err)
+		}
+		if device.PrivateKey != privateKey {
+			return ImportedInterface{}, fmt.Errorf("private key of running interface %s differs from config", ifname)
+		}
+		if cfg.Port == 0 {
+			cfg.Port = device.ListenPort
+		}
+		if cfg.Port != device.ListenPort {
+			return ImportedInterface{}, fmt.Errorf("ListenPort %d of config differs from port %d of running interface", cfg.Port, device.ListenPort)
+		}
+	} else {
+		for _, v := range u.getInterfaceList() {
+			if ifname == v {
+				return ImportedInterface{}, fmt.Errorf("interface %s already exist, set adopt to use it", ifname)
+			}
+		}
+	}
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		return ImportedInterface{}, fmt.Errorf("ListenPort %d is out of range 1-65535", cfg.Port)
+	}
+	servers, err := u.ServerRepo.GetServerCertificates()
+	if err != nil {
+		log.Printf("ImportInterface %v", err)
+		return ImportedInterface{}, err
+	}
+	for _, v := range servers {
+		if v.Port == cfg.Port {
+			return ImportedInterface{}, fmt.Errorf("port %d is used by interface %s", v.Port, v.Ifname)
+		}
+	}
+
+	keepalive := DefaultKeepalive
+	serv := db.ServerCert{
+		Private:   privateKey.String(),
+		Public:    privateKey.PublicKey().String(),
+		Endpoint:  endpoint,
+		Ip:        ip,
+		Ifname:    ifname,
+		Config:    u.createServerCert(privateKey.String(), ip, cfg.Port),
+		Port:      cfg.Port,
+		Keepalive: &keepalive,
+	}
+
+	// private keys of peers from configs of clients
+	privates := make(map[string]string)
+	for i, text := range spec.Clients {
+		clientCfg, err := parseWgQuick(text)
+		if err != nil {
+			return ImportedInterface{}, fmt.Errorf("client config %d: %w", i+1, err)
+		}
+		key, err := wgtypes.ParseKey(clientCfg.Private)
+		if err != nil {
+			return ImportedInterface{}, fmt.Errorf("client config %d: bad PrivateKey: %w", i+1, err)
+		}
+		privates[key.PublicKey().String()] = key.String()
+	}
+
+	certs, noPrivate, err := u.importPeers(serv, cfg.Peers, privates)
+	if err != nil {
+		return ImportedInterface{}, err
+	}
+
+	u.allocMu.Lock()
+	defer u.allocMu.Unlock()
+	linkCreated := false
+	err = u.ServerRepo.ImportServer(&serv, certs, func() error {
+		if !spec.Adopt {
+			if err := u.upLink(serv); err != nil {
+				return err
+			}
+			linkCreated = true
+		}
+		return u.setClients(certs)
+	})
+	if err != nil {
+		log.Printf("ImportInterface %v", err)
+		if linkCreated {
+			u.removeLink(ifname)
+		}
+		return ImportedInterface{}, err
+	}
+	u.stopped.Delete(ifname)
+	u.syncWgQuick(ifname)
+	log.Printf("ImportInterface: interface %s imported with %d clients, %d without private key", ifname, len(certs), len(noPrivate))
+
+	clients := make([]ClientResponse, 0, len(certs))
+	for _, cert := range certs {
+		clients = append(clients, newClientResponse(cert))
+	}
+	return ImportedInterface{
+		ServerInterfaces: newServerInterfaces(serv),
+		Clients:          clients,
+		NoPrivateKey:     noPrivate,
+		Ignored:          cfg.Ignored,
+	}, nil
+}
+
+// importPeers makes clients of peers. Host address of peer inside subnet of interface is the
+// address of client, other AllowedIPs of peer are routes of client.
+func (u *Usecases) importPeers(serv db.ServerCert, peers []wgQuickPeer, privates map[string]string) ([]db.ClientCert, []string, error) {
+	var subnets []*net.IPNet
+	for _, v := range splitIps(serv.Ip) {
+		_, subnet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CIDR format: %v", err)
+		}
+		subnets = append(subnets, subnet)
+	}
+	blocked, err := newIpPool(serv, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certs := make([]db.ClientCert, 0, len(peers))
+	noPrivate := []string{}
+	publics := make(map[string]struct{})
+	for i, peer := range peers {
+		key, err := wgtypes.ParseKey(peer.Public)
+		if err != nil {
+			return nil, nil, fmt.Errorf("peer %d: bad PublicKey: %w", i+1, err)
+		}
+		public := key.String()
+		if _, ok := publics[public]; ok {
+			return nil, nil, fmt.Errorf("peer %d: public key %s is used twice", i+1, public)
+		}
+		publics[public] = struct{}{}
+		var presharedKey string
+		if peer.PresharedKey != "" {
+			psk, err := wgtypes.ParseKey(peer.PresharedKey)
+			if err != nil {
+				return nil, nil, fmt.Errorf("peer %s: bad PresharedKey: %w", public, err)
+			}
+			presharedKey = psk.String()
+		}
+
+		var ip4, ip6 string
+		var routes []string
+		for _, v := range peer.AllowedIPs {
+			addr, network, err := net.ParseCIDR(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("peer %s: invalid CIDR format: %v", public, err)
+			}
+			ones, bits := network.Mask.Size()
+			var subnet *net.IPNet
+			for _, s := range subnets {
+				if ones == bits && s.Contains(addr) {
+					subnet = s
+				}
+			}
+			switch {
+			case subnet != nil && addr.To4() != nil && ip4 == "":
+				ip4 = (&net.IPNet{IP: addr, Mask: subnet.Mask}).String()
+			case subnet != nil && addr.To4() == nil && ip6 == "":
+				ip6 = (&net.IPNet{IP: addr, Mask: subnet.Mask}).String()
+			default:
+				routes = append(routes, network.String())
+			}
+		}
+		ip := joinIps(ip4, ip6)
+		if ip == "" {
+			return nil, nil, fmt.Errorf("peer %s has no address in subnets %s", public, serv.Ip)
+		}
+		err = blocked.reserve(ip, "")
+		if err != nil {
+			return nil, nil, fmt.Errorf("peer %s: %w", public, err)
+		}
+
+		private := privates[public]
+		if private == "" {
+			noPrivate = append(noPrivate, public)
+		}
+		allowedIp := strings.Join(routes, ",")
+		_, ipList, err := mergeRoutes(subnets, allowedIp)
+		if err != nil {
+			return nil, nil, err
+		}
+		meta := normalizeMeta(ClientMeta{Name: peer.Name})
+		certs = append(certs, db.ClientCert{
+			Ifname:       serv.Ifname,
+			Private:      private,
+			Public:       public,
+			IP:           ip,
+			AllowedIPs:   allowedIp,
+			Config:       u.createConfig(private, ip, serv.Public, ipList, serv.Endpoint, serv.Port, presharedKey, configSettings(serv, "", 0, nil)),
+			PresharedKey: presharedKey,
+			Name:         meta.Name,
+		})
+	}
+	return certs, noPrivate, nil
+}
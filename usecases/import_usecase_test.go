@@ -0,0 +1,159 @@
+package usecases
+
+import (
+	"testing"
+	"wireguard_api/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const testWgQuick = `# server of office
+[Interface]
+PrivateKey = ` + testPsk + `
+Address = 10.0.0.1/24, fd00::1/64
+ListenPort = 51820
+PostUp = iptables -A FORWARD -i %i -j ACCEPT
+PostDown = iptables -D FORWARD -i %i -j ACCEPT
+SaveConfig = false
+
+# laptop of alice
+[Peer]
+PublicKey = ` + testPublic + `
+AllowedIPs = 10.0.0.2/32, fd00::2/128 # inline comment
+AllowedIPs = 192.168.5.0/24
+PersistentKeepalive = 25
+
+# Name = phone
+[Peer]
+PublicKey = ` + testPublic2 + `
+PresharedKey = ` + testPsk + `
+AllowedIPs = 10.0.0.3/32
+
+[peer]
+# name: router
+publickey = ` + testPsk + `
+allowedips = 10.0.0.4/32
+Endpoint = 192.0.2.1:51820
+`
+
+func TestParseWgQuick(t *testing.T) {
+	cfg, err := parseWgQuick(testWgQuick)
+	require.NoError(t, err)
+	assert.Equal(t, testPsk, cfg.Private)
+	assert.Equal(t, []string{"10.0.0.1/24", "fd00::1/64"}, cfg.Address)
+	assert.Equal(t, 51820, cfg.Port)
+	assert.Equal(t, []wgQuickPeer{
+		{Name: "laptop of alice", Public: testPublic, AllowedIPs: []string{"10.0.0.2/32", "fd00::2/128", "192.168.5.0/24"}},
+		{Name: "phone", Public: testPublic2, PresharedKey: testPsk, AllowedIPs: []string{"10.0.0.3/32"}},
+		{Name: "router", Public: testPsk, AllowedIPs: []string{"10.0.0.4/32"}},
+	}, cfg.Peers)
+	assert.Equal(t, []string{"[Interface] PostUp", "[Interface] PostDown", "[Interface] SaveConfig", "[Peer] PersistentKeepalive", "[Peer] Endpoint"}, cfg.Ignored)
+}
+
+func TestParseWgQuickNames(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "no comment", text: "[Peer]\nPublicKey = " + testPublic, want: ""},
+		{name: "comment before peer", text: "# alice\n[Peer]\nPublicKey = " + testPublic, want: "alice"},
+		{name: "comment separated by empty line", text: "# alice\n\n[Peer]\nPublicKey = " + testPublic, want: ""},
+		{name: "name before peer wins over comment", text: "# Name = bob\n# alice\n[Peer]\nPublicKey = " + testPublic, want: "bob"},
+		{name: "name inside peer", text: "# alice\n[Peer]\n# Name = bob\nPublicKey = " + testPublic, want: "bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseWgQuick(tt.text)
+			require.NoError(t, err)
+			require.Len(t, cfg.Peers, 1)
+			assert.Equal(t, tt.want, cfg.Peers[0].Name)
+		})
+	}
+}
+
+func TestParseWgQuickErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{name: "unknown section", text: "[Interface]\nPrivateKey = x\n[Server]\n", wantErr: "line 3: unknown section [Server]"},
+		{name: "no value", text: "[Interface]\nPrivateKey\n", wantErr: "line 2: expected key = value"},
+		{name: "outside of section", text: "PrivateKey = x\n", wantErr: "line 1: PrivateKey is outside of section"},
+		{name: "bad port", text: "[Interface]\nListenPort = port\n", wantErr: "line 2: bad ListenPort"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseWgQuick(tt.text)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestImportPeers(t *testing.T) {
+	u := &Usecases{}
+	serv := db.ServerCert{Ifname: "wg0", Ip: "10.0.0.1/24,fd00::1/64", Public: testPublic2, Endpoint: "vpn.example.com", Port: 51820}
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	withPrivate := key.PublicKey().String()
+	privates := map[string]string{withPrivate: key.String()}
+
+	peers := []wgQuickPeer{
+		{Name: " laptop ", Public: testPublic, AllowedIPs: []string{"10.0.0.2/32", "fd00::2/128", "192.168.5.0/24"}},
+		{Public: withPrivate, PresharedKey: testPsk, AllowedIPs: []string{"fd00::3/128"}},
+	}
+	certs, noPrivate, err := u.importPeers(serv, peers, privates)
+	require.NoError(t, err)
+	require.Len(t, certs, 2)
+	assert.Equal(t, []string{testPublic}, noPrivate)
+
+	assert.Equal(t, "laptop", certs[0].Name)
+	assert.Equal(t, "wg0", certs[0].Ifname)
+	assert.Equal(t, "10.0.0.2/24,fd00::2/64", certs[0].IP)
+	assert.Equal(t, "192.168.5.0/24", certs[0].AllowedIPs)
+	assert.Empty(t, certs[0].Private)
+	assert.Contains(t, certs[0].Config, "PrivateKey = "+PrivateKeyPlaceholder+"\n")
+	assert.Contains(t, certs[0].Config, "AllowedIPs = 10.0.0.0/24,192.168.5.0/24,fd00::/64\n")
+	assert.Contains(t, certs[0].Config, "Endpoint = vpn.example.com:51820\n")
+
+	assert.Equal(t, "fd00::3/64", certs[1].IP)
+	assert.Equal(t, key.String(), certs[1].Private)
+	assert.Equal(t, testPsk, certs[1].PresharedKey)
+	assert.Contains(t, certs[1].Config, "PrivateKey = "+key.String()+"\n")
+	assert.Contains(t, certs[1].Config, "PresharedKey = "+testPsk+"\n")
+}
+
+func TestImportPeersErrors(t *testing.T) {
+	serv := db.ServerCert{Ifname: "wg0", Ip: "10.0.0.1/24"}
+	tests := []struct {
+		name    string
+		peers   []wgQuickPeer
+		wantErr string
+	}{
+		{name: "bad public key", peers: []wgQuickPeer{{Public: "bad", AllowedIPs: []string{"10.0.0.2/32"}}}, wantErr: "peer 1: bad PublicKey"},
+		{name: "bad preshared key", peers: []wgQuickPeer{{Public: testPublic, PresharedKey: "bad", AllowedIPs: []string{"10.0.0.2/32"}}}, wantErr: "bad PresharedKey"},
+		{name: "bad allowed ips", peers: []wgQuickPeer{{Public: testPublic, AllowedIPs: []string{"10.0.0.2"}}}, wantErr: "invalid CIDR format"},
+		{name: "public key used twice", peers: []wgQuickPeer{
+			{Public: testPublic, AllowedIPs: []string{"10.0.0.2/32"}},
+			{Public: testPublic, AllowedIPs: []string{"10.0.0.3/32"}},
+		}, wantErr: "peer 2: public key " + testPublic + " is used twice"},
+		{name: "no address in subnet", peers: []wgQuickPeer{{Public: testPublic, AllowedIPs: []string{"10.0.1.2/32", "10.0.0.0/24"}}}, wantErr: "has no address in subnets"},
+		{name: "address of server", peers: []wgQuickPeer{{Public: testPublic, AllowedIPs: []string{"10.0.0.1/32"}}}, wantErr: "server address"},
+		{name: "address used twice", peers: []wgQuickPeer{
+			{Public: testPublic, AllowedIPs: []string{"10.0.0.2/32"}},
+			{Public: testPublic2, AllowedIPs: []string{"10.0.0.2/32"}},
+		}, wantErr: "already used"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &Usecases{}
+			_, _, err := u.importPeers(serv, tt.peers, nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
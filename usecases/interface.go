@@ -8,9 +8,15 @@ import (
 
 type ServerRepo interface {
 	CreateServerCert(cert *db.ServerCert) error
+	ImportServer(serv *db.ServerCert, certs []db.ClientCert, apply func() error) error
+	UpdateServer(ifname string, values map[string]interface{}, render func(cert db.ClientCert) (string, error), apply func() error) ([]db.ClientCert, error)
 	GetServerCertByIfname(ifname string) (db.ServerCert, error)
 	DeleteServer(private, ifname string) error
-	GetServerArchive() ([]db.ArchiveServerCert, error)
+	GetServerArchive(page db.Page) ([]db.ArchiveServerCert, int64, error)
+	GetArchiveServerById(id uint) (db.ArchiveServerCert, error)
+	RestoreServerCert(archiveId uint, cert *db.ServerCert) error
+	PurgeServerArchive(before time.Time) ([]db.ArchiveServerCert, error)
+	DeleteArchiveServer(id uint) (db.ArchiveServerCert, []db.ArchiveClientCert, error)
 	GetServerInterfaces() ([]db.ServerCert, error)
 	GetServerCertificates() ([]db.ServerCert, error)
 	CreateForward(
@@ -37,10 +43,34 @@ type ClientRepo interface {
 	GetPublicEnpointPort(ifname string) (db.ServerCert, error)
 	GetListIp(ifname string) ([]string, error)
 	CreateClientCert(cert *db.ClientCert) error
+	CreateClientCerts(certs []db.ClientCert, apply func() error) error
 	GetAllClient() ([]db.ClientCert, error)
-	DeleteClientCert(public string) (db.ClientCert, error)
-	GetClientArchive() ([]db.ArchiveClientCert, error)
+	FindClients(owner, tag string, page db.Page) ([]db.ClientCert, int64, error)
+	UpdateClientMeta(public, name, owner, email, description, tags string) error
+	DeleteClientCert(public, reason string) (db.ClientCert, error)
+	GetExpiredClients(now time.Time) ([]db.ClientCert, error)
+	GetClientArchive(page db.Page) ([]db.ArchiveClientCert, int64, error)
+	GetArchiveClientById(id uint) (db.ArchiveClientCert, error)
+	GetArchiveClientsOfServer(serverArchiveId uint) ([]db.ArchiveClientCert, error)
+	RestoreClientCert(archiveId uint, cert *db.ClientCert, apply func() error) error
+	PurgeClientArchive(before time.Time) ([]db.ArchiveClientCert, error)
+	DeleteArchiveClient(id uint) (db.ArchiveClientCert, error)
 	GetClientCertsByIfname(ifname string) ([]db.ClientCert, error)
+	SetClientDisabled(public string, disabled bool) (db.ClientCert, error)
+	SetClientQuota(public string, quota int64, period string) (db.ClientCert, error)
+	UpdateClientUsage(cert *db.ClientCert) error
+	SetClientQuotaExceeded(id uint, exceeded bool) (bool, error)
+	ResetClientCounters(ifname string) error
+	GetClientByPublic(public string) (db.ClientCert, error)
+	UpdateClientCert(public string, cert db.ClientCert, withMeta bool, apply func() error) error
+	RotateClientCert(public, newPublic, newPrivate, newPresharedKey, config string, apply func() error) (db.ClientCert, error)
+	GetArchiveClientByPublic(public string) (db.ArchiveClientCert, error)
+
+	CreateProfile(profile *db.RoutingProfile) error
+	GetProfiles() ([]db.RoutingProfile, error)
+	GetProfileByName(name string) (db.RoutingProfile, error)
+	UpdateProfile(name, routes, description string, render func(cert db.ClientCert) (string, error)) ([]db.ClientCert, error)
+	DeleteProfile(name string) error
 }
 
 type IPTables interface {
@@ -70,19 +100,51 @@ type PingService interface {
 	Delete(ip string)
 }
 
+// LinkManager creates and removes links of interfaces and their addresses,
+// errors wrap wg.ErrExists, wg.ErrNoDevice or wg.ErrPermission when the kernel returned them
+type LinkManager interface {
+	AddLink(ifname string) error
+	AddAddress(ifname, cidr string) error
+	SetUp(ifname string) error
+	SetDown(ifname string) error
+	DeleteLink(ifname string) error
+}
+
 type UsecaseService interface {
 	GetStatus() ([]InterfaceListStatus, error)
 
-	GetAllClients() ([]ClientResponse, error)
-	NewClient(ifname, ip, allowed string) (ClientResponse, error)
+	GetAllClients(owner, tag string, opts ListOptions) ([]ClientResponse, int64, error)
+	NewClient(spec ClientSpec) (ClientResponse, error)
+	NewClients(specs []ClientSpec) ([]ClientResponse, error)
+	UpdateClient(public string, ip, allowed, profile *string, settings *ConfigSettings, meta *ClientMeta) (ClientResponse, error)
+	RotateClient(public string) (ClientResponse, error)
 	DeleteClient(public string) error
-	GetClientArchive() ([]ClientResponse, error)
-
-	NewInterface(ifname, ip, endpoint string, port int) (ServerInterfaces, error)
+	DisableClient(public string) error
+	EnableClient(public string) error
+	SetClientQuota(public string, quota int64, period string) error
+	GetClientQR(public, format string, size int) ([]byte, error)
+	GetClientArchive(opts ListOptions) ([]ClientResponse, int64, error)
+	RestoreClient(archiveId uint) (ClientResponse, error)
+	DeleteClientArchive(archiveId uint) error
+
+	GetProfiles() ([]RoutingProfile, error)
+	NewProfile(name string, routes []string, description string) (RoutingProfile, error)
+	UpdateProfile(name string, routes *[]string, description *string) (ProfileUpdate, error)
+	DeleteProfile(name string) error
+
+	NewInterface(ifname, ip, endpoint string, port int, defaultPsk bool, settings ConfigSettings, pools AddressPools) (ServerInterfaces, error)
+	UpdateInterface(ifname string, changes InterfaceChanges) (InterfaceUpdate, error)
+	RotateInterfaceKey(ifname string) (InterfaceUpdate, error)
+	GetDrift() (DriftReport, error)
 	DeleteServer(private, ifname string) error
 	StartInterface(ifname string) error
 	StopInterface(ifname string) error
-	GetServerArchive() ([]ServerInterfaces, error)
+	GetServerArchive(opts ListOptions) ([]ServerInterfaces, int64, error)
+	RestoreInterface(archiveId uint, withClients bool) (RestoredInterface, error)
+	ImportInterface(spec ImportSpec) (ImportedInterface, error)
+	DeleteServerArchive(archiveId uint) error
+	ExportInterface(ifname string) ([]byte, error)
+	GetServerConfig(ifname string) (string, error)
 	GetServerInterfaces() ([]ServerInterfaces, error)
 
 	SetUsForward(
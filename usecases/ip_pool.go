@@ -0,0 +1,269 @@
+package usecases
+
+import (
+	"fmt"
+	"strings"
+	"wireguard_api/db"
+
+	"inet.af/netaddr"
+)
+
+// ipFamily keeps free addresses of one address family of interface
+type ipFamily struct {
+	prefix netaddr.IPPrefix // address of server with mask
+	free   []netaddr.IPRange
+}
+
+// ipPool keeps free addresses of interface. It is made once per request from the addresses
+// of all clients, so allocation does not scan the subnet address by address.
+type ipPool struct {
+	ifname   string
+	families []*ipFamily
+	used     map[netaddr.IP]struct{}
+	// network, broadcast and server addresses, they are never given to clients
+	blocked map[netaddr.IP]struct{}
+}
+
+// parsePoolEntry parses range "a-b", single address or subnet.
+func parsePoolEntry(entry string) (netaddr.IPRange, error) {
+	switch {
+	case strings.Contains(entry, "-"):
+		r, err := netaddr.ParseIPRange(entry)
+		if err != nil {
+			return netaddr.IPRange{}, fmt.Errorf("invalid range %s: %v", entry, err)
+		}
+		return r, nil
+	case strings.Contains(entry, "/"):
+		prefix, err := netaddr.ParseIPPrefix(entry)
+		if err != nil {
+			return netaddr.IPRange{}, fmt.Errorf("invalid subnet %s: %v", entry, err)
+		}
+		return prefix.Masked().Range(), nil
+	default:
+		ip, err := netaddr.ParseIP(entry)
+		if err != nil {
+			return netaddr.IPRange{}, fmt.Errorf("invalid address %s: %v", entry, err)
+		}
+		return netaddr.IPRangeFrom(ip, ip), nil
+	}
+}
+
+// normalizePoolEntries checks that every entry is inside one of subnets of server
+// and returns comma separated list of entries without repeats.
+func normalizePoolEntries(serverIp string, entries []string) (string, error) {
+	var subnets []netaddr.IPPrefix
+	for _, v := range splitIps(serverIp) {
+		prefix, err := netaddr.ParseIPPrefix(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid CIDR format: %v", err)
+		}
+		subnets = append(subnets, prefix.Masked())
+	}
+	var list []string
+	seen := make(map[string]struct{})
+	for _, v := range entries {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		r, err := parsePoolEntry(v)
+		if err != nil {
+			return "", err
+		}
+		inside := false
+		for _, subnet := range subnets {
+			if subnet.Contains(r.From()) && subnet.Contains(r.To()) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			return "", fmt.Errorf("%s is outside of interface subnets %s", v, serverIp)
+		}
+		if r.From() == r.To() {
+			v = r.From().String()
+		} else if prefix, ok := r.Prefix(); ok && strings.Contains(v, "/") {
+			v = prefix.String()
+		} else {
+			v = r.String()
+		}
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		list = append(list, v)
+	}
+	return strings.Join(list, ","), nil
+}
+
+// normalizePools checks pools and excluded addresses of interface with address serverIp.
+func normalizePools(serverIp string, pools AddressPools) (string, string, error) {
+	normalPools, err := normalizePoolEntries(serverIp, pools.Pools)
+	if err != nil {
+		return "", "", fmt.Errorf("pools: %w", err)
+	}
+	normalExcluded, err := normalizePoolEntries(serverIp, pools.Excluded)
+	if err != nil {
+		return "", "", fmt.Errorf("excluded: %w", err)
+	}
+	return normalPools, normalExcluded, nil
+}
+
+// newIpPool makes pool of interface from pools and excluded addresses of server,
+// addresses of listIp are used by clients.
+func newIpPool(serv db.ServerCert, listIp []string) (*ipPool, error) {
+	pool := &ipPool{
+		ifname:  serv.Ifname,
+		used:    make(map[netaddr.IP]struct{}, len(listIp)),
+		blocked: make(map[netaddr.IP]struct{}),
+	}
+	for _, ips := range listIp {
+		for _, v := range splitIps(ips) {
+			prefix, err := netaddr.ParseIPPrefix(v)
+			if err != nil {
+				continue
+			}
+			pool.used[prefix.IP()] = struct{}{}
+		}
+	}
+	var ranges, excluded []netaddr.IPRange
+	for _, v := range splitIps(serv.Pools) {
+		r, err := parsePoolEntry(v)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	for _, v := range splitIps(serv.Excluded) {
+		r, err := parsePoolEntry(v)
+		if err != nil {
+			return nil, err
+		}
+		excluded = append(excluded, r)
+	}
+
+	for _, v := range splitIps(serv.Ip) {
+		prefix, err := netaddr.ParseIPPrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR format: %v", err)
+		}
+		subnet := prefix.Masked()
+		var b netaddr.IPSetBuilder
+		inPools := false
+		for _, r := range ranges {
+			if subnet.Contains(r.From()) {
+				b.AddRange(r)
+				inPools = true
+			}
+		}
+		if !inPools {
+			b.AddPrefix(subnet)
+		}
+
+		pool.blocked[prefix.IP()] = struct{}{}
+		if (prefix.IP().Is4() && subnet.Bits() < 31) || (prefix.IP().Is6() && subnet.Bits() < 127) {
+			pool.blocked[subnet.IP()] = struct{}{}
+			if prefix.IP().Is4() {
+				pool.blocked[subnet.Range().To()] = struct{}{}
+			}
+		}
+		for ip := range pool.blocked {
+			b.Remove(ip)
+		}
+		for _, r := range excluded {
+			b.RemoveRange(r)
+		}
+		for ip := range pool.used {
+			if subnet.Contains(ip) {
+				b.Remove(ip)
+			}
+		}
+		set, err := b.IPSet()
+		if err != nil {
+			return nil, err
+		}
+		pool.families = append(pool.families, &ipFamily{prefix: prefix, free: set.Ranges()})
+	}
+	return pool, nil
+}
+
+// reserve marks addresses of ip as used, addresses from own list are allowed.
+// Addresses outside of pools or excluded can be taken only this way.
+func (p *ipPool) reserve(ip, own string) error {
+	ownSet := make(map[string]struct{})
+	for _, v := range splitIps(own) {
+		ownSet[v] = struct{}{}
+	}
+	for _, v := range splitIps(ip) {
+		prefix, err := netaddr.ParseIPPrefix(v)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR format: %v", err)
+		}
+		if _, ok := p.blocked[prefix.IP()]; ok {
+			return fmt.Errorf("ip %s is network, broadcast or server address of interface %s", v, p.ifname)
+		}
+		_, isOwn := ownSet[v]
+		_, isUsed := p.used[prefix.IP()]
+		if isUsed && !isOwn {
+			return fmt.Errorf("ip %s already used by another client", v)
+		}
+		p.used[prefix.IP()] = struct{}{}
+	}
+	return nil
+}
+
+// complete allocates a free address for every family of the interface
+// that is not set in ip.
+func (p *ipPool) complete(ip string) (string, error) {
+	ip4, ip6, err := splitFamilies(ip)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range p.families {
+		if f.prefix.IP().Is4() && ip4 == "" {
+			ip4, err = p.allocate(f)
+		} else if f.prefix.IP().Is6() && ip6 == "" {
+			ip6, err = p.allocate(f)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return joinIps(ip4, ip6), nil
+}
+
+// allocate takes first free address of family.
+func (p *ipPool) allocate(f *ipFamily) (string, error) {
+	for len(f.free) > 0 {
+		r := f.free[0]
+		ip := r.From()
+		if ip == r.To() {
+			f.free = f.free[1:]
+		} else {
+			f.free[0] = netaddr.IPRangeFrom(ip.Next(), r.To())
+		}
+		if _, ok := p.used[ip]; ok {
+			continue
+		}
+		p.used[ip] = struct{}{}
+		return netaddr.IPPrefixFrom(ip, f.prefix.Bits()).String(), nil
+	}
+	return "", fmt.Errorf("cannot find free ip for interface %s subnet %s", p.ifname, f.prefix.Masked())
+}
+
+// loadPool returns pool of interface from pools, pool is made on first use.
+func (u *Usecases) loadPool(pools map[string]*ipPool, serv db.ServerCert) (*ipPool, error) {
+	if pool, ok := pools[serv.Ifname]; ok {
+		return pool, nil
+	}
+	listIp, err := u.ClientRepo.GetListIp(serv.Ifname)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := newIpPool(serv, listIp)
+	if err != nil {
+		return nil, err
+	}
+	pools[serv.Ifname] = pool
+	return pool, nil
+}
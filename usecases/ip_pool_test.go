@@ -0,0 +1,189 @@
+package usecases
+
+import (
+	"fmt"
+	"testing"
+	"wireguard_api/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIpPool(t *testing.T) {
+	tests := []struct {
+		name    string
+		serv    db.ServerCert
+		listIp  []string
+		want    []string // addresses given by complete("") one after another
+		wantErr string   // error of the next complete
+	}{
+		{name: "first free address", serv: db.ServerCert{Ip: "10.0.0.1/24"}, want: []string{"10.0.0.2/24", "10.0.0.3/24"}},
+		{name: "server in the middle", serv: db.ServerCert{Ip: "10.0.0.2/29"}, want: []string{"10.0.0.1/29", "10.0.0.3/29"}},
+		{name: "addresses of clients are skipped", serv: db.ServerCert{Ip: "10.0.0.1/24"}, listIp: []string{"10.0.0.2/24", "10.0.0.4/24,fd00::4/64", "bad"}, want: []string{"10.0.0.3/24", "10.0.0.5/24"}},
+		{name: "network and broadcast are excluded", serv: db.ServerCert{Ip: "10.0.0.1/30"}, want: []string{"10.0.0.2/30"}, wantErr: "cannot find free ip"},
+		{name: "point to point subnet", serv: db.ServerCert{Ip: "10.0.0.0/31"}, want: []string{"10.0.0.1/31"}, wantErr: "cannot find free ip"},
+		{name: "v6 only", serv: db.ServerCert{Ip: "fd00::1/64"}, want: []string{"fd00::2/64", "fd00::3/64"}},
+		{name: "v6 has no broadcast", serv: db.ServerCert{Ip: "fd00::1/126"}, want: []string{"fd00::2/126", "fd00::3/126"}, wantErr: "cannot find free ip"},
+		{name: "dual-stack", serv: db.ServerCert{Ip: "10.0.0.1/24,fd00::1/64"}, listIp: []string{"10.0.0.2/24,fd00::2/64"}, want: []string{"10.0.0.3/24,fd00::3/64"}},
+		{name: "pool", serv: db.ServerCert{Ip: "10.0.0.1/24", Pools: "10.0.0.100-10.0.0.101"}, want: []string{"10.0.0.100/24", "10.0.0.101/24"}, wantErr: "cannot find free ip"},
+		{name: "pool and excluded", serv: db.ServerCert{Ip: "10.0.0.1/24", Pools: "10.0.0.96/30", Excluded: "10.0.0.97,10.0.0.98"}, want: []string{"10.0.0.96/24", "10.0.0.99/24"}, wantErr: "cannot find free ip"},
+		{name: "pool of other family keeps whole subnet", serv: db.ServerCert{Ip: "10.0.0.1/24,fd00::1/64", Pools: "fd00::100-fd00::101"}, want: []string{"10.0.0.2/24,fd00::100/64"}},
+		{name: "excluded subnet", serv: db.ServerCert{Ip: "10.0.0.1/24", Excluded: "10.0.0.0/25"}, want: []string{"10.0.0.128/24"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.serv.Ifname = "wg0"
+			pool, err := newIpPool(tt.serv, tt.listIp)
+			require.NoError(t, err)
+			for _, want := range tt.want {
+				got, err := pool.complete("")
+				require.NoError(t, err)
+				assert.Equal(t, want, got)
+			}
+			if tt.wantErr != "" {
+				_, err := pool.complete("")
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewIpPoolErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		serv db.ServerCert
+	}{
+		{name: "bad address of server", serv: db.ServerCert{Ip: "10.0.0.1"}},
+		{name: "bad pool", serv: db.ServerCert{Ip: "10.0.0.1/24", Pools: "10.0.0.300"}},
+		{name: "bad excluded", serv: db.ServerCert{Ip: "10.0.0.1/24", Excluded: "10.0.0.5-x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newIpPool(tt.serv, nil)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestIpPoolReserve(t *testing.T) {
+	tests := []struct {
+		name    string
+		ip      string
+		own     string
+		wantErr string
+	}{
+		{name: "free address", ip: "10.0.0.5/24"},
+		{name: "excluded address", ip: "10.0.0.100/24"},
+		{name: "dual-stack", ip: "10.0.0.5/24,fd00::5/64"},
+		{name: "network", ip: "10.0.0.0/24", wantErr: "network, broadcast or server address"},
+		{name: "broadcast", ip: "10.0.0.255/24", wantErr: "network, broadcast or server address"},
+		{name: "server", ip: "fd00::1/64", wantErr: "network, broadcast or server address"},
+		{name: "v6 network", ip: "fd00::/64", wantErr: "network, broadcast or server address"},
+		{name: "used by another client", ip: "10.0.0.2/24", wantErr: "already used"},
+		{name: "own address", ip: "10.0.0.2/24", own: "10.0.0.2/24,fd00::2/64"},
+		{name: "bad address", ip: "10.0.0.5", wantErr: "invalid CIDR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv := db.ServerCert{Ifname: "wg0", Ip: "10.0.0.1/24,fd00::1/64", Excluded: "10.0.0.100"}
+			pool, err := newIpPool(serv, []string{"10.0.0.2/24,fd00::2/64"})
+			require.NoError(t, err)
+			err = pool.reserve(tt.ip, tt.own)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			// reserved address is not given by complete
+			ip, err := pool.complete("")
+			require.NoError(t, err)
+			assert.NotContains(t, splitIps(ip), tt.ip)
+		})
+	}
+}
+
+func TestIpPoolComplete(t *testing.T) {
+	tests := []struct {
+		name    string
+		ip      string
+		want    string
+		wantErr bool
+	}{
+		{name: "both families", want: "10.0.0.2/24,fd00::2/64"},
+		{name: "v4 is set", ip: "10.0.0.9/24", want: "10.0.0.9/24,fd00::2/64"},
+		{name: "v6 is set", ip: "fd00::9/64", want: "10.0.0.2/24,fd00::9/64"},
+		{name: "both are set", ip: "10.0.0.9/24,fd00::9/64", want: "10.0.0.9/24,fd00::9/64"},
+		{name: "two v4", ip: "10.0.0.9/24,10.0.0.8/24", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := newIpPool(db.ServerCert{Ifname: "wg0", Ip: "10.0.0.1/24,fd00::1/64"}, nil)
+			require.NoError(t, err)
+			got, err := pool.complete(tt.ip)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNormalizePoolEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		serverIp string
+		entries  []string
+		want     string
+		wantErr  string
+	}{
+		{name: "empty", serverIp: "10.0.0.1/24", entries: []string{"", " "}},
+		{name: "address", serverIp: "10.0.0.1/24", entries: []string{" 10.0.0.5 "}, want: "10.0.0.5"},
+		{name: "range", serverIp: "10.0.0.1/24", entries: []string{"10.0.0.5-10.0.0.9"}, want: "10.0.0.5-10.0.0.9"},
+		{name: "range of one address", serverIp: "10.0.0.1/24", entries: []string{"10.0.0.5-10.0.0.5"}, want: "10.0.0.5"},
+		{name: "subnet with host bits", serverIp: "10.0.0.1/24", entries: []string{"10.0.0.7/28"}, want: "10.0.0.0/28"},
+		{name: "repeats", serverIp: "10.0.0.1/24", entries: []string{"10.0.0.5", "10.0.0.5-10.0.0.5", "10.0.0.16/28", "10.0.0.20/28"}, want: "10.0.0.5,10.0.0.16/28"},
+		{name: "dual-stack", serverIp: "10.0.0.1/24,fd00::1/64", entries: []string{"10.0.0.5", "fd00::10-fd00::20"}, want: "10.0.0.5,fd00::10-fd00::20"},
+		{name: "outside", serverIp: "10.0.0.1/24", entries: []string{"10.0.1.5"}, wantErr: "outside of interface subnets"},
+		{name: "range across subnet", serverIp: "10.0.0.1/24", entries: []string{"10.0.0.250-10.0.1.5"}, wantErr: "outside of interface subnets"},
+		{name: "v6 on v4 only interface", serverIp: "10.0.0.1/24", entries: []string{"fd00::5"}, wantErr: "outside of interface subnets"},
+		{name: "bad address", serverIp: "10.0.0.1/24", entries: []string{"10.0.0.300"}, wantErr: "invalid address"},
+		{name: "bad range", serverIp: "10.0.0.1/24", entries: []string{"10.0.0.9-10.0.0.5"}, wantErr: "invalid range"},
+		{name: "bad subnet", serverIp: "10.0.0.1/24", entries: []string{"10.0.0.0/33"}, wantErr: "invalid subnet"},
+		{name: "bad address of server", serverIp: "10.0.0.1", entries: []string{"10.0.0.5"}, wantErr: "invalid CIDR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizePoolEntries(tt.serverIp, tt.entries)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// BenchmarkIpPool makes pool of /16 interface with 50000 clients and allocates address of new client
+func BenchmarkIpPool(b *testing.B) {
+	serv := db.ServerCert{Ifname: "wg0", Ip: "10.1.0.1/16"}
+	listIp := make([]string, 0, 50000)
+	for i := 2; len(listIp) < cap(listIp); i++ {
+		listIp = append(listIp, fmt.Sprintf("10.1.%d.%d/16", i/256, i%256))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pool, err := newIpPool(serv, listIp)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := pool.complete(""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,1584 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: usecases/interface.go
+
+// Package usecases is a generated GoMock package.
+package usecases
+
+import (
+	reflect "reflect"
+	sync "sync"
+	time "time"
+	db "wireguard_api/db"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockServerRepo is a mock of ServerRepo interface.
+type MockServerRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockServerRepoMockRecorder
+}
+
+// MockServerRepoMockRecorder is the mock recorder for MockServerRepo.
+type MockServerRepoMockRecorder struct {
+	mock *MockServerRepo
+}
+
+// NewMockServerRepo creates a new mock instance.
+func NewMockServerRepo(ctrl *gomock.Controller) *MockServerRepo {
+	mock := &MockServerRepo{ctrl: ctrl}
+	mock.recorder = &MockServerRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockServerRepo) EXPECT() *MockServerRepoMockRecorder {
+	return m.recorder
+}
+
+// CreateForward mocks base method.
+func (m *MockServerRepo) CreateForward(position int, port, action, source, destination, protocol, comment string, isList, except bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateForward", position, port, action, source, destination, protocol, comment, isList, except)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateForward indicates an expected call of CreateForward.
+func (mr *MockServerRepoMockRecorder) CreateForward(position, port, action, source, destination, protocol, comment, isList, except interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateForward", reflect.TypeOf((*MockServerRepo)(nil).CreateForward), position, port, action, source, destination, protocol, comment, isList, except)
+}
+
+// CreateMasquerade mocks base method.
+func (m *MockServerRepo) CreateMasquerade(source, ifname, comment string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMasquerade", source, ifname, comment)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateMasquerade indicates an expected call of CreateMasquerade.
+func (mr *MockServerRepoMockRecorder) CreateMasquerade(source, ifname, comment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMasquerade", reflect.TypeOf((*MockServerRepo)(nil).CreateMasquerade), source, ifname, comment)
+}
+
+// CreateServerCert mocks base method.
+func (m *MockServerRepo) CreateServerCert(cert *db.ServerCert) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateServerCert", cert)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateServerCert indicates an expected call of CreateServerCert.
+func (mr *MockServerRepoMockRecorder) CreateServerCert(cert interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateServerCert", reflect.TypeOf((*MockServerRepo)(nil).CreateServerCert), cert)
+}
+
+// DeleteArchiveServer mocks base method.
+func (m *MockServerRepo) DeleteArchiveServer(id uint) (db.ArchiveServerCert, []db.ArchiveClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteArchiveServer", id)
+	ret0, _ := ret[0].(db.ArchiveServerCert)
+	ret1, _ := ret[1].([]db.ArchiveClientCert)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// DeleteArchiveServer indicates an expected call of DeleteArchiveServer.
+func (mr *MockServerRepoMockRecorder) DeleteArchiveServer(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteArchiveServer", reflect.TypeOf((*MockServerRepo)(nil).DeleteArchiveServer), id)
+}
+
+// DeleteForward mocks base method.
+func (m *MockServerRepo) DeleteForward(comment string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteForward", comment)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteForward indicates an expected call of DeleteForward.
+func (mr *MockServerRepoMockRecorder) DeleteForward(comment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteForward", reflect.TypeOf((*MockServerRepo)(nil).DeleteForward), comment)
+}
+
+// DeleteMasquerade mocks base method.
+func (m *MockServerRepo) DeleteMasquerade(source, ifname, comment string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMasquerade", source, ifname, comment)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMasquerade indicates an expected call of DeleteMasquerade.
+func (mr *MockServerRepoMockRecorder) DeleteMasquerade(source, ifname, comment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMasquerade", reflect.TypeOf((*MockServerRepo)(nil).DeleteMasquerade), source, ifname, comment)
+}
+
+// DeleteServer mocks base method.
+func (m *MockServerRepo) DeleteServer(private, ifname string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteServer", private, ifname)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteServer indicates an expected call of DeleteServer.
+func (mr *MockServerRepoMockRecorder) DeleteServer(private, ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteServer", reflect.TypeOf((*MockServerRepo)(nil).DeleteServer), private, ifname)
+}
+
+// GetArchiveServerById mocks base method.
+func (m *MockServerRepo) GetArchiveServerById(id uint) (db.ArchiveServerCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetArchiveServerById", id)
+	ret0, _ := ret[0].(db.ArchiveServerCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetArchiveServerById indicates an expected call of GetArchiveServerById.
+func (mr *MockServerRepoMockRecorder) GetArchiveServerById(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetArchiveServerById", reflect.TypeOf((*MockServerRepo)(nil).GetArchiveServerById), id)
+}
+
+// GetForward mocks base method.
+func (m *MockServerRepo) GetForward() ([]db.Forward, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetForward")
+	ret0, _ := ret[0].([]db.Forward)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetForward indicates an expected call of GetForward.
+func (mr *MockServerRepoMockRecorder) GetForward() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetForward", reflect.TypeOf((*MockServerRepo)(nil).GetForward))
+}
+
+// GetMasquerade mocks base method.
+func (m *MockServerRepo) GetMasquerade() ([]db.Masquerade, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMasquerade")
+	ret0, _ := ret[0].([]db.Masquerade)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMasquerade indicates an expected call of GetMasquerade.
+func (mr *MockServerRepoMockRecorder) GetMasquerade() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMasquerade", reflect.TypeOf((*MockServerRepo)(nil).GetMasquerade))
+}
+
+// GetServerArchive mocks base method.
+func (m *MockServerRepo) GetServerArchive(page db.Page) ([]db.ArchiveServerCert, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetServerArchive", page)
+	ret0, _ := ret[0].([]db.ArchiveServerCert)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetServerArchive indicates an expected call of GetServerArchive.
+func (mr *MockServerRepoMockRecorder) GetServerArchive(page interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServerArchive", reflect.TypeOf((*MockServerRepo)(nil).GetServerArchive), page)
+}
+
+// GetServerCertByIfname mocks base method.
+func (m *MockServerRepo) GetServerCertByIfname(ifname string) (db.ServerCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetServerCertByIfname", ifname)
+	ret0, _ := ret[0].(db.ServerCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetServerCertByIfname indicates an expected call of GetServerCertByIfname.
+func (mr *MockServerRepoMockRecorder) GetServerCertByIfname(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServerCertByIfname", reflect.TypeOf((*MockServerRepo)(nil).GetServerCertByIfname), ifname)
+}
+
+// GetServerCertificates mocks base method.
+func (m *MockServerRepo) GetServerCertificates() ([]db.ServerCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetServerCertificates")
+	ret0, _ := ret[0].([]db.ServerCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetServerCertificates indicates an expected call of GetServerCertificates.
+func (mr *MockServerRepoMockRecorder) GetServerCertificates() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServerCertificates", reflect.TypeOf((*MockServerRepo)(nil).GetServerCertificates))
+}
+
+// GetServerInterfaces mocks base method.
+func (m *MockServerRepo) GetServerInterfaces() ([]db.ServerCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetServerInterfaces")
+	ret0, _ := ret[0].([]db.ServerCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetServerInterfaces indicates an expected call of GetServerInterfaces.
+func (mr *MockServerRepoMockRecorder) GetServerInterfaces() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServerInterfaces", reflect.TypeOf((*MockServerRepo)(nil).GetServerInterfaces))
+}
+
+// ImportServer mocks base method.
+func (m *MockServerRepo) ImportServer(serv *db.ServerCert, certs []db.ClientCert, apply func() error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportServer", serv, certs, apply)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ImportServer indicates an expected call of ImportServer.
+func (mr *MockServerRepoMockRecorder) ImportServer(serv, certs, apply interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportServer", reflect.TypeOf((*MockServerRepo)(nil).ImportServer), serv, certs, apply)
+}
+
+// PurgeServerArchive mocks base method.
+func (m *MockServerRepo) PurgeServerArchive(before time.Time) ([]db.ArchiveServerCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeServerArchive", before)
+	ret0, _ := ret[0].([]db.ArchiveServerCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeServerArchive indicates an expected call of PurgeServerArchive.
+func (mr *MockServerRepoMockRecorder) PurgeServerArchive(before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeServerArchive", reflect.TypeOf((*MockServerRepo)(nil).PurgeServerArchive), before)
+}
+
+// RestoreServerCert mocks base method.
+func (m *MockServerRepo) RestoreServerCert(archiveId uint, cert *db.ServerCert) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreServerCert", archiveId, cert)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreServerCert indicates an expected call of RestoreServerCert.
+func (mr *MockServerRepoMockRecorder) RestoreServerCert(archiveId, cert interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreServerCert", reflect.TypeOf((*MockServerRepo)(nil).RestoreServerCert), archiveId, cert)
+}
+
+// UpdateServer mocks base method.
+func (m *MockServerRepo) UpdateServer(ifname string, values map[string]interface{}, render func(db.ClientCert) (string, error), apply func() error) ([]db.ClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateServer", ifname, values, render, apply)
+	ret0, _ := ret[0].([]db.ClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateServer indicates an expected call of UpdateServer.
+func (mr *MockServerRepoMockRecorder) UpdateServer(ifname, values, render, apply interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateServer", reflect.TypeOf((*MockServerRepo)(nil).UpdateServer), ifname, values, render, apply)
+}
+
+// MockClientRepo is a mock of ClientRepo interface.
+type MockClientRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockClientRepoMockRecorder
+}
+
+// MockClientRepoMockRecorder is the mock recorder for MockClientRepo.
+type MockClientRepoMockRecorder struct {
+	mock *MockClientRepo
+}
+
+// NewMockClientRepo creates a new mock instance.
+func NewMockClientRepo(ctrl *gomock.Controller) *MockClientRepo {
+	mock := &MockClientRepo{ctrl: ctrl}
+	mock.recorder = &MockClientRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockClientRepo) EXPECT() *MockClientRepoMockRecorder {
+	return m.recorder
+}
+
+// CreateClientCert mocks base method.
+func (m *MockClientRepo) CreateClientCert(cert *db.ClientCert) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateClientCert", cert)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateClientCert indicates an expected call of CreateClientCert.
+func (mr *MockClientRepoMockRecorder) CreateClientCert(cert interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateClientCert", reflect.TypeOf((*MockClientRepo)(nil).CreateClientCert), cert)
+}
+
+// CreateClientCerts mocks base method.
+func (m *MockClientRepo) CreateClientCerts(certs []db.ClientCert, apply func() error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateClientCerts", certs, apply)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateClientCerts indicates an expected call of CreateClientCerts.
+func (mr *MockClientRepoMockRecorder) CreateClientCerts(certs, apply interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateClientCerts", reflect.TypeOf((*MockClientRepo)(nil).CreateClientCerts), certs, apply)
+}
+
+// CreateProfile mocks base method.
+func (m *MockClientRepo) CreateProfile(profile *db.RoutingProfile) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateProfile", profile)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateProfile indicates an expected call of CreateProfile.
+func (mr *MockClientRepoMockRecorder) CreateProfile(profile interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateProfile", reflect.TypeOf((*MockClientRepo)(nil).CreateProfile), profile)
+}
+
+// DeleteArchiveClient mocks base method.
+func (m *MockClientRepo) DeleteArchiveClient(id uint) (db.ArchiveClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteArchiveClient", id)
+	ret0, _ := ret[0].(db.ArchiveClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteArchiveClient indicates an expected call of DeleteArchiveClient.
+func (mr *MockClientRepoMockRecorder) DeleteArchiveClient(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteArchiveClient", reflect.TypeOf((*MockClientRepo)(nil).DeleteArchiveClient), id)
+}
+
+// DeleteClientCert mocks base method.
+func (m *MockClientRepo) DeleteClientCert(public, reason string) (db.ClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteClientCert", public, reason)
+	ret0, _ := ret[0].(db.ClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteClientCert indicates an expected call of DeleteClientCert.
+func (mr *MockClientRepoMockRecorder) DeleteClientCert(public, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteClientCert", reflect.TypeOf((*MockClientRepo)(nil).DeleteClientCert), public, reason)
+}
+
+// DeleteProfile mocks base method.
+func (m *MockClientRepo) DeleteProfile(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteProfile", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteProfile indicates an expected call of DeleteProfile.
+func (mr *MockClientRepoMockRecorder) DeleteProfile(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProfile", reflect.TypeOf((*MockClientRepo)(nil).DeleteProfile), name)
+}
+
+// FindClients mocks base method.
+func (m *MockClientRepo) FindClients(owner, tag string, page db.Page) ([]db.ClientCert, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindClients", owner, tag, page)
+	ret0, _ := ret[0].([]db.ClientCert)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// FindClients indicates an expected call of FindClients.
+func (mr *MockClientRepoMockRecorder) FindClients(owner, tag, page interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindClients", reflect.TypeOf((*MockClientRepo)(nil).FindClients), owner, tag, page)
+}
+
+// GetAllClient mocks base method.
+func (m *MockClientRepo) GetAllClient() ([]db.ClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllClient")
+	ret0, _ := ret[0].([]db.ClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllClient indicates an expected call of GetAllClient.
+func (mr *MockClientRepoMockRecorder) GetAllClient() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllClient", reflect.TypeOf((*MockClientRepo)(nil).GetAllClient))
+}
+
+// GetArchiveClientById mocks base method.
+func (m *MockClientRepo) GetArchiveClientById(id uint) (db.ArchiveClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetArchiveClientById", id)
+	ret0, _ := ret[0].(db.ArchiveClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetArchiveClientById indicates an expected call of GetArchiveClientById.
+func (mr *MockClientRepoMockRecorder) GetArchiveClientById(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetArchiveClientById", reflect.TypeOf((*MockClientRepo)(nil).GetArchiveClientById), id)
+}
+
+// GetArchiveClientByPublic mocks base method.
+func (m *MockClientRepo) GetArchiveClientByPublic(public string) (db.ArchiveClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetArchiveClientByPublic", public)
+	ret0, _ := ret[0].(db.ArchiveClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetArchiveClientByPublic indicates an expected call of GetArchiveClientByPublic.
+func (mr *MockClientRepoMockRecorder) GetArchiveClientByPublic(public interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetArchiveClientByPublic", reflect.TypeOf((*MockClientRepo)(nil).GetArchiveClientByPublic), public)
+}
+
+// GetArchiveClientsOfServer mocks base method.
+func (m *MockClientRepo) GetArchiveClientsOfServer(serverArchiveId uint) ([]db.ArchiveClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetArchiveClientsOfServer", serverArchiveId)
+	ret0, _ := ret[0].([]db.ArchiveClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetArchiveClientsOfServer indicates an expected call of GetArchiveClientsOfServer.
+func (mr *MockClientRepoMockRecorder) GetArchiveClientsOfServer(serverArchiveId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetArchiveClientsOfServer", reflect.TypeOf((*MockClientRepo)(nil).GetArchiveClientsOfServer), serverArchiveId)
+}
+
+// GetClientArchive mocks base method.
+func (m *MockClientRepo) GetClientArchive(page db.Page) ([]db.ArchiveClientCert, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClientArchive", page)
+	ret0, _ := ret[0].([]db.ArchiveClientCert)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetClientArchive indicates an expected call of GetClientArchive.
+func (mr *MockClientRepoMockRecorder) GetClientArchive(page interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClientArchive", reflect.TypeOf((*MockClientRepo)(nil).GetClientArchive), page)
+}
+
+// GetClientByPublic mocks base method.
+func (m *MockClientRepo) GetClientByPublic(public string) (db.ClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClientByPublic", public)
+	ret0, _ := ret[0].(db.ClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetClientByPublic indicates an expected call of GetClientByPublic.
+func (mr *MockClientRepoMockRecorder) GetClientByPublic(public interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClientByPublic", reflect.TypeOf((*MockClientRepo)(nil).GetClientByPublic), public)
+}
+
+// GetClientCertsByIfname mocks base method.
+func (m *MockClientRepo) GetClientCertsByIfname(ifname string) ([]db.ClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClientCertsByIfname", ifname)
+	ret0, _ := ret[0].([]db.ClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetClientCertsByIfname indicates an expected call of GetClientCertsByIfname.
+func (mr *MockClientRepoMockRecorder) GetClientCertsByIfname(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClientCertsByIfname", reflect.TypeOf((*MockClientRepo)(nil).GetClientCertsByIfname), ifname)
+}
+
+// GetExpiredClients mocks base method.
+func (m *MockClientRepo) GetExpiredClients(now time.Time) ([]db.ClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExpiredClients", now)
+	ret0, _ := ret[0].([]db.ClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExpiredClients indicates an expected call of GetExpiredClients.
+func (mr *MockClientRepoMockRecorder) GetExpiredClients(now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpiredClients", reflect.TypeOf((*MockClientRepo)(nil).GetExpiredClients), now)
+}
+
+// GetListIp mocks base method.
+func (m *MockClientRepo) GetListIp(ifname string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetListIp", ifname)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetListIp indicates an expected call of GetListIp.
+func (mr *MockClientRepoMockRecorder) GetListIp(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetListIp", reflect.TypeOf((*MockClientRepo)(nil).GetListIp), ifname)
+}
+
+// GetProfileByName mocks base method.
+func (m *MockClientRepo) GetProfileByName(name string) (db.RoutingProfile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfileByName", name)
+	ret0, _ := ret[0].(db.RoutingProfile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfileByName indicates an expected call of GetProfileByName.
+func (mr *MockClientRepoMockRecorder) GetProfileByName(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfileByName", reflect.TypeOf((*MockClientRepo)(nil).GetProfileByName), name)
+}
+
+// GetProfiles mocks base method.
+func (m *MockClientRepo) GetProfiles() ([]db.RoutingProfile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfiles")
+	ret0, _ := ret[0].([]db.RoutingProfile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfiles indicates an expected call of GetProfiles.
+func (mr *MockClientRepoMockRecorder) GetProfiles() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfiles", reflect.TypeOf((*MockClientRepo)(nil).GetProfiles))
+}
+
+// GetPublicEnpointPort mocks base method.
+func (m *MockClientRepo) GetPublicEnpointPort(ifname string) (db.ServerCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPublicEnpointPort", ifname)
+	ret0, _ := ret[0].(db.ServerCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPublicEnpointPort indicates an expected call of GetPublicEnpointPort.
+func (mr *MockClientRepoMockRecorder) GetPublicEnpointPort(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPublicEnpointPort", reflect.TypeOf((*MockClientRepo)(nil).GetPublicEnpointPort), ifname)
+}
+
+// PurgeClientArchive mocks base method.
+func (m *MockClientRepo) PurgeClientArchive(before time.Time) ([]db.ArchiveClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeClientArchive", before)
+	ret0, _ := ret[0].([]db.ArchiveClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeClientArchive indicates an expected call of PurgeClientArchive.
+func (mr *MockClientRepoMockRecorder) PurgeClientArchive(before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeClientArchive", reflect.TypeOf((*MockClientRepo)(nil).PurgeClientArchive), before)
+}
+
+// ResetClientCounters mocks base method.
+func (m *MockClientRepo) ResetClientCounters(ifname string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetClientCounters", ifname)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetClientCounters indicates an expected call of ResetClientCounters.
+func (mr *MockClientRepoMockRecorder) ResetClientCounters(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetClientCounters", reflect.TypeOf((*MockClientRepo)(nil).ResetClientCounters), ifname)
+}
+
+// RestoreClientCert mocks base method.
+func (m *MockClientRepo) RestoreClientCert(archiveId uint, cert *db.ClientCert, apply func() error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreClientCert", archiveId, cert, apply)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreClientCert indicates an expected call of RestoreClientCert.
+func (mr *MockClientRepoMockRecorder) RestoreClientCert(archiveId, cert, apply interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreClientCert", reflect.TypeOf((*MockClientRepo)(nil).RestoreClientCert), archiveId, cert, apply)
+}
+
+// RotateClientCert mocks base method.
+func (m *MockClientRepo) RotateClientCert(public, newPublic, newPrivate, newPresharedKey, config string, apply func() error) (db.ClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateClientCert", public, newPublic, newPrivate, newPresharedKey, config, apply)
+	ret0, _ := ret[0].(db.ClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateClientCert indicates an expected call of RotateClientCert.
+func (mr *MockClientRepoMockRecorder) RotateClientCert(public, newPublic, newPrivate, newPresharedKey, config, apply interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateClientCert", reflect.TypeOf((*MockClientRepo)(nil).RotateClientCert), public, newPublic, newPrivate, newPresharedKey, config, apply)
+}
+
+// SetClientDisabled mocks base method.
+func (m *MockClientRepo) SetClientDisabled(public string, disabled bool) (db.ClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetClientDisabled", public, disabled)
+	ret0, _ := ret[0].(db.ClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetClientDisabled indicates an expected call of SetClientDisabled.
+func (mr *MockClientRepoMockRecorder) SetClientDisabled(public, disabled interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetClientDisabled", reflect.TypeOf((*MockClientRepo)(nil).SetClientDisabled), public, disabled)
+}
+
+// SetClientQuota mocks base method.
+func (m *MockClientRepo) SetClientQuota(public string, quota int64, period string) (db.ClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetClientQuota", public, quota, period)
+	ret0, _ := ret[0].(db.ClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetClientQuota indicates an expected call of SetClientQuota.
+func (mr *MockClientRepoMockRecorder) SetClientQuota(public, quota, period interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetClientQuota", reflect.TypeOf((*MockClientRepo)(nil).SetClientQuota), public, quota, period)
+}
+
+// SetClientQuotaExceeded mocks base method.
+func (m *MockClientRepo) SetClientQuotaExceeded(id uint, exceeded bool) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetClientQuotaExceeded", id, exceeded)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetClientQuotaExceeded indicates an expected call of SetClientQuotaExceeded.
+func (mr *MockClientRepoMockRecorder) SetClientQuotaExceeded(id, exceeded interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetClientQuotaExceeded", reflect.TypeOf((*MockClientRepo)(nil).SetClientQuotaExceeded), id, exceeded)
+}
+
+// UpdateClientCert mocks base method.
+func (m *MockClientRepo) UpdateClientCert(public string, cert db.ClientCert, withMeta bool, apply func() error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateClientCert", public, cert, withMeta, apply)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateClientCert indicates an expected call of UpdateClientCert.
+func (mr *MockClientRepoMockRecorder) UpdateClientCert(public, cert, withMeta, apply interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateClientCert", reflect.TypeOf((*MockClientRepo)(nil).UpdateClientCert), public, cert, withMeta, apply)
+}
+
+// UpdateClientMeta mocks base method.
+func (m *MockClientRepo) UpdateClientMeta(public, name, owner, email, description, tags string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateClientMeta", public, name, owner, email, description, tags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateClientMeta indicates an expected call of UpdateClientMeta.
+func (mr *MockClientRepoMockRecorder) UpdateClientMeta(public, name, owner, email, description, tags interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateClientMeta", reflect.TypeOf((*MockClientRepo)(nil).UpdateClientMeta), public, name, owner, email, description, tags)
+}
+
+// UpdateClientUsage mocks base method.
+func (m *MockClientRepo) UpdateClientUsage(cert *db.ClientCert) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateClientUsage", cert)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateClientUsage indicates an expected call of UpdateClientUsage.
+func (mr *MockClientRepoMockRecorder) UpdateClientUsage(cert interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateClientUsage", reflect.TypeOf((*MockClientRepo)(nil).UpdateClientUsage), cert)
+}
+
+// UpdateProfile mocks base method.
+func (m *MockClientRepo) UpdateProfile(name, routes, description string, render func(db.ClientCert) (string, error)) ([]db.ClientCert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProfile", name, routes, description, render)
+	ret0, _ := ret[0].([]db.ClientCert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateProfile indicates an expected call of UpdateProfile.
+func (mr *MockClientRepoMockRecorder) UpdateProfile(name, routes, description, render interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProfile", reflect.TypeOf((*MockClientRepo)(nil).UpdateProfile), name, routes, description, render)
+}
+
+// MockIPTables is a mock of IPTables interface.
+type MockIPTables struct {
+	ctrl     *gomock.Controller
+	recorder *MockIPTablesMockRecorder
+}
+
+// MockIPTablesMockRecorder is the mock recorder for MockIPTables.
+type MockIPTablesMockRecorder struct {
+	mock *MockIPTables
+}
+
+// NewMockIPTables creates a new mock instance.
+func NewMockIPTables(ctrl *gomock.Controller) *MockIPTables {
+	mock := &MockIPTables{ctrl: ctrl}
+	mock.recorder = &MockIPTablesMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIPTables) EXPECT() *MockIPTablesMockRecorder {
+	return m.recorder
+}
+
+// FlushForward mocks base method.
+func (m *MockIPTables) FlushForward() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FlushForward")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FlushForward indicates an expected call of FlushForward.
+func (mr *MockIPTablesMockRecorder) FlushForward() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FlushForward", reflect.TypeOf((*MockIPTables)(nil).FlushForward))
+}
+
+// GetForwardList mocks base method.
+func (m *MockIPTables) GetForwardList() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetForwardList")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetForwardList indicates an expected call of GetForwardList.
+func (mr *MockIPTablesMockRecorder) GetForwardList() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetForwardList", reflect.TypeOf((*MockIPTables)(nil).GetForwardList))
+}
+
+// GetMasqueradeList mocks base method.
+func (m *MockIPTables) GetMasqueradeList() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMasqueradeList")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMasqueradeList indicates an expected call of GetMasqueradeList.
+func (mr *MockIPTablesMockRecorder) GetMasqueradeList() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMasqueradeList", reflect.TypeOf((*MockIPTables)(nil).GetMasqueradeList))
+}
+
+// SetForward mocks base method.
+func (m *MockIPTables) SetForward(position int, port, action, command, source, destination, protocol, comment string, except bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetForward", position, port, action, command, source, destination, protocol, comment, except)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetForward indicates an expected call of SetForward.
+func (mr *MockIPTablesMockRecorder) SetForward(position, port, action, command, source, destination, protocol, comment, except interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetForward", reflect.TypeOf((*MockIPTables)(nil).SetForward), position, port, action, command, source, destination, protocol, comment, except)
+}
+
+// SetForwardList mocks base method.
+func (m *MockIPTables) SetForwardList(position int, port, action, command, source, destination, protocol, comment string, except bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetForwardList", position, port, action, command, source, destination, protocol, comment, except)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetForwardList indicates an expected call of SetForwardList.
+func (mr *MockIPTablesMockRecorder) SetForwardList(position, port, action, command, source, destination, protocol, comment, except interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetForwardList", reflect.TypeOf((*MockIPTables)(nil).SetForwardList), position, port, action, command, source, destination, protocol, comment, except)
+}
+
+// SetMasquerade mocks base method.
+func (m *MockIPTables) SetMasquerade(command, subnet, ifname, comment string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMasquerade", command, subnet, ifname, comment)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetMasquerade indicates an expected call of SetMasquerade.
+func (mr *MockIPTablesMockRecorder) SetMasquerade(command, subnet, ifname, comment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMasquerade", reflect.TypeOf((*MockIPTables)(nil).SetMasquerade), command, subnet, ifname, comment)
+}
+
+// MockPingService is a mock of PingService interface.
+type MockPingService struct {
+	ctrl     *gomock.Controller
+	recorder *MockPingServiceMockRecorder
+}
+
+// MockPingServiceMockRecorder is the mock recorder for MockPingService.
+type MockPingServiceMockRecorder struct {
+	mock *MockPingService
+}
+
+// NewMockPingService creates a new mock instance.
+func NewMockPingService(ctrl *gomock.Controller) *MockPingService {
+	mock := &MockPingService{ctrl: ctrl}
+	mock.recorder = &MockPingServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPingService) EXPECT() *MockPingServiceMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockPingService) Delete(ip string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Delete", ip)
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockPingServiceMockRecorder) Delete(ip interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockPingService)(nil).Delete), ip)
+}
+
+// Ping mocks base method.
+func (m *MockPingService) Ping(target string, wg *sync.WaitGroup) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Ping", target, wg)
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockPingServiceMockRecorder) Ping(target, wg interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockPingService)(nil).Ping), target, wg)
+}
+
+// Read mocks base method.
+func (m *MockPingService) Read(ip string) (bool, time.Duration) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Read", ip)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(time.Duration)
+	return ret0, ret1
+}
+
+// Read indicates an expected call of Read.
+func (mr *MockPingServiceMockRecorder) Read(ip interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockPingService)(nil).Read), ip)
+}
+
+// MockLinkManager is a mock of LinkManager interface.
+type MockLinkManager struct {
+	ctrl     *gomock.Controller
+	recorder *MockLinkManagerMockRecorder
+}
+
+// MockLinkManagerMockRecorder is the mock recorder for MockLinkManager.
+type MockLinkManagerMockRecorder struct {
+	mock *MockLinkManager
+}
+
+// NewMockLinkManager creates a new mock instance.
+func NewMockLinkManager(ctrl *gomock.Controller) *MockLinkManager {
+	mock := &MockLinkManager{ctrl: ctrl}
+	mock.recorder = &MockLinkManagerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLinkManager) EXPECT() *MockLinkManagerMockRecorder {
+	return m.recorder
+}
+
+// AddAddress mocks base method.
+func (m *MockLinkManager) AddAddress(ifname, cidr string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddAddress", ifname, cidr)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddAddress indicates an expected call of AddAddress.
+func (mr *MockLinkManagerMockRecorder) AddAddress(ifname, cidr interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAddress", reflect.TypeOf((*MockLinkManager)(nil).AddAddress), ifname, cidr)
+}
+
+// AddLink mocks base method.
+func (m *MockLinkManager) AddLink(ifname string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddLink", ifname)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddLink indicates an expected call of AddLink.
+func (mr *MockLinkManagerMockRecorder) AddLink(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddLink", reflect.TypeOf((*MockLinkManager)(nil).AddLink), ifname)
+}
+
+// DeleteLink mocks base method.
+func (m *MockLinkManager) DeleteLink(ifname string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteLink", ifname)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteLink indicates an expected call of DeleteLink.
+func (mr *MockLinkManagerMockRecorder) DeleteLink(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLink", reflect.TypeOf((*MockLinkManager)(nil).DeleteLink), ifname)
+}
+
+// SetDown mocks base method.
+func (m *MockLinkManager) SetDown(ifname string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDown", ifname)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDown indicates an expected call of SetDown.
+func (mr *MockLinkManagerMockRecorder) SetDown(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDown", reflect.TypeOf((*MockLinkManager)(nil).SetDown), ifname)
+}
+
+// SetUp mocks base method.
+func (m *MockLinkManager) SetUp(ifname string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUp", ifname)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUp indicates an expected call of SetUp.
+func (mr *MockLinkManagerMockRecorder) SetUp(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUp", reflect.TypeOf((*MockLinkManager)(nil).SetUp), ifname)
+}
+
+// MockUsecaseService is a mock of UsecaseService interface.
+type MockUsecaseService struct {
+	ctrl     *gomock.Controller
+	recorder *MockUsecaseServiceMockRecorder
+}
+
+// MockUsecaseServiceMockRecorder is the mock recorder for MockUsecaseService.
+type MockUsecaseServiceMockRecorder struct {
+	mock *MockUsecaseService
+}
+
+// NewMockUsecaseService creates a new mock instance.
+func NewMockUsecaseService(ctrl *gomock.Controller) *MockUsecaseService {
+	mock := &MockUsecaseService{ctrl: ctrl}
+	mock.recorder = &MockUsecaseServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUsecaseService) EXPECT() *MockUsecaseServiceMockRecorder {
+	return m.recorder
+}
+
+// DeleteClient mocks base method.
+func (m *MockUsecaseService) DeleteClient(public string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteClient", public)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteClient indicates an expected call of DeleteClient.
+func (mr *MockUsecaseServiceMockRecorder) DeleteClient(public interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteClient", reflect.TypeOf((*MockUsecaseService)(nil).DeleteClient), public)
+}
+
+// DeleteClientArchive mocks base method.
+func (m *MockUsecaseService) DeleteClientArchive(archiveId uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteClientArchive", archiveId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteClientArchive indicates an expected call of DeleteClientArchive.
+func (mr *MockUsecaseServiceMockRecorder) DeleteClientArchive(archiveId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteClientArchive", reflect.TypeOf((*MockUsecaseService)(nil).DeleteClientArchive), archiveId)
+}
+
+// DeleteProfile mocks base method.
+func (m *MockUsecaseService) DeleteProfile(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteProfile", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteProfile indicates an expected call of DeleteProfile.
+func (mr *MockUsecaseServiceMockRecorder) DeleteProfile(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProfile", reflect.TypeOf((*MockUsecaseService)(nil).DeleteProfile), name)
+}
+
+// DeleteServer mocks base method.
+func (m *MockUsecaseService) DeleteServer(private, ifname string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteServer", private, ifname)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteServer indicates an expected call of DeleteServer.
+func (mr *MockUsecaseServiceMockRecorder) DeleteServer(private, ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteServer", reflect.TypeOf((*MockUsecaseService)(nil).DeleteServer), private, ifname)
+}
+
+// DeleteServerArchive mocks base method.
+func (m *MockUsecaseService) DeleteServerArchive(archiveId uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteServerArchive", archiveId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteServerArchive indicates an expected call of DeleteServerArchive.
+func (mr *MockUsecaseServiceMockRecorder) DeleteServerArchive(archiveId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteServerArchive", reflect.TypeOf((*MockUsecaseService)(nil).DeleteServerArchive), archiveId)
+}
+
+// DisableClient mocks base method.
+func (m *MockUsecaseService) DisableClient(public string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableClient", public)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableClient indicates an expected call of DisableClient.
+func (mr *MockUsecaseServiceMockRecorder) DisableClient(public interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableClient", reflect.TypeOf((*MockUsecaseService)(nil).DisableClient), public)
+}
+
+// EnableClient mocks base method.
+func (m *MockUsecaseService) EnableClient(public string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableClient", public)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableClient indicates an expected call of EnableClient.
+func (mr *MockUsecaseServiceMockRecorder) EnableClient(public interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableClient", reflect.TypeOf((*MockUsecaseService)(nil).EnableClient), public)
+}
+
+// ExportInterface mocks base method.
+func (m *MockUsecaseService) ExportInterface(ifname string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportInterface", ifname)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportInterface indicates an expected call of ExportInterface.
+func (mr *MockUsecaseServiceMockRecorder) ExportInterface(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportInterface", reflect.TypeOf((*MockUsecaseService)(nil).ExportInterface), ifname)
+}
+
+// GetAllClients mocks base method.
+func (m *MockUsecaseService) GetAllClients(owner, tag string, opts ListOptions) ([]ClientResponse, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllClients", owner, tag, opts)
+	ret0, _ := ret[0].([]ClientResponse)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetAllClients indicates an expected call of GetAllClients.
+func (mr *MockUsecaseServiceMockRecorder) GetAllClients(owner, tag, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllClients", reflect.TypeOf((*MockUsecaseService)(nil).GetAllClients), owner, tag, opts)
+}
+
+// GetClientArchive mocks base method.
+func (m *MockUsecaseService) GetClientArchive(opts ListOptions) ([]ClientResponse, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClientArchive", opts)
+	ret0, _ := ret[0].([]ClientResponse)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetClientArchive indicates an expected call of GetClientArchive.
+func (mr *MockUsecaseServiceMockRecorder) GetClientArchive(opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClientArchive", reflect.TypeOf((*MockUsecaseService)(nil).GetClientArchive), opts)
+}
+
+// GetClientQR mocks base method.
+func (m *MockUsecaseService) GetClientQR(public, format string, size int) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClientQR", public, format, size)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetClientQR indicates an expected call of GetClientQR.
+func (mr *MockUsecaseServiceMockRecorder) GetClientQR(public, format, size interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClientQR", reflect.TypeOf((*MockUsecaseService)(nil).GetClientQR), public, format, size)
+}
+
+// GetDrift mocks base method.
+func (m *MockUsecaseService) GetDrift() (DriftReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDrift")
+	ret0, _ := ret[0].(DriftReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDrift indicates an expected call of GetDrift.
+func (mr *MockUsecaseServiceMockRecorder) GetDrift() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDrift", reflect.TypeOf((*MockUsecaseService)(nil).GetDrift))
+}
+
+// GetIptablesRules mocks base method.
+func (m *MockUsecaseService) GetIptablesRules() (IptablesRulesData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIptablesRules")
+	ret0, _ := ret[0].(IptablesRulesData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetIptablesRules indicates an expected call of GetIptablesRules.
+func (mr *MockUsecaseServiceMockRecorder) GetIptablesRules() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIptablesRules", reflect.TypeOf((*MockUsecaseService)(nil).GetIptablesRules))
+}
+
+// GetProfiles mocks base method.
+func (m *MockUsecaseService) GetProfiles() ([]RoutingProfile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfiles")
+	ret0, _ := ret[0].([]RoutingProfile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfiles indicates an expected call of GetProfiles.
+func (mr *MockUsecaseServiceMockRecorder) GetProfiles() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfiles", reflect.TypeOf((*MockUsecaseService)(nil).GetProfiles))
+}
+
+// GetServerArchive mocks base method.
+func (m *MockUsecaseService) GetServerArchive(opts ListOptions) ([]ServerInterfaces, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetServerArchive", opts)
+	ret0, _ := ret[0].([]ServerInterfaces)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetServerArchive indicates an expected call of GetServerArchive.
+func (mr *MockUsecaseServiceMockRecorder) GetServerArchive(opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServerArchive", reflect.TypeOf((*MockUsecaseService)(nil).GetServerArchive), opts)
+}
+
+// GetServerConfig mocks base method.
+func (m *MockUsecaseService) GetServerConfig(ifname string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetServerConfig", ifname)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetServerConfig indicates an expected call of GetServerConfig.
+func (mr *MockUsecaseServiceMockRecorder) GetServerConfig(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServerConfig", reflect.TypeOf((*MockUsecaseService)(nil).GetServerConfig), ifname)
+}
+
+// GetServerInterfaces mocks base method.
+func (m *MockUsecaseService) GetServerInterfaces() ([]ServerInterfaces, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetServerInterfaces")
+	ret0, _ := ret[0].([]ServerInterfaces)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetServerInterfaces indicates an expected call of GetServerInterfaces.
+func (mr *MockUsecaseServiceMockRecorder) GetServerInterfaces() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServerInterfaces", reflect.TypeOf((*MockUsecaseService)(nil).GetServerInterfaces))
+}
+
+// GetStatus mocks base method.
+func (m *MockUsecaseService) GetStatus() ([]InterfaceListStatus, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStatus")
+	ret0, _ := ret[0].([]InterfaceListStatus)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStatus indicates an expected call of GetStatus.
+func (mr *MockUsecaseServiceMockRecorder) GetStatus() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStatus", reflect.TypeOf((*MockUsecaseService)(nil).GetStatus))
+}
+
+// ImportInterface mocks base method.
+func (m *MockUsecaseService) ImportInterface(spec ImportSpec) (ImportedInterface, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportInterface", spec)
+	ret0, _ := ret[0].(ImportedInterface)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImportInterface indicates an expected call of ImportInterface.
+func (mr *MockUsecaseServiceMockRecorder) ImportInterface(spec interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportInterface", reflect.TypeOf((*MockUsecaseService)(nil).ImportInterface), spec)
+}
+
+// NewClient mocks base method.
+func (m *MockUsecaseService) NewClient(spec ClientSpec) (ClientResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewClient", spec)
+	ret0, _ := ret[0].(ClientResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewClient indicates an expected call of NewClient.
+func (mr *MockUsecaseServiceMockRecorder) NewClient(spec interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewClient", reflect.TypeOf((*MockUsecaseService)(nil).NewClient), spec)
+}
+
+// NewClients mocks base method.
+func (m *MockUsecaseService) NewClients(specs []ClientSpec) ([]ClientResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewClients", specs)
+	ret0, _ := ret[0].([]ClientResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewClients indicates an expected call of NewClients.
+func (mr *MockUsecaseServiceMockRecorder) NewClients(specs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewClients", reflect.TypeOf((*MockUsecaseService)(nil).NewClients), specs)
+}
+
+// NewInterface mocks base method.
+func (m *MockUsecaseService) NewInterface(ifname, ip, endpoint string, port int, defaultPsk bool, settings ConfigSettings, pools AddressPools) (ServerInterfaces, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewInterface", ifname, ip, endpoint, port, defaultPsk, settings, pools)
+	ret0, _ := ret[0].(ServerInterfaces)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewInterface indicates an expected call of NewInterface.
+func (mr *MockUsecaseServiceMockRecorder) NewInterface(ifname, ip, endpoint, port, defaultPsk, settings, pools interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewInterface", reflect.TypeOf((*MockUsecaseService)(nil).NewInterface), ifname, ip, endpoint, port, defaultPsk, settings, pools)
+}
+
+// NewProfile mocks base method.
+func (m *MockUsecaseService) NewProfile(name string, routes []string, description string) (RoutingProfile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewProfile", name, routes, description)
+	ret0, _ := ret[0].(RoutingProfile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewProfile indicates an expected call of NewProfile.
+func (mr *MockUsecaseServiceMockRecorder) NewProfile(name, routes, description interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewProfile", reflect.TypeOf((*MockUsecaseService)(nil).NewProfile), name, routes, description)
+}
+
+// RestoreClient mocks base method.
+func (m *MockUsecaseService) RestoreClient(archiveId uint) (ClientResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreClient", archiveId)
+	ret0, _ := ret[0].(ClientResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreClient indicates an expected call of RestoreClient.
+func (mr *MockUsecaseServiceMockRecorder) RestoreClient(archiveId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreClient", reflect.TypeOf((*MockUsecaseService)(nil).RestoreClient), archiveId)
+}
+
+// RestoreInterface mocks base method.
+func (m *MockUsecaseService) RestoreInterface(archiveId uint, withClients bool) (RestoredInterface, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreInterface", archiveId, withClients)
+	ret0, _ := ret[0].(RestoredInterface)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreInterface indicates an expected call of RestoreInterface.
+func (mr *MockUsecaseServiceMockRecorder) RestoreInterface(archiveId, withClients interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreInterface", reflect.TypeOf((*MockUsecaseService)(nil).RestoreInterface), archiveId, withClients)
+}
+
+// RotateClient mocks base method.
+func (m *MockUsecaseService) RotateClient(public string) (ClientResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateClient", public)
+	ret0, _ := ret[0].(ClientResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateClient indicates an expected call of RotateClient.
+func (mr *MockUsecaseServiceMockRecorder) RotateClient(public interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateClient", reflect.TypeOf((*MockUsecaseService)(nil).RotateClient), public)
+}
+
+// RotateInterfaceKey mocks base method.
+func (m *MockUsecaseService) RotateInterfaceKey(ifname string) (InterfaceUpdate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateInterfaceKey", ifname)
+	ret0, _ := ret[0].(InterfaceUpdate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateInterfaceKey indicates an expected call of RotateInterfaceKey.
+func (mr *MockUsecaseServiceMockRecorder) RotateInterfaceKey(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateInterfaceKey", reflect.TypeOf((*MockUsecaseService)(nil).RotateInterfaceKey), ifname)
+}
+
+// SetClientQuota mocks base method.
+func (m *MockUsecaseService) SetClientQuota(public string, quota int64, period string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetClientQuota", public, quota, period)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetClientQuota indicates an expected call of SetClientQuota.
+func (mr *MockUsecaseServiceMockRecorder) SetClientQuota(public, quota, period interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetClientQuota", reflect.TypeOf((*MockUsecaseService)(nil).SetClientQuota), public, quota, period)
+}
+
+// SetUsForward mocks base method.
+func (m *MockUsecaseService) SetUsForward(position int, action, command, source, destination, protocol, port, comment string, isList, except bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUsForward", position, action, command, source, destination, protocol, port, comment, isList, except)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUsForward indicates an expected call of SetUsForward.
+func (mr *MockUsecaseServiceMockRecorder) SetUsForward(position, action, command, source, destination, protocol, port, comment, isList, except interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUsForward", reflect.TypeOf((*MockUsecaseService)(nil).SetUsForward), position, action, command, source, destination, protocol, port, comment, isList, except)
+}
+
+// SetUsMasquerade mocks base method.
+func (m *MockUsecaseService) SetUsMasquerade(command, source, ifname, comment string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUsMasquerade", command, source, ifname, comment)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUsMasquerade indicates an expected call of SetUsMasquerade.
+func (mr *MockUsecaseServiceMockRecorder) SetUsMasquerade(command, source, ifname, comment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUsMasquerade", reflect.TypeOf((*MockUsecaseService)(nil).SetUsMasquerade), command, source, ifname, comment)
+}
+
+// StartInterface mocks base method.
+func (m *MockUsecaseService) StartInterface(ifname string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartInterface", ifname)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StartInterface indicates an expected call of StartInterface.
+func (mr *MockUsecaseServiceMockRecorder) StartInterface(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartInterface", reflect.TypeOf((*MockUsecaseService)(nil).StartInterface), ifname)
+}
+
+// StopInterface mocks base method.
+func (m *MockUsecaseService) StopInterface(ifname string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StopInterface", ifname)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StopInterface indicates an expected call of StopInterface.
+func (mr *MockUsecaseServiceMockRecorder) StopInterface(ifname interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopInterface", reflect.TypeOf((*MockUsecaseService)(nil).StopInterface), ifname)
+}
+
+// UpdateClient mocks base method.
+func (m *MockUsecaseService) UpdateClient(public string, ip, allowed, profile *string, settings *ConfigSettings, meta *ClientMeta) (ClientResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateClient", public, ip, allowed, profile, settings, meta)
+	ret0, _ := ret[0].(ClientResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateClient indicates an expected call of UpdateClient.
+func (mr *MockUsecaseServiceMockRecorder) UpdateClient(public, ip, allowed, profile, settings, meta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateClient", reflect.TypeOf((*MockUsecaseService)(nil).UpdateClient), public, ip, allowed, profile, settings, meta)
+}
+
+// UpdateInterface mocks base method.
+func (m *MockUsecaseService) UpdateInterface(ifname string, changes InterfaceChanges) (InterfaceUpdate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateInterface", ifname, changes)
+	ret0, _ := ret[0].(InterfaceUpdate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateInterface indicates an expected call of UpdateInterface.
+func (mr *MockUsecaseServiceMockRecorder) UpdateInterface(ifname, changes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateInterface", reflect.TypeOf((*MockUsecaseService)(nil).UpdateInterface), ifname, changes)
+}
+
+// UpdateIpSetList mocks base method.
+func (m *MockUsecaseService) UpdateIpSetList(command, name string, ipList []string, single bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateIpSetList", command, name, ipList, single)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateIpSetList indicates an expected call of UpdateIpSetList.
+func (mr *MockUsecaseServiceMockRecorder) UpdateIpSetList(command, name, ipList, single interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateIpSetList", reflect.TypeOf((*MockUsecaseService)(nil).UpdateIpSetList), command, name, ipList, single)
+}
+
+// UpdateProfile mocks base method.
+func (m *MockUsecaseService) UpdateProfile(name string, routes *[]string, description *string) (ProfileUpdate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProfile", name, routes, description)
+	ret0, _ := ret[0].(ProfileUpdate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateProfile indicates an expected call of UpdateProfile.
+func (mr *MockUsecaseServiceMockRecorder) UpdateProfile(name, routes, description interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProfile", reflect.TypeOf((*MockUsecaseService)(nil).UpdateProfile), name, routes, description)
+}
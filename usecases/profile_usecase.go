@@ -0,0 +1,139 @@
+package usecases
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"wireguard_api/db"
+)
+
+var profileName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func newRoutingProfile(profile db.RoutingProfile) RoutingProfile {
+	return RoutingProfile{
+		Name:        profile.Name,
+		Routes:      splitIps(profile.Routes),
+		Description: profile.Description,
+		CreatedAt:   timeOf(profile.CreatedAt),
+	}
+}
+
+// normalizeRoutes checks that every route is a subnet and returns comma separated list
+// of subnets without repeats.
+func normalizeRoutes(routes []string) (string, error) {
+	var list []string
+	seen := make(map[string]struct{})
+	for _, v := range routes {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid route %s: %v", v, err)
+		}
+		if _, ok := seen[subnet.String()]; ok {
+			continue
+		}
+		seen[subnet.String()] = struct{}{}
+		list = append(list, subnet.String())
+	}
+	return strings.Join(list, ","), nil
+}
+
+func (u *Usecases) GetProfiles() ([]RoutingProfile, error) {
+	profiles, err := u.ClientRepo.GetProfiles()
+	if err != nil {
+		log.Printf("GetProfiles %v", err)
+		return nil, err
+	}
+	result := make([]RoutingProfile, 0, len(profiles))
+	for _, v := range profiles {
+		result = append(result, newRoutingProfile(v))
+	}
+	return result, nil
+}
+
+func (u *Usecases) NewProfile(name string, routes []string, description string) (RoutingProfile, error) {
+	name = strings.TrimSpace(name)
+	if !profileName.MatchString(name) {
+		return RoutingProfile{}, fmt.Errorf("bad profile name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	if _, err := u.ClientRepo.GetProfileByName(name); err == nil {
+		return RoutingProfile{}, fmt.Errorf("profile %s already exists", name)
+	}
+	normalRoutes, err := normalizeRoutes(routes)
+	if err != nil {
+		return RoutingProfile{}, err
+	}
+	profile := db.RoutingProfile{
+		Name:        name,
+		Routes:      normalRoutes,
+		Description: strings.TrimSpace(description),
+	}
+	err = u.ClientRepo.CreateProfile(&profile)
+	if err != nil {
+		log.Printf("NewProfile %v", err)
+		return RoutingProfile{}, err
+	}
+	return newRoutingProfile(profile), nil
+}
+
+// UpdateProfile changes routes or description of profile and makes new config
+// for every client of the profile, peers on the server are not changed.
+func (u *Usecases) UpdateProfile(name string, routes *[]string, description *string) (ProfileUpdate, error) {
+	name = strings.TrimSpace(name)
+	profile, err := u.ClientRepo.GetProfileByName(name)
+	if err != nil {
+		log.Printf("UpdateProfile %v", err)
+		return ProfileUpdate{}, err
+	}
+	if routes != nil {
+		profile.Routes, err = normalizeRoutes(*routes)
+		if err != nil {
+			return ProfileUpdate{}, err
+		}
+	}
+	if description != nil {
+		profile.Description = strings.TrimSpace(*description)
+	}
+
+	servers, err := u.ServerRepo.GetServerCertificates()
+	if err != nil {
+		log.Printf("UpdateProfile %v", err)
+		return ProfileUpdate{}, err
+	}
+	render := make(map[string]func(cert db.ClientCert) (string, error), len(servers))
+	for _, v := range servers {
+		render[v.Ifname] = u.renderConfig(v, map[string]string{name: profile.Routes})
+	}
+
+	certs, err := u.ClientRepo.UpdateProfile(name, profile.Routes, profile.Description, func(cert db.ClientCert) (string, error) {
+		if render[cert.Ifname] == nil {
+			return "", fmt.Errorf("interface %s not found", cert.Ifname)
+		}
+		return render[cert.Ifname](cert)
+	})
+	if err != nil {
+		log.Printf("UpdateProfile %v", err)
+		return ProfileUpdate{}, err
+	}
+
+	clients := make([]string, 0, len(certs))
+	for _, v := range certs {
+		clients = append(clients, v.Public)
+	}
+	log.Printf("UpdateProfile: profile %s updated, new config of %d clients", name, len(clients))
+	return ProfileUpdate{RoutingProfile: newRoutingProfile(profile), Clients: clients}, nil
+}
+
+func (u *Usecases) DeleteProfile(name string) error {
+	err := u.ClientRepo.DeleteProfile(strings.TrimSpace(name))
+	if err != nil {
+		log.Printf("DeleteProfile %v", err)
+		return err
+	}
+	return nil
+}
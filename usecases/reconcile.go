@@ -0,0 +1,225 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"wireguard_api/db"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// kinds of drift between database and devices
+const (
+	DriftMissingInterface = "missing_interface"
+	DriftListenPort       = "listen_port"
+	DriftMissingPeer      = "missing_peer"
+	DriftExtraPeer        = "extra_peer"
+	DriftAllowedIps       = "allowed_ips"
+)
+
+// policies of ReconcileLoop
+const (
+	ReconcileReport = "report"
+	ReconcileFix    = "fix"
+)
+
+// ReconcileLoop compares devices with database every ReconcileInterval and fixes the drift
+// when ReconcilePolicy is "fix", interfaces stopped by API are not checked.
+func (u *Usecases) ReconcileLoop(ctx context.Context) {
+	if u.ReconcileInterval <= 0 {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("ReconcileLoop: context done, exiting reconcile loop")
+			return
+		default:
+			report, err := u.reconcile(u.ReconcilePolicy == ReconcileFix)
+			if err != nil {
+				log.Printf("ReconcileLoop: %v", err)
+			}
+			for _, v := range report.Drift {
+				log.Printf("ReconcileLoop: %s", v)
+			}
+		}
+
+		time.Sleep(u.ReconcileInterval)
+	}
+}
+
+// GetDrift compares devices with database now, nothing is fixed.
+func (u *Usecases) GetDrift() (DriftReport, error) {
+	report, err := u.reconcile(false)
+	if err != nil {
+		log.Printf("GetDrift %v", err)
+		return DriftReport{}, err
+	}
+	return report, nil
+}
+
+func (u *Usecases) reconcile(fix bool) (DriftReport, error) {
+	policy := ReconcileReport
+	if fix {
+		policy = ReconcileFix
+	}
+	// devices are read before database, so peer of client created meanwhile is reported
+	// as missing and added again instead of being removed as extra peer. Requests which change
+	// device before commit hold allocMu, fix waits for them, so it never sees their device
+	// change with the old row of database and never undoes it
+	if fix {
+		u.allocMu.Lock()
+		defer u.allocMu.Unlock()
+	}
+	client, err := wgctrl.New()
+	if err != nil {
+		return DriftReport{}, err
+	}
+	defer client.Close()
+	devices, err := client.Devices()
+	if err != nil {
+		return DriftReport{}, err
+	}
+	servers, err := u.ServerRepo.GetServerCertificates()
+	if err != nil {
+		return DriftReport{}, err
+	}
+	certs, err := u.ClientRepo.GetAllClient()
+	if err != nil {
+		return DriftReport{}, err
+	}
+
+	drift := u.findDrift(servers, certs, devices)
+	if fix {
+		byPublic := make(map[string]db.ClientCert, len(certs))
+		for _, v := range certs {
+			byPublic[v.Public] = v
+		}
+		servByIfname := make(map[string]db.ServerCert, len(servers))
+		for _, v := range servers {
+			servByIfname[v.Ifname] = v
+		}
+		for i := range drift {
+			err := u.fixDrift(drift[i], servByIfname[drift[i].Ifname], byPublic[drift[i].Public])
+			if err != nil {
+				drift[i].Error = err.Error()
+				continue
+			}
+			drift[i].Fixed = true
+		}
+	}
+
+	now := time.Now().UTC()
+	return DriftReport{CheckedAt: &now, Policy: policy, Drift: drift}, nil
+}
+
+// findDrift lists differences of devices from interfaces and enabled clients of database.
+func (u *Usecases) findDrift(servers []db.ServerCert, certs []db.ClientCert, devices []*wgtypes.Device) []Drift {
+	byName := make(map[string]*wgtypes.Device, len(devices))
+	for _, v := range devices {
+		byName[v.Name] = v
+	}
+	clients := make(map[string][]db.ClientCert)
+	for _, v := range certs {
+		if !v.Disabled {
+			clients[v.Ifname] = append(clients[v.Ifname], v)
+		}
+	}
+
+	drift := []Drift{}
+	for _, serv := range servers {
+		if _, ok := u.stopped.Load(serv.Ifname); ok {
+			continue
+		}
+		device, ok := byName[serv.Ifname]
+		if !ok {
+			drift = append(drift, Drift{Ifname: serv.Ifname, Kind: DriftMissingInterface})
+			continue
+		}
+		if device.ListenPort != serv.Port {
+			drift = append(drift, Drift{Ifname: serv.Ifname, Kind: DriftListenPort,
+				Expected: strconv.Itoa(serv.Port), Actual: strconv.Itoa(device.ListenPort)})
+		}
+
+		peers := make(map[string]wgtypes.Peer, len(device.Peers))
+		for _, v := range device.Peers {
+			peers[v.PublicKey.String()] = v
+		}
+		for _, cert := range clients[serv.Ifname] {
+			peer, ok := peers[cert.Public]
+			if !ok {
+				drift = append(drift, Drift{Ifname: serv.Ifname, Public: cert.Public, Kind: DriftMissingPeer})
+				continue
+			}
+			delete(peers, cert.Public)
+			expected, err := u.peerConfig(cert.IP, cert.AllowedIPs, cert.Public, cert.PresharedKey)
+			if err != nil {
+				log.Printf("findDrift %v", err)
+				continue
+			}
+			want, have := ipNetList(expected.AllowedIPs), ipNetList(peer.AllowedIPs)
+			if want != have {
+				drift = append(drift, Drift{Ifname: serv.Ifname, Public: cert.Public, Kind: DriftAllowedIps, Expected: want, Actual: have})
+			}
+		}
+		for public := range peers {
+			drift = append(drift, Drift{Ifname: serv.Ifname, Public: public, Kind: DriftExtraPeer})
+		}
+	}
+	sort.SliceStable(drift, func(i, j int) bool {
+		if drift[i].Ifname != drift[j].Ifname {
+			return drift[i].Ifname < drift[j].Ifname
+		}
+		return drift[i].Public < drift[j].Public
+	})
+	return drift
+}
+
+// ipNetList returns sorted comma separated list of subnets
+func ipNetList(list []net.IPNet) string {
+	result := make([]string, 0, len(list))
+	for _, v := range list {
+		result = append(result, v.String())
+	}
+	sort.Strings(result)
+	return strings.Join(result, ",")
+}
+
+func (u *Usecases) fixDrift(d Drift, serv db.ServerCert, cert db.ClientCert) error {
+	switch d.Kind {
+	case DriftMissingInterface:
+		return u.startInterface(d.Ifname)
+	case DriftListenPort:
+		return u.setListenPort(d.Ifname, serv.Port)
+	case DriftMissingPeer, DriftAllowedIps:
+		return u.setClient(cert.Ifname, cert.IP, cert.AllowedIPs, cert.Public, cert.PresharedKey)
+	case DriftExtraPeer:
+		return u.removePeer(d.Ifname, d.Public)
+	}
+	return fmt.Errorf("unknown kind of drift %s", d.Kind)
+}
+
+func (d Drift) String() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("%s %s", d.Kind, d.Ifname))
+	if d.Public != "" {
+		builder.WriteString(" peer " + d.Public)
+	}
+	if d.Expected != "" || d.Actual != "" {
+		builder.WriteString(fmt.Sprintf(" expected %q actual %q", d.Expected, d.Actual))
+	}
+	if d.Fixed {
+		builder.WriteString(", fixed")
+	} else if d.Error != "" {
+		builder.WriteString(", fix failed: " + d.Error)
+	}
+	return builder.String()
+}
@@ -0,0 +1,167 @@
+package usecases
+
+import (
+	"net"
+	"testing"
+	"time"
+	"wireguard_api/db"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const testPublic2 = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+
+func testPeer(t *testing.T, public string, cidrs ...string) wgtypes.Peer {
+	key, err := wgtypes.ParseKey(public)
+	require.NoError(t, err)
+	peer := wgtypes.Peer{PublicKey: key}
+	for _, v := range cidrs {
+		_, subnet, err := net.ParseCIDR(v)
+		require.NoError(t, err)
+		peer.AllowedIPs = append(peer.AllowedIPs, *subnet)
+	}
+	return peer
+}
+
+func TestFindDrift(t *testing.T) {
+	servers := []db.ServerCert{
+		{Ifname: "wg0", Ip: "10.0.0.1/24", Port: 51820},
+		{Ifname: "wg1", Ip: "10.1.0.1/24,fd01::1/64", Port: 51821},
+	}
+	certs := []db.ClientCert{
+		{Ifname: "wg0", Public: testPublic, IP: "10.0.0.2/24", AllowedIPs: "192.168.5.0/24"},
+		{Ifname: "wg0", Public: testPsk, IP: "10.0.0.3/24", Disabled: true},
+		{Ifname: "wg1", Public: testPublic2, IP: "10.1.0.2/24,fd01::2/64"},
+	}
+	inSync := func(t *testing.T) []*wgtypes.Device {
+		return []*wgtypes.Device{
+			{Name: "wg0", ListenPort: 51820, Peers: []wgtypes.Peer{testPeer(t, testPublic, "192.168.5.0/24", "10.0.0.2/32")}},
+			{Name: "wg1", ListenPort: 51821, Peers: []wgtypes.Peer{testPeer(t, testPublic2, "10.1.0.2/32", "fd01::2/128")}},
+		}
+	}
+	tests := []struct {
+		name    string
+		stopped []string
+		devices func(t *testing.T) []*wgtypes.Device
+		want    []Drift
+	}{
+		{name: "in sync", devices: inSync, want: []Drift{}},
+		{
+			name: "missing interface",
+			devices: func(t *testing.T) []*wgtypes.Device {
+				return inSync(t)[:1]
+			},
+			want: []Drift{{Ifname: "wg1", Kind: DriftMissingInterface}},
+		},
+		{
+			name:    "stopped interface is not checked",
+			stopped: []string{"wg1"},
+			devices: func(t *testing.T) []*wgtypes.Device {
+				return inSync(t)[:1]
+			},
+			want: []Drift{},
+		},
+		{
+			name: "listen port",
+			devices: func(t *testing.T) []*wgtypes.Device {
+				devices := inSync(t)
+				devices[0].ListenPort = 40000
+				return devices
+			},
+			want: []Drift{{Ifname: "wg0", Kind: DriftListenPort, Expected: "51820", Actual: "40000"}},
+		},
+		{
+			name: "missing peer",
+			devices: func(t *testing.T) []*wgtypes.Device {
+				devices := inSync(t)
+				devices[1].Peers = nil
+				return devices
+			},
+			want: []Drift{{Ifname: "wg1", Public: testPublic2, Kind: DriftMissingPeer}},
+		},
+		{
+			name: "peer of disabled client is extra",
+			devices: func(t *testing.T) []*wgtypes.Device {
+				devices := inSync(t)
+				devices[0].Peers = append(devices[0].Peers, testPeer(t, testPsk, "10.0.0.3/32"))
+				return devices
+			},
+			want: []Drift{{Ifname: "wg0", Public: testPsk, Kind: DriftExtraPeer}},
+		},
+		{
+			name: "allowed ips",
+			devices: func(t *testing.T) []*wgtypes.Device {
+				devices := inSync(t)
+				devices[1].Peers = []wgtypes.Peer{testPeer(t, testPublic2, "10.1.0.2/32")}
+				return devices
+			},
+			want: []Drift{{Ifname: "wg1", Public: testPublic2, Kind: DriftAllowedIps, Expected: "10.1.0.2/32,fd01::2/128", Actual: "10.1.0.2/32"}},
+		},
+		{
+			name: "sorted by interface and peer",
+			devices: func(t *testing.T) []*wgtypes.Device {
+				return []*wgtypes.Device{
+					{Name: "wg0", ListenPort: 51820, Peers: []wgtypes.Peer{testPeer(t, testPsk), testPeer(t, testPublic2)}},
+				}
+			},
+			want: []Drift{
+				{Ifname: "wg0", Public: testPublic2, Kind: DriftExtraPeer},
+				{Ifname: "wg0", Public: testPsk, Kind: DriftExtraPeer},
+				{Ifname: "wg0", Public: testPublic, Kind: DriftMissingPeer},
+				{Ifname: "wg1", Kind: DriftMissingInterface},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &Usecases{}
+			for _, v := range tt.stopped {
+				u.stopped.Store(v, struct{}{})
+			}
+			assert.Equal(t, tt.want, u.findDrift(servers, certs, tt.devices(t)))
+		})
+	}
+}
+
+func TestDeleteServerClearsStopped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	serverRepo := NewMockServerRepo(ctrl)
+	serverRepo.EXPECT().DeleteServer("private", "wg0").Return(nil)
+	u := &Usecases{ServerRepo: serverRepo, Links: &fakeLinks{}}
+	u.stopped.Store("wg0", struct{}{})
+
+	require.NoError(t, u.DeleteServer("private", "wg0"))
+	// new interface with the same name is checked again
+	assert.Equal(t, []Drift{{Ifname: "wg0", Kind: DriftMissingInterface}}, u.findDrift([]db.ServerCert{{Ifname: "wg0"}}, nil, nil))
+}
+
+func TestReconcileFixWaitsForDeviceChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	serverRepo := NewMockServerRepo(ctrl)
+	clientRepo := NewMockClientRepo(ctrl)
+	serverRepo.EXPECT().GetServerCertificates().Return(nil, nil).AnyTimes()
+	clientRepo.EXPECT().GetAllClient().Return(nil, nil).AnyTimes()
+	u := &Usecases{ServerRepo: serverRepo, ClientRepo: clientRepo}
+
+	// request which changes device before commit holds allocMu
+	u.allocMu.Lock()
+	done := make(chan struct{})
+	go func() {
+		u.reconcile(true)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("reconcile fixed devices before change of device was committed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	u.allocMu.Unlock()
+	<-done
+}
@@ -1,12 +1,16 @@
 package usecases
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"log"
 	"net"
 	"os/exec"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -17,7 +21,7 @@ import (
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
-func (u *Usecases) NewInterface(ifname, ip, endpoint string, port int) (ServerInterfaces, error) {
+func (u *Usecases) NewInterface(ifname, ip, endpoint string, port int, defaultPsk bool, settings ConfigSettings, pools AddressPools) (ServerInterfaces, error) {
 	ifname = strings.ToLower(strings.TrimSpace(ifname))
 	ip = strings.TrimSpace(ip)
 	endpoint = strings.TrimSpace(endpoint)
@@ -27,6 +31,14 @@ func (u *Usecases) NewInterface(ifname, ip, endpoint string, port int) (ServerIn
 			return ServerInterfaces{}, fmt.Errorf("interface %s already exist", ifname)
 		}
 	}
+	settings, err := normalizeSettings(settings)
+	if err != nil {
+		return ServerInterfaces{}, err
+	}
+	if settings.Keepalive == nil {
+		keepalive := DefaultKeepalive
+		settings.Keepalive = &keepalive
+	}
 
 	privateKey, err := wgtypes.GeneratePrivateKey()
 	if err != nil {
@@ -34,26 +46,41 @@ func (u *Usecases) NewInterface(ifname, ip, endpoint string, port int) (ServerIn
 		return ServerInterfaces{}, err
 	}
 	publicKey := privateKey.PublicKey()
-	_, _, err = net.ParseCIDR(ip)
+	ip4, ip6, err := splitFamilies(ip)
 	if err != nil {
 		log.Printf("NewInterface %v", err)
-		return ServerInterfaces{}, fmt.Errorf("invalid CIDR format: %v", err)
+		return ServerInterfaces{}, err
+	}
+	ip = joinIps(ip4, ip6)
+	if ip == "" {
+		return ServerInterfaces{}, fmt.Errorf("invalid CIDR format: empty ip")
+	}
+	normalPools, normalExcluded, err := normalizePools(ip, pools)
+	if err != nil {
+		return ServerInterfaces{}, err
 	}
 	serverConfig := u.createServerCert(privateKey.String(), ip, port)
 	data := &db.ServerCert{
-		Private:  privateKey.String(),
-		Public:   publicKey.String(),
-		Endpoint: endpoint,
-		Ip:       ip,
-		Ifname:   ifname,
-		Config:   serverConfig,
-		Port:     port,
+		Private:    privateKey.String(),
+		Public:     publicKey.String(),
+		Endpoint:   endpoint,
+		Ip:         ip,
+		Ifname:     ifname,
+		Config:     serverConfig,
+		Port:       port,
+		DefaultPsk: defaultPsk,
+		Dns:        settings.Dns,
+		Mtu:        settings.Mtu,
+		Keepalive:  settings.Keepalive,
+		Pools:      normalPools,
+		Excluded:   normalExcluded,
 	}
 	err = u.ServerRepo.CreateServerCert(data)
 	if err != nil {
 		log.Printf("NewInterface %v", err)
 		return ServerInterfaces{}, err
 	}
+	defer u.syncWgQuick(ifname)
 
 	err = u.startInterface(ifname)
 	if err != nil {
@@ -61,15 +88,227 @@ func (u *Usecases) NewInterface(ifname, ip, endpoint string, port int) (ServerIn
 		return ServerInterfaces{}, err
 	}
 
+	return newServerInterfaces(*data), nil
+}
+
+func newServerInterfaces(cert db.ServerCert) ServerInterfaces {
 	return ServerInterfaces{
-		Private:  privateKey.String(),
-		Public:   publicKey.String(),
-		Endpoint: endpoint,
-		Ip:       ip,
-		Ifname:   ifname,
-		Config:   serverConfig,
-		Port:     port,
-	}, nil
+		ConfigSettings: ConfigSettings{Dns: cert.Dns, Mtu: cert.Mtu, Keepalive: cert.Keepalive},
+		AddressPools:   AddressPools{Pools: splitIps(cert.Pools), Excluded: splitIps(cert.Excluded)},
+		Private:        cert.Private,
+		Public:         cert.Public,
+		Endpoint:       cert.Endpoint,
+		Ip:             cert.Ip,
+		Ifname:         cert.Ifname,
+		Config:         cert.Config,
+		Port:           cert.Port,
+		DefaultPsk:     cert.DefaultPsk,
+	}
+}
+
+var endpointName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// checkEndpoint checks that endpoint is DNS name or IP address without port, IPv6 address may be in brackets
+func checkEndpoint(endpoint string) error {
+	host := endpoint
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	if strings.Contains(host, ":") || host != endpoint {
+		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			return nil
+		}
+	} else if endpointName.MatchString(host) {
+		return nil
+	}
+	return fmt.Errorf("bad endpoint %q, use IP address or DNS name without port", endpoint)
+}
+
+// UpdateInterface changes endpoint, port, settings and address pools of interface and makes
+// new config for every client of interface. New port is set on the running device before commit.
+func (u *Usecases) UpdateInterface(ifname string, changes InterfaceChanges) (InterfaceUpdate, error) {
+	ifname = strings.TrimSpace(ifname)
+	u.allocMu.Lock()
+	defer u.allocMu.Unlock()
+
+	serv, err := u.ServerRepo.GetServerCertByIfname(ifname)
+	if err != nil {
+		log.Printf("UpdateInterface %v", err)
+		return InterfaceUpdate{}, err
+	}
+	settings := ConfigSettings{Dns: serv.Dns, Mtu: serv.Mtu, Keepalive: serv.Keepalive}
+	if changes.Dns != nil {
+		settings.Dns = *changes.Dns
+	}
+	if changes.Mtu != nil {
+		settings.Mtu = *changes.Mtu
+	}
+	if changes.Keepalive != nil {
+		settings.Keepalive = changes.Keepalive
+	}
+	settings, err = normalizeSettings(settings)
+	if err != nil {
+		return InterfaceUpdate{}, err
+	}
+	serv.Dns, serv.Mtu, serv.Keepalive = settings.Dns, settings.Mtu, settings.Keepalive
+
+	if changes.Endpoint != nil {
+		endpoint := strings.TrimSpace(*changes.Endpoint)
+		if err := checkEndpoint(endpoint); err != nil {
+			return InterfaceUpdate{}, err
+		}
+		serv.Endpoint = endpoint
+	}
+	portChanged := changes.Port != nil && *changes.Port != serv.Port
+	if portChanged {
+		if *changes.Port < 1 || *changes.Port > 65535 {
+			return InterfaceUpdate{}, fmt.Errorf("port %d is out of range 1-65535", *changes.Port)
+		}
+		servers, err := u.ServerRepo.GetServerCertificates()
+		if err != nil {
+			log.Printf("UpdateInterface %v", err)
+			return InterfaceUpdate{}, err
+		}
+		for _, v := range servers {
+			if v.Port == *changes.Port {
+				return InterfaceUpdate{}, fmt.Errorf("port %d is used by interface %s", v.Port, v.Ifname)
+			}
+		}
+		serv.Port = *changes.Port
+		serv.Config = u.createServerCert(serv.Private, serv.Ip, serv.Port)
+	}
+
+	// new pools are used for new clients, addresses of current clients stay the same
+	pools := AddressPools{Pools: splitIps(serv.Pools), Excluded: splitIps(serv.Excluded)}
+	if changes.Pools != nil {
+		pools.Pools = *changes.Pools
+	}
+	if changes.Excluded != nil {
+		pools.Excluded = *changes.Excluded
+	}
+	serv.Pools, serv.Excluded, err = normalizePools(serv.Ip, pools)
+	if err != nil {
+		return InterfaceUpdate{}, err
+	}
+	values := map[string]interface{}{
+		"endpoint":  serv.Endpoint,
+		"port":      serv.Port,
+		"config":    serv.Config,
+		"dns":       serv.Dns,
+		"mtu":       serv.Mtu,
+		"keepalive": serv.Keepalive,
+		"pools":     serv.Pools,
+		"excluded":  serv.Excluded,
+	}
+
+	profiles, err := u.profileRoutes()
+	if err != nil {
+		log.Printf("UpdateInterface %v", err)
+		return InterfaceUpdate{}, err
+	}
+	certs, err := u.ServerRepo.UpdateServer(ifname, values, u.renderConfig(serv, profiles), func() error {
+		if !portChanged {
+			return nil
+		}
+		return u.setListenPort(ifname, serv.Port)
+	})
+	if err != nil {
+		log.Printf("UpdateInterface %v", err)
+		return InterfaceUpdate{}, err
+	}
+
+	clients := make([]string, 0, len(certs))
+	for _, v := range certs {
+		clients = append(clients, v.Public)
+	}
+	log.Printf("UpdateInterface: interface %s updated, new config of %d clients", ifname, len(clients))
+	u.syncWgQuick(ifname)
+	return InterfaceUpdate{ServerInterfaces: newServerInterfaces(serv), Clients: clients}, nil
+}
+
+// RotateInterfaceKey makes new key pair of interface and new config for every client of interface,
+// new private key is set on the running device before commit. Clients keep connecting with old
+// config until the device is updated, after that they need the new config.
+func (u *Usecases) RotateInterfaceKey(ifname string) (InterfaceUpdate, error) {
+	ifname = strings.TrimSpace(ifname)
+	u.allocMu.Lock()
+	defer u.allocMu.Unlock()
+
+	serv, err := u.ServerRepo.GetServerCertByIfname(ifname)
+	if err != nil {
+		log.Printf("RotateInterfaceKey %v", err)
+		return InterfaceUpdate{}, err
+	}
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		log.Printf("RotateInterfaceKey %v", err)
+		return InterfaceUpdate{}, err
+	}
+	serv.Private = privateKey.String()
+	serv.Public = privateKey.PublicKey().String()
+	serv.Config = u.createServerCert(serv.Private, serv.Ip, serv.Port)
+	values := map[string]interface{}{
+		"private": serv.Private,
+		"public":  serv.Public,
+		"config":  serv.Config,
+	}
+
+	profiles, err := u.profileRoutes()
+	if err != nil {
+		log.Printf("RotateInterfaceKey %v", err)
+		return InterfaceUpdate{}, err
+	}
+	certs, err := u.ServerRepo.UpdateServer(ifname, values, u.renderConfig(serv, profiles), func() error {
+		return u.setPrivateKey(ifname, privateKey)
+	})
+	if err != nil {
+		log.Printf("RotateInterfaceKey %v", err)
+		return InterfaceUpdate{}, err
+	}
+
+	clients := make([]string, 0, len(certs))
+	for _, v := range certs {
+		clients = append(clients, v.Public)
+	}
+	log.Printf("RotateInterfaceKey: new key of interface %s, new config of %d clients", ifname, len(clients))
+	u.syncWgQuick(ifname)
+	return InterfaceUpdate{ServerInterfaces: newServerInterfaces(serv), Clients: clients}, nil
+}
+
+// setPrivateKey changes key of the running device, stopped interface gets the key on start.
+func (u *Usecases) setPrivateKey(ifname string, key wgtypes.Key) error {
+	if wg.CheckUpInterface(wg.NewWGFactory(), ifname) == nil {
+		return nil
+	}
+	client, err := wgctrl.New()
+	if err != nil {
+		log.Printf("setPrivateKey %v", err)
+		return err
+	}
+	defer client.Close()
+	err = client.ConfigureDevice(ifname, wgtypes.Config{PrivateKey: &key})
+	if err != nil {
+		return fmt.Errorf("cannot set key on interface %s: %w", ifname, err)
+	}
+	return nil
+}
+
+// setListenPort changes port of the running device, stopped interface gets the port on start.
+func (u *Usecases) setListenPort(ifname string, port int) error {
+	if wg.CheckUpInterface(wg.NewWGFactory(), ifname) == nil {
+		return nil
+	}
+	client, err := wgctrl.New()
+	if err != nil {
+		log.Printf("setListenPort %v", err)
+		return err
+	}
+	defer client.Close()
+	err = client.ConfigureDevice(ifname, wgtypes.Config{ListenPort: &port})
+	if err != nil {
+		return fmt.Errorf("cannot set port %d on interface %s: %w", port, ifname, err)
+	}
+	return nil
 }
 
 func (u *Usecases) startInterface(ifname string) error {
@@ -78,32 +317,79 @@ func (u *Usecases) startInterface(ifname string) error {
 		log.Printf("startInterface %v", err)
 		return err
 	}
-	err = exec.Command("ip", "link", "add", "dev", ifname, "type", "wireguard").Run()
+	err = u.upLink(server)
 	if err != nil {
-		log.Printf("startInterface %v", err)
 		return err
 	}
 
-	err = exec.Command("ip", "addr", "add", server.Ip, "dev", ifname).Run()
+	err = u.ClientRepo.ResetClientCounters(ifname)
+	if err != nil {
+		log.Printf("ConfigureDevice %v", err)
+	}
+
+	clients, err := u.ClientRepo.GetClientCertsByIfname(ifname)
+	if err != nil {
+		log.Printf("ConfigureDevice %v", err)
+		return nil
+	}
+	for _, peer := range clients {
+		if peer.Disabled {
+			continue
+		}
+		err := u.setClient(ifname, peer.IP, peer.AllowedIPs, peer.Public, peer.PresharedKey)
+		if err != nil {
+			log.Printf("ConfigureDevice %v", err)
+		}
+	}
+	return nil
+}
+
+func (u *Usecases) stopInterface(ifname string) error {
+	err := u.Links.DeleteLink(ifname)
+	if err != nil {
+		log.Printf("stopInterface %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// upLink creates link of interface with its addresses and sets key and port of the device without peers.
+func (u *Usecases) upLink(server db.ServerCert) error {
+	ifname := server.Ifname
+	err := u.Links.AddLink(ifname)
 	if err != nil {
 		log.Printf("startInterface %v", err)
 		return err
 	}
 
-	err = exec.Command("ip", "link", "set", ifname, "up").Run()
+	for _, addr := range splitIps(server.Ip) {
+		err = u.Links.AddAddress(ifname, addr)
+		if err != nil {
+			log.Printf("startInterface %v", err)
+			u.removeLink(ifname)
+			return err
+		}
+	}
+
+	err = u.Links.SetUp(ifname)
 	if err != nil {
 		log.Printf("startInterface %v", err)
+		u.removeLink(ifname)
 		return err
 	}
 
 	private, err := wgtypes.ParseKey(server.Private)
 	if err != nil {
 		log.Printf("startInterface %v", err)
+		u.removeLink(ifname)
 		return err
 	}
 	serverIntereface, err := wgctrl.New()
 	if err != nil {
 		log.Printf("startInterface %v", err)
+		u.removeLink(ifname)
+		return err
 	}
 	defer serverIntereface.Close()
 
@@ -116,31 +402,60 @@ func (u *Usecases) startInterface(ifname string) error {
 	err = serverIntereface.ConfigureDevice(ifname, cfg)
 	if err != nil {
 		log.Printf("ConfigureDevice %v", err)
+		u.removeLink(ifname)
 		return err
 	}
+	return nil
+}
 
-	clients, err := u.ClientRepo.GetClientCertsByIfname(ifname)
-	if err != nil {
-		log.Printf("ConfigureDevice %v", err)
-		return nil
-	}
-	for _, peer := range clients {
-		err := u.setClient(ifname, peer.IP, peer.AllowedIPs, peer.Public)
-		if err != nil {
-			log.Printf("ConfigureDevice %v", err)
-		}
+// removeLink removes link which was not fully configured, so the next start does not fail with "already exists".
+func (u *Usecases) removeLink(ifname string) {
+	if err := u.Links.DeleteLink(ifname); err != nil {
+		log.Printf("removeLink %v", err)
 	}
-	return nil
 }
 
-func (u *Usecases) stopInterface(ifname string) error {
-	err := exec.Command("ip", "link", "del", "dev", ifname, "type", "wireguard").Run()
+// ExportInterface returns zip archive with config of every client of interface
+// and manifest.csv which lists the files with client keys and addresses.
+func (u *Usecases) ExportInterface(ifname string) ([]byte, error) {
+	ifname = strings.TrimSpace(ifname)
+	if _, err := u.ServerRepo.GetServerCertByIfname(ifname); err != nil {
+		log.Printf("ExportInterface %v", err)
+		return nil, fmt.Errorf("interface %s not found", ifname)
+	}
+	certs, err := u.ClientRepo.GetClientCertsByIfname(ifname)
 	if err != nil {
-		log.Printf("stopInterface %v", err)
-		return err
+		log.Printf("ExportInterface %v", err)
+		return nil, err
+	}
+	clients := make([]ClientResponse, 0, len(certs))
+	for _, cert := range certs {
+		clients = append(clients, newClientResponse(cert))
 	}
 
-	return nil
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	names, err := writeConfigs(archive, clients)
+	if err != nil {
+		return nil, err
+	}
+	file, err := archive.Create("manifest.csv")
+	if err != nil {
+		return nil, err
+	}
+	manifest := csv.NewWriter(file)
+	manifest.Write([]string{"file", "name", "public", "ip", "alloweip", "created_at"})
+	for i, cert := range certs {
+		manifest.Write([]string{names[i], cert.Name, cert.Public, cert.IP, cert.AllowedIPs, cert.CreatedAt.UTC().Format(time.RFC3339)})
+	}
+	manifest.Flush()
+	if err := manifest.Error(); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 func (u *Usecases) createServerCert(private, ip string, listenPort int) string {
@@ -158,16 +473,20 @@ func (u *Usecases) DeleteServer(private, ifname string) error {
 		log.Printf("DeleteServer %v", err)
 		return err
 	}
+	// new interface with the same name is checked by ReconcileLoop
+	u.stopped.Delete(strings.TrimSpace(ifname))
+	defer u.removeWgQuick(strings.TrimSpace(ifname))
+	// stopped interface has no link, it is deleted all the same
 	err = u.stopInterface(ifname)
-	if err != nil {
+	if err != nil && !errors.Is(err, wg.ErrNoDevice) {
 		log.Printf("DeleteServer %v", err)
 		return err
 	}
 	return nil
-
 }
 
 func (u *Usecases) StopInterface(ifname string) error {
+	u.stopped.Store(ifname, struct{}{})
 
 	err := wg.CheckUpInterface(wg.NewWGFactory(), ifname)
 	if err == nil {
@@ -179,6 +498,7 @@ func (u *Usecases) StopInterface(ifname string) error {
 }
 
 func (u *Usecases) StartInterface(ifname string) error {
+	u.stopped.Delete(ifname)
 	err := wg.CheckUpInterface(wg.NewWGFactory(), ifname)
 	if err != nil {
 		if err.Error() == fmt.Sprintf("exist up interface %s", ifname) {
@@ -347,20 +667,64 @@ func (u *Usecases) SetUsMasquerade(command, source, ifname, comment string) erro
 	return nil
 }
 
-func (u *Usecases) GetServerArchive() ([]ServerInterfaces, error) {
-	data, err := u.ServerRepo.GetServerArchive()
+// sort keys and fields of interface archive with columns they are read from
+var (
+	serverArchiveSorts = map[string]string{
+		"ifname":  "ifname",
+		"port":    "port",
+		"created": "created_at",
+		"deleted": "deleted_at",
+	}
+	serverArchiveFields = map[string][]string{
+		"ifname":      {"ifname"},
+		"ip":          {"ip"},
+		"port":        {"port"},
+		"private":     {"private"},
+		"public":      {"public"},
+		"endpoint":    {"endpoint"},
+		"config":      {"config"},
+		"default_psk": {"default_psk"},
+		"dns":         {"dns"},
+		"mtu":         {"mtu"},
+		"keepalive":   {"keepalive"},
+		"pools":       {"pools"},
+		"excluded":    {"excluded"},
+		"created_at":  {"created_at"},
+		"deleted_at":  {"deleted_at"},
+		"archive_id":  {"id"},
+	}
+)
+
+// DefaultServerArchiveFields are fields of interface archive returned when fields are not requested,
+// private key and config are returned only on request
+var DefaultServerArchiveFields = []string{
+	"ifname", "ip", "port", "public", "endpoint", "default_psk", "dns", "mtu", "keepalive", "pools", "excluded",
+	"created_at", "deleted_at", "archive_id",
+}
+
+func (u *Usecases) GetServerArchive(opts ListOptions) ([]ServerInterfaces, int64, error) {
+	if len(opts.Fields) == 0 {
+		opts.Fields = DefaultServerArchiveFields
+	}
+	page, err := listPage(opts, serverArchiveSorts, serverArchiveFields)
+	if err != nil {
+		return []ServerInterfaces{}, 0, err
+	}
+	data, total, err := u.ServerRepo.GetServerArchive(page)
 	if err != nil {
 		log.Printf("GetServerArchive %v", err)
-		return []ServerInterfaces{}, err
+		return []ServerInterfaces{}, 0, err
 	}
 	if len(data) == 0 {
-		return []ServerInterfaces{}, nil
+		return []ServerInterfaces{}, total, nil
 	}
 	var serIfname []ServerInterfaces
 	for _, v := range data {
-		serIfname = append(serIfname, ServerInterfaces{Ifname: v.Ifname, Ip: v.Ip, Port: v.Port, Private: v.Private, Public: v.Public, Endpoint: v.Endpoint})
+		serIfname = append(serIfname, ServerInterfaces{Ifname: v.Ifname, Ip: v.Ip, Port: v.Port, Private: v.Private, Public: v.Public, Endpoint: v.Endpoint, Config: v.Config, DefaultPsk: v.DefaultPsk,
+			ConfigSettings: ConfigSettings{Dns: v.Dns, Mtu: v.Mtu, Keepalive: v.Keepalive},
+			AddressPools:   AddressPools{Pools: splitIps(v.Pools), Excluded: splitIps(v.Excluded)}, CreatedAt: timeOf(v.CreatedAt), DeletedAt: timeOf(v.DeletedAt.Time), ArchiveId: v.ID})
 	}
-	return serIfname, err
+	return serIfname, total, err
 
 }
 
@@ -371,10 +735,9 @@ func (u *Usecases) GetServerInterfaces() ([]ServerInterfaces, error) {
 	}
 	var serIfname []ServerInterfaces
 	for _, v := range data {
-		serIfname = append(serIfname, ServerInterfaces{Ifname: v.Ifname, Ip: v.Ip, Port: v.Port, Private: v.Private, Public: v.Public, Endpoint: v.Endpoint})
+		serIfname = append(serIfname, newServerInterfaces(v))
 	}
 	return serIfname, err
-
 }
 
 func (u *Usecases) StartInterfaces() {
@@ -388,6 +751,7 @@ func (u *Usecases) StartInterfaces() {
 		if err != nil {
 			log.Printf("StartInterfaces %v", err)
 		}
+		u.syncWgQuick(v.Ifname)
 	}
 	clinetData, err := u.ClientRepo.GetAllClient()
 	if err != nil {
@@ -395,7 +759,10 @@ func (u *Usecases) StartInterfaces() {
 		return
 	}
 	for _, v := range clinetData {
-		err := u.setClient(v.Ifname, v.IP, v.AllowedIPs, v.Public)
+		if v.Disabled {
+			continue
+		}
+		err := u.setClient(v.Ifname, v.IP, v.AllowedIPs, v.Public, v.PresharedKey)
 		if err != nil {
 			log.Printf("StartInterfaces %v", err)
 		}
@@ -409,6 +776,7 @@ func (u *Usecases) StopInterfaces() {
 		return
 	}
 	for _, v := range serverData {
+		u.stopped.Store(v.Ifname, struct{}{})
 		err := u.stopInterface(v.Ifname)
 		if err != nil {
 			log.Printf("StopInterfaces %v", err)
@@ -424,6 +792,11 @@ func (u *Usecases) FirstStartIptables() {
 	if err != nil {
 		log.Printf("FirstStartIptables %v", err)
 	}
+	cmd = exec.Command("sysctl", "-w", "net.ipv6.conf.all.forwarding=1")
+	_, err = cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("FirstStartIptables %v", err)
+	}
 	err = u.IpTables.FlushForward()
 	if err != nil {
 		log.Printf("FirstStartIptables %v", err)
@@ -551,10 +924,12 @@ func (u *Usecases) PingLoop(ctx context.Context) {
 			var waitG sync.WaitGroup
 
 			for _, client := range data {
-				ip := strings.Split(client.IP, "/")
-				if len(ip) > 0 {
+				if client.Disabled {
+					continue
+				}
+				if ip := pingIp(client.IP); ip != "" {
 					waitG.Add(1)
-					u.PingStatus.Ping(ip[0], &waitG)
+					u.PingStatus.Ping(ip, &waitG)
 				}
 
 			}
@@ -565,3 +940,163 @@ func (u *Usecases) PingLoop(ctx context.Context) {
 	}
 
 }
+
+func (u *Usecases) ExpireLoop(ctx context.Context) {
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("ExpireLoop: context done, exiting expire loop")
+			return
+		default:
+			data, err := u.ClientRepo.GetExpiredClients(time.Now())
+			if err != nil {
+				log.Printf("ExpireLoop: %v", err)
+				break
+			}
+			for _, client := range data {
+				err := u.deleteClient(client.Public, db.ReasonExpired)
+				if err != nil {
+					log.Printf("ExpireLoop: %v", err)
+					continue
+				}
+				log.Printf("ExpireLoop: client %s %s expired at %s and moved to archive", client.Ifname, client.IP, client.ExpiresAt.Format(time.RFC3339))
+			}
+		}
+
+		time.Sleep(30 * time.Second)
+	}
+
+}
+
+func (u *Usecases) UsageLoop(ctx context.Context) {
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("UsageLoop: context done, exiting usage loop")
+			return
+		default:
+			err := u.accountUsage(time.Now())
+			if err != nil {
+				log.Printf("UsageLoop: %v", err)
+			}
+		}
+
+		time.Sleep(30 * time.Second)
+	}
+
+}
+
+// RestoreInterface creates interface from archive and brings it up, clients which were
+// archived together with the interface are restored when withClients is set.
+func (u *Usecases) RestoreInterface(archiveId uint, withClients bool) (RestoredInterface, error) {
+	arch, err := u.ServerRepo.GetArchiveServerById(archiveId)
+	if err != nil {
+		log.Printf("RestoreInterface %v", err)
+		return RestoredInterface{}, err
+	}
+	for _, v := range u.getInterfaceList() {
+		if arch.Ifname == v {
+			return RestoredInterface{}, fmt.Errorf("interface %s already exist", arch.Ifname)
+		}
+	}
+	var archClients []db.ArchiveClientCert
+	if withClients {
+		// read before interface record is removed from archive
+		archClients, err = u.ClientRepo.GetArchiveClientsOfServer(arch.ID)
+		if err != nil {
+			log.Printf("RestoreInterface %v", err)
+			return RestoredInterface{}, err
+		}
+	}
+
+	cert := &db.ServerCert{
+		Private:    arch.Private,
+		Public:     arch.Public,
+		Endpoint:   arch.Endpoint,
+		Ip:         arch.Ip,
+		Ifname:     arch.Ifname,
+		Config:     arch.Config,
+		Port:       arch.Port,
+		DefaultPsk: arch.DefaultPsk,
+		Dns:        arch.Dns,
+		Mtu:        arch.Mtu,
+		Keepalive:  arch.Keepalive,
+		Pools:      arch.Pools,
+		Excluded:   arch.Excluded,
+	}
+	err = u.ServerRepo.RestoreServerCert(arch.ID, cert)
+	if err != nil {
+		log.Printf("RestoreInterface %v", err)
+		return RestoredInterface{}, err
+	}
+	defer u.syncWgQuick(cert.Ifname)
+	err = u.startInterface(cert.Ifname)
+	if err != nil {
+		log.Printf("RestoreInterface %v", err)
+		return RestoredInterface{}, err
+	}
+	log.Printf("RestoreInterface: interface %s restored from archive", cert.Ifname)
+
+	restored := RestoredInterface{
+		ServerInterfaces: newServerInterfaces(*cert),
+		Clients:          []ClientResponse{},
+	}
+	for _, v := range archClients {
+		client, err := u.restoreClient(v)
+		if err != nil {
+			restored.Failed = append(restored.Failed, RestoreFailure{ArchiveId: v.ID, Public: v.Public, Ip: v.IP, Error: err.Error()})
+			continue
+		}
+		restored.Clients = append(restored.Clients, client)
+	}
+	return restored, nil
+}
+
+func (u *Usecases) DeleteServerArchive(archiveId uint) error {
+	cert, clients, err := u.ServerRepo.DeleteArchiveServer(archiveId)
+	if err != nil {
+		log.Printf("DeleteServerArchive %v", err)
+		return err
+	}
+	for _, v := range clients {
+		log.Printf("DeleteServerArchive: archived client %d %s %s %s removed", v.ID, v.Ifname, v.IP, v.Public)
+	}
+	log.Printf("DeleteServerArchive: archived interface %d %s %s removed", cert.ID, cert.Ifname, cert.Public)
+	return nil
+}
+
+// PurgeLoop removes archived certificates older than ArchiveRetention every hour.
+func (u *Usecases) PurgeLoop(ctx context.Context) {
+	if u.ArchiveRetention <= 0 {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("PurgeLoop: context done, exiting purge loop")
+			return
+		default:
+			before := time.Now().Add(-u.ArchiveRetention)
+			clients, err := u.ClientRepo.PurgeClientArchive(before)
+			if err != nil {
+				log.Printf("PurgeLoop: %v", err)
+			}
+			for _, v := range clients {
+				log.Printf("PurgeLoop: archived client %d %s %s %s removed after retention period", v.ID, v.Ifname, v.IP, v.Public)
+			}
+			servers, err := u.ServerRepo.PurgeServerArchive(before)
+			if err != nil {
+				log.Printf("PurgeLoop: %v", err)
+			}
+			for _, v := range servers {
+				log.Printf("PurgeLoop: archived interface %d %s %s removed after retention period", v.ID, v.Ifname, v.Public)
+			}
+		}
+
+		time.Sleep(time.Hour)
+	}
+
+}
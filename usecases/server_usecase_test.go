@@ -0,0 +1,295 @@
+package usecases
+
+import (
+	"testing"
+	"wireguard_api/db"
+	"wireguard_api/wg"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// stoppedIfname is name of interface which does not exist on the host
+const stoppedIfname = "wgtest-stopped"
+
+func TestServerSubnets(t *testing.T) {
+	tests := []struct {
+		name     string
+		serverIp string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "v4 only", serverIp: "10.0.0.1/24", want: []string{"10.0.0.1/24"}},
+		{name: "v6 only", serverIp: "fd00::1/64", want: []string{"fd00::1/64"}},
+		{name: "dual-stack", serverIp: "10.0.0.1/24, fd00::1/64", want: []string{"10.0.0.1/24", "fd00::1/64"}},
+		{name: "empty", wantErr: true},
+		{name: "no mask", serverIp: "10.0.0.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subnets, err := serverSubnets(tt.serverIp)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			var got []string
+			for _, v := range subnets {
+				got = append(got, v.String())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		wantErr  bool
+	}{
+		{endpoint: "vpn.example.com"},
+		{endpoint: "192.0.2.1"},
+		{endpoint: "2001:db8::1"},
+		{endpoint: "[2001:db8::1]"},
+		{endpoint: "", wantErr: true},
+		{endpoint: "vpn.example.com:51820", wantErr: true},
+		{endpoint: "[2001:db8::1]:51820", wantErr: true},
+		{endpoint: "[192.0.2.1]", wantErr: true},
+		{endpoint: "[vpn.example.com]", wantErr: true},
+		{endpoint: "vpn example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			err := checkEndpoint(tt.endpoint)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// updateServer returns UpdateServer of repository which renders config of certs and applies device change
+func updateServer(certs []db.ClientCert, configs *[]string) func(string, map[string]interface{}, func(db.ClientCert) (string, error), func() error) ([]db.ClientCert, error) {
+	return func(ifname string, values map[string]interface{}, render func(cert db.ClientCert) (string, error), apply func() error) ([]db.ClientCert, error) {
+		for _, cert := range certs {
+			config, err := render(cert)
+			if err != nil {
+				return nil, err
+			}
+			*configs = append(*configs, config)
+		}
+		return certs, apply()
+	}
+}
+
+func TestUpdateInterfaceStopped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	serverRepo := NewMockServerRepo(ctrl)
+	clientRepo := NewMockClientRepo(ctrl)
+	u := &Usecases{ServerRepo: serverRepo, ClientRepo: clientRepo}
+
+	serv := db.ServerCert{Ifname: stoppedIfname, Ip: "10.0.0.1/24,fd00::1/64", Public: testPublic, Endpoint: "vpn.example.com", Port: 51820}
+	certs := []db.ClientCert{
+		{Ifname: stoppedIfname, Public: "pub1", IP: "10.0.0.2/24,fd00::2/64"},
+		{Ifname: stoppedIfname, Public: "pub2", IP: "10.0.0.3/24", Profile: "office"},
+	}
+	serverRepo.EXPECT().GetServerCertByIfname(stoppedIfname).Return(serv, nil)
+	clientRepo.EXPECT().GetProfiles().Return([]db.RoutingProfile{{Name: "office", Routes: "192.168.5.0/24"}}, nil)
+	var configs []string
+	serverRepo.EXPECT().UpdateServer(stoppedIfname, gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(updateServer(certs, &configs))
+
+	dns := "10.0.0.53"
+	update, err := u.UpdateInterface(stoppedIfname, InterfaceChanges{Dns: &dns})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pub1", "pub2"}, update.Clients)
+	require.Len(t, configs, 2)
+	assert.Contains(t, configs[0], "AllowedIPs = 10.0.0.0/24,fd00::/64\n")
+	assert.Contains(t, configs[0], "DNS = 10.0.0.53\n")
+	assert.Contains(t, configs[1], "AllowedIPs = 10.0.0.0/24,192.168.5.0/24,fd00::/64\n")
+	assert.Contains(t, configs[1], "Endpoint = vpn.example.com:51820\n")
+}
+
+func TestUpdateInterfaceIPv6Endpoint(t *testing.T) {
+	for _, endpoint := range []string{"2001:db8::1", "[2001:db8::1]"} {
+		t.Run(endpoint, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			serverRepo := NewMockServerRepo(ctrl)
+			clientRepo := NewMockClientRepo(ctrl)
+			u := &Usecases{ServerRepo: serverRepo, ClientRepo: clientRepo}
+
+			serv := db.ServerCert{Ifname: stoppedIfname, Ip: "fd00::1/64", Public: testPublic, Endpoint: "vpn.example.com", Port: 51820}
+			certs := []db.ClientCert{{Ifname: stoppedIfname, Public: "pub1", IP: "fd00::2/64"}}
+			serverRepo.EXPECT().GetServerCertByIfname(stoppedIfname).Return(serv, nil)
+			clientRepo.EXPECT().GetProfiles().Return(nil, nil)
+			var configs []string
+			serverRepo.EXPECT().UpdateServer(stoppedIfname, gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(updateServer(certs, &configs))
+
+			_, err := u.UpdateInterface(stoppedIfname, InterfaceChanges{Endpoint: &endpoint})
+			require.NoError(t, err)
+			require.Len(t, configs, 1)
+			assert.Contains(t, configs[0], "Endpoint = [2001:db8::1]:51820\n")
+		})
+	}
+}
+
+func TestRotateInterfaceKeyStopped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	serverRepo := NewMockServerRepo(ctrl)
+	clientRepo := NewMockClientRepo(ctrl)
+	u := &Usecases{ServerRepo: serverRepo, ClientRepo: clientRepo}
+
+	serv := db.ServerCert{Ifname: stoppedIfname, Ip: "fd00::1/64", Public: testPublic, Endpoint: "vpn.example.com", Port: 51820}
+	certs := []db.ClientCert{{Ifname: stoppedIfname, Public: "pub1", IP: "fd00::2/64", AllowedIPs: "fd01::/64"}}
+	serverRepo.EXPECT().GetServerCertByIfname(stoppedIfname).Return(serv, nil)
+	clientRepo.EXPECT().GetProfiles().Return(nil, nil)
+	var configs []string
+	withKey := updateServer(certs, &configs)
+	serverRepo.EXPECT().UpdateServer(stoppedIfname, gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ifname string, values map[string]interface{}, render func(db.ClientCert) (string, error), apply func() error) ([]db.ClientCert, error) {
+			// reconcile waits until key of device is committed
+			assert.False(t, u.allocMu.TryLock())
+			return withKey(ifname, values, render, apply)
+		})
+
+	update, err := u.RotateInterfaceKey(stoppedIfname)
+	require.NoError(t, err)
+	assert.NotEqual(t, testPublic, update.Public)
+	assert.Equal(t, []string{"pub1"}, update.Clients)
+	require.Len(t, configs, 1)
+	assert.Contains(t, configs[0], "PublicKey = "+update.Public+"\n")
+	assert.Contains(t, configs[0], "AllowedIPs = fd00::/64,fd01::/64\n")
+}
+
+// fakeLinks is LinkManager which records calls and returns errors set by operation name
+type fakeLinks struct {
+	calls []string
+	errs  map[string]error
+}
+
+func (f *fakeLinks) call(op, arg string) error {
+	f.calls = append(f.calls, op+" "+arg)
+	return f.errs[op]
+}
+
+func (f *fakeLinks) AddLink(ifname string) error          { return f.call("add", ifname) }
+func (f *fakeLinks) AddAddress(ifname, cidr string) error { return f.call("addr", ifname+" "+cidr) }
+func (f *fakeLinks) SetUp(ifname string) error            { return f.call("up", ifname) }
+func (f *fakeLinks) SetDown(ifname string) error          { return f.call("down", ifname) }
+func (f *fakeLinks) DeleteLink(ifname string) error       { return f.call("delete", ifname) }
+
+func linkErr(op string, err error) error {
+	return &wg.LinkError{Op: op, Ifname: stoppedIfname, Err: err}
+}
+
+func TestStartInterface(t *testing.T) {
+	tests := []struct {
+		name      string
+		repoErr   error
+		private   string
+		errs      map[string]error
+		wantCalls []string
+		wantErr   error
+	}{
+		{name: "interface not found", repoErr: gorm.ErrRecordNotFound, wantErr: gorm.ErrRecordNotFound},
+		{name: "link exists", errs: map[string]error{"add": linkErr("add link", wg.ErrExists)}, wantCalls: []string{"add " + stoppedIfname}, wantErr: wg.ErrExists},
+		{name: "no permission", errs: map[string]error{"add": linkErr("add link", wg.ErrPermission)}, wantCalls: []string{"add " + stoppedIfname}, wantErr: wg.ErrPermission},
+		{
+			name:      "address fails and link is removed",
+			errs:      map[string]error{"addr": linkErr("add address", wg.ErrExists)},
+			wantCalls: []string{"add " + stoppedIfname, "addr " + stoppedIfname + " 10.0.0.1/24", "delete " + stoppedIfname},
+			wantErr:   wg.ErrExists,
+		},
+		{
+			name:      "up fails and link is removed",
+			errs:      map[string]error{"up": linkErr("set up", wg.ErrNoDevice)},
+			wantCalls: []string{"add " + stoppedIfname, "addr " + stoppedIfname + " 10.0.0.1/24", "addr " + stoppedIfname + " fd00::1/64", "up " + stoppedIfname, "delete " + stoppedIfname},
+			wantErr:   wg.ErrNoDevice,
+		},
+		{
+			name:      "bad key and link is removed",
+			private:   "bad",
+			wantCalls: []string{"add " + stoppedIfname, "addr " + stoppedIfname + " 10.0.0.1/24", "addr " + stoppedIfname + " fd00::1/64", "up " + stoppedIfname, "delete " + stoppedIfname},
+		},
+		{
+			// fake link is not a wireguard device, so configure fails
+			name:      "configure fails and link is removed",
+			private:   testPsk,
+			wantCalls: []string{"add " + stoppedIfname, "addr " + stoppedIfname + " 10.0.0.1/24", "addr " + stoppedIfname + " fd00::1/64", "up " + stoppedIfname, "delete " + stoppedIfname},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			serverRepo := NewMockServerRepo(ctrl)
+			links := &fakeLinks{errs: tt.errs}
+			u := &Usecases{ServerRepo: serverRepo, Links: links}
+			serverRepo.EXPECT().GetServerCertByIfname(stoppedIfname).
+				Return(db.ServerCert{Ifname: stoppedIfname, Ip: "10.0.0.1/24,fd00::1/64", Private: tt.private, Port: 51820}, tt.repoErr)
+
+			err := u.startInterface(stoppedIfname)
+			if tt.wantErr == nil {
+				assert.Error(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantCalls, links.calls)
+		})
+	}
+}
+
+func TestStopInterface(t *testing.T) {
+	links := &fakeLinks{}
+	u := &Usecases{Links: links}
+	assert.NoError(t, u.stopInterface(stoppedIfname))
+	assert.Equal(t, []string{"delete " + stoppedIfname}, links.calls)
+
+	links = &fakeLinks{errs: map[string]error{"delete": linkErr("delete link", wg.ErrNoDevice)}}
+	u = &Usecases{Links: links}
+	assert.ErrorIs(t, u.stopInterface(stoppedIfname), wg.ErrNoDevice)
+}
+
+func TestDeleteServer(t *testing.T) {
+	tests := []struct {
+		name      string
+		repoErr   error
+		deleteErr error
+		wantCalls []string
+		wantErr   error
+	}{
+		{name: "running interface", wantCalls: []string{"delete " + stoppedIfname}},
+		{name: "stopped interface", deleteErr: linkErr("delete link", wg.ErrNoDevice), wantCalls: []string{"delete " + stoppedIfname}},
+		{name: "no permission", deleteErr: linkErr("delete link", wg.ErrPermission), wantCalls: []string{"delete " + stoppedIfname}, wantErr: wg.ErrPermission},
+		{name: "not found in database", repoErr: gorm.ErrRecordNotFound, wantErr: gorm.ErrRecordNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			serverRepo := NewMockServerRepo(ctrl)
+			links := &fakeLinks{errs: map[string]error{"delete": tt.deleteErr}}
+			u := &Usecases{ServerRepo: serverRepo, Links: links}
+			serverRepo.EXPECT().DeleteServer(testPsk, stoppedIfname).Return(tt.repoErr)
+
+			err := u.DeleteServer(" "+testPsk+" ", stoppedIfname)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantCalls, links.calls)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package usecases
 
 import (
+	"sync"
 	"time"
 )
 
@@ -9,6 +10,20 @@ type Usecases struct {
 	ClientRepo ClientRepo
 	IpTables   IPTables
 	PingStatus PingService
+	Links      LinkManager
+	// retention of archived certificates, see PurgeLoop
+	ArchiveRetention time.Duration
+	// check of devices against database, see ReconcileLoop
+	ReconcileInterval time.Duration
+	ReconcilePolicy   string
+	// directory where wg-quick config of every interface is kept, empty turns it off
+	WgQuickDir string
+	wgQuickMu  sync.Mutex
+	// allocMu keeps two requests from taking the same address of client, it is held as well
+	// by every change of device made before commit and by reconcile which fixes devices
+	allocMu sync.Mutex
+	// interfaces stopped by API, they are not started again by ReconcileLoop
+	stopped sync.Map
 }
 
 var _ UsecaseService = (*Usecases)(nil)
@@ -18,14 +33,95 @@ type ClientResponsePing struct {
 	PintTime int64 `json:"ping_time"`
 }
 
+// ListOptions selects page of a list, Sort is a field name with "-" prefix for descending order,
+// Fields are json names of returned fields, empty Fields returns every field
+type ListOptions struct {
+	Limit  int
+	Offset int
+	Sort   string
+	Fields []string
+}
+
+type ClientMeta struct {
+	Name        string   `json:"name"`
+	Owner       string   `json:"owner"`
+	Email       string   `json:"email"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+// ConfigSettings are written to client configs, interface keeps settings of all its clients
+// and client can override them
+type ConfigSettings struct {
+	Dns       string `json:"dns,omitempty"` // comma separated DNS servers
+	Mtu       int    `json:"mtu,omitempty"`
+	Keepalive *int   `json:"keepalive,omitempty"` // PersistentKeepalive in seconds, 0 turns it off
+}
+
+// AddressPools limit addresses given to new clients of interface, entries are ranges "a-b",
+// single addresses or subnets. Empty pools mean the whole subnet of interface.
+type AddressPools struct {
+	Pools    []string `json:"pools,omitempty"`
+	Excluded []string `json:"excluded,omitempty"`
+}
+
+// ClientSpec describes new client
+type ClientSpec struct {
+	ClientMeta
+	ConfigSettings
+	Ifname    string
+	Ip        string
+	AllowedIp string
+	Profile   string
+	Public    string
+	Psk       *bool
+	ExpiresAt *time.Time
+}
+
 type ClientResponse struct {
-	Ifname     string             `json:"ifname"`
-	Private    string             `json:"private"`
-	Public     string             `json:"public"`
-	Ip         string             `json:"ip"`
-	AllowedIPs string             `json:"alloweip"`
-	Config     string             `json:"config"`
-	PingStatus ClientResponsePing `json:"ping_status"`
+	ClientMeta
+	// settings of client which override settings of interface
+	ConfigSettings
+	Ifname        string             `json:"ifname"`
+	Private       string             `json:"private"`
+	Public        string             `json:"public"`
+	Ip            string             `json:"ip"`
+	AllowedIPs    string             `json:"alloweip"`
+	Profile       string             `json:"profile"`
+	Config        string             `json:"config"`
+	PresharedKey  string             `json:"preshared_key"`
+	Disabled      bool               `json:"disabled"`
+	ExpiresAt     *time.Time         `json:"expires_at,omitempty"`
+	Reason        string             `json:"reason,omitempty"` // reason of moving to archive
+	Quota         *ClientQuota       `json:"quota,omitempty"`
+	PingStatus    ClientResponsePing `json:"ping_status"`
+	CreatedAt     *time.Time         `json:"created_at,omitempty"`
+	LastHandshake *time.Time         `json:"last_handshake,omitempty"`
+	DeletedAt     *time.Time         `json:"deleted_at,omitempty"` // time of moving to archive
+	ArchiveId     uint               `json:"archive_id,omitempty"` // id of archive record used to restore client
+}
+
+// RoutingProfile is named list of routes added to AllowedIPs of client configs
+type RoutingProfile struct {
+	Name        string     `json:"name"`
+	Routes      []string   `json:"routes"`
+	Description string     `json:"description"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+}
+
+// ProfileUpdate lists public keys of clients which config was changed by profile update,
+// these clients have to download the config again
+type ProfileUpdate struct {
+	RoutingProfile
+	Clients []string `json:"clients"`
+}
+
+type ClientQuota struct {
+	Quota    int64  `json:"quota"`
+	Period   string `json:"period"`
+	Exceeded bool   `json:"exceeded"`
+	UsageRx  int64  `json:"usage_rx"`
+	UsageTx  int64  `json:"usage_tx"`
 }
 
 type InterfaceListStatus struct {
@@ -47,13 +143,87 @@ type AllowerIP struct {
 }
 
 type ServerInterfaces struct {
+	// settings written to configs of clients
+	ConfigSettings
+	// addresses of new clients
+	AddressPools
+	Ifname     string     `json:"ifname"`
+	Ip         string     `json:"ip"`
+	Port       int        `json:"port"`
+	Private    string     `json:"private"`
+	Public     string     `json:"public"`
+	Endpoint   string     `json:"endpoint"`
+	Config     string     `json:"config"`
+	DefaultPsk bool       `json:"default_psk"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	ArchiveId  uint       `json:"archive_id,omitempty"`
+}
+
+// InterfaceChanges lists settings of interface to change, nil fields stay the same
+type InterfaceChanges struct {
+	Endpoint  *string
+	Port      *int
+	Dns       *string
+	Mtu       *int
+	Keepalive *int
+	Pools     *[]string
+	Excluded  *[]string
+}
+
+// InterfaceUpdate lists public keys of clients which config was changed by interface update,
+// these clients have to download the config again
+type InterfaceUpdate struct {
+	ServerInterfaces
+	Clients []string `json:"clients"`
+}
+
+// Drift is difference of device from database, Expected and Actual are set for
+// listen port and allowed IPs
+type Drift struct {
 	Ifname   string `json:"ifname"`
-	Ip       string `json:"ip"`
-	Port     int    `json:"port"`
-	Private  string `json:"private"`
-	Public   string `json:"public"`
-	Endpoint string `json:"endpoint"`
-	Config   string `json:"config"`
+	Public   string `json:"public,omitempty"`
+	Kind     string `json:"kind"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Fixed    bool   `json:"fixed"`
+	Error    string `json:"error,omitempty"`
+}
+
+type DriftReport struct {
+	CheckedAt *time.Time `json:"checked_at"`
+	Policy    string     `json:"policy"`
+	Drift     []Drift    `json:"drift"`
+}
+
+type RestoredInterface struct {
+	ServerInterfaces
+	Clients []ClientResponse `json:"clients"`
+	Failed  []RestoreFailure `json:"failed,omitempty"` // clients which were not restored
+}
+
+// ImportSpec is wg-quick config of server, Clients are wg-quick configs of clients
+// used to find private keys of peers
+type ImportSpec struct {
+	Ifname   string
+	Endpoint string
+	Config   string
+	Clients  []string
+	Adopt    bool // use running device instead of creating it
+}
+
+type ImportedInterface struct {
+	ServerInterfaces
+	Clients      []ClientResponse `json:"clients"`
+	NoPrivateKey []string         `json:"no_private_key"`    // public keys of peers which configs have no private key
+	Ignored      []string         `json:"ignored,omitempty"` // keys of config which were not imported
+}
+
+type RestoreFailure struct {
+	ArchiveId uint   `json:"archive_id"`
+	Public    string `json:"public"`
+	Ip        string `json:"ip"`
+	Error     string `json:"error"`
 }
 
 type UsForward struct {
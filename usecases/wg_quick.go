@@ -0,0 +1,126 @@
+package usecases
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"wireguard_api/db"
+)
+
+// wgQuickHeader is the first line of server configs rendered by API, file without it
+// was written by someone else and is kept as <ifname>.conf.orig before the first sync
+const wgQuickHeader = "# managed by wireguard_api, changes of this file are overwritten\n"
+
+// GetServerConfig returns wg-quick config of interface with a [Peer] for every enabled client.
+func (u *Usecases) GetServerConfig(ifname string) (string, error) {
+	ifname = strings.TrimSpace(ifname)
+	serv, err := u.ServerRepo.GetServerCertByIfname(ifname)
+	if err != nil {
+		log.Printf("GetServerConfig %v", err)
+		return "", fmt.Errorf("interface %s not found", ifname)
+	}
+	certs, err := u.ClientRepo.GetClientCertsByIfname(ifname)
+	if err != nil {
+		log.Printf("GetServerConfig %v", err)
+		return "", err
+	}
+	return u.renderServerConfig(serv, certs)
+}
+
+// renderServerConfig appends peers of enabled clients to [Interface] of server config,
+// AllowedIPs of a peer are the same as on the running device.
+func (u *Usecases) renderServerConfig(serv db.ServerCert, certs []db.ClientCert) (string, error) {
+	var builder strings.Builder
+	builder.WriteString(wgQuickHeader)
+	builder.WriteString(serv.Config)
+	for _, cert := range certs {
+		if cert.Disabled {
+			continue
+		}
+		peer, err := u.peerConfig(cert.IP, cert.AllowedIPs, cert.Public, cert.PresharedKey)
+		if err != nil {
+			return "", err
+		}
+		allowedIps := make([]string, 0, len(peer.AllowedIPs))
+		for _, v := range peer.AllowedIPs {
+			allowedIps = append(allowedIps, v.String())
+		}
+		builder.WriteString("\n")
+		// name is written on one line, so it cannot add keys like PostUp to the config
+		if name := strings.Join(strings.Fields(cert.Name), " "); name != "" {
+			builder.WriteString(fmt.Sprintf("# Name = %s\n", name))
+		}
+		builder.WriteString("[Peer]\n")
+		builder.WriteString(fmt.Sprintf("PublicKey = %s\n", cert.Public))
+		if cert.PresharedKey != "" {
+			builder.WriteString(fmt.Sprintf("PresharedKey = %s\n", cert.PresharedKey))
+		}
+		builder.WriteString(fmt.Sprintf("AllowedIPs = %s\n", strings.Join(allowedIps, ", ")))
+	}
+	return builder.String(), nil
+}
+
+// syncWgQuick writes config of interface to WgQuickDir after its clients or settings were
+// changed, so wg-quick can bring the interface up when API is down. Errors are only logged,
+// the change is already saved in database.
+func (u *Usecases) syncWgQuick(ifname string) {
+	if u.WgQuickDir == "" {
+		return
+	}
+	u.wgQuickMu.Lock()
+	defer u.wgQuickMu.Unlock()
+	config, err := u.GetServerConfig(ifname)
+	if err != nil {
+		log.Printf("syncWgQuick %v", err)
+		return
+	}
+	err = writeWgQuick(filepath.Join(u.WgQuickDir, ifname+".conf"), config)
+	if err != nil {
+		log.Printf("syncWgQuick %v", err)
+	}
+}
+
+// removeWgQuick removes config of deleted interface from WgQuickDir.
+func (u *Usecases) removeWgQuick(ifname string) {
+	if u.WgQuickDir == "" {
+		return
+	}
+	u.wgQuickMu.Lock()
+	defer u.wgQuickMu.Unlock()
+	err := os.Remove(filepath.Join(u.WgQuickDir, ifname+".conf"))
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("removeWgQuick %v", err)
+	}
+}
+
+// writeWgQuick replaces file by rename, so wg-quick never reads half written config.
+func writeWgQuick(path, config string) error {
+	old, err := os.ReadFile(path)
+	if err == nil && !strings.HasPrefix(string(old), wgQuickHeader) {
+		if _, err := os.Stat(path + ".orig"); os.IsNotExist(err) {
+			if err := os.WriteFile(path+".orig", old, 0600); err != nil {
+				return err
+			}
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// CreateTemp makes file with mode 0600, config keeps private key of server
+	if _, err := tmp.WriteString(config); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,130 @@
+package usecases
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"wireguard_api/db"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files of testdata")
+
+func TestRenderServerConfig(t *testing.T) {
+	u := &Usecases{}
+	tests := []struct {
+		name   string
+		golden string
+		serv   db.ServerCert
+		certs  []db.ClientCert
+	}{
+		{
+			name:   "no clients",
+			golden: "server_empty.conf",
+			serv:   db.ServerCert{Config: u.createServerCert(testPsk, "10.0.0.1/24", 51820)},
+		},
+		{
+			name:   "dual-stack",
+			golden: "server_dual_stack.conf",
+			serv:   db.ServerCert{Config: u.createServerCert(testPsk, "10.0.0.1/24,fd00::1/64", 51820)},
+			certs: []db.ClientCert{
+				{Name: "laptop of alice", Public: testPublic, IP: "10.0.0.2/24,fd00::2/64", AllowedIPs: "192.168.5.0/24"},
+				{Name: "disabled", Public: testPublic2, IP: "10.0.0.3/24", Disabled: true},
+				{Name: "phone\nPostUp = reboot", Public: testPsk, IP: "fd00::4/64", PresharedKey: testPsk},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := u.renderServerConfig(tt.serv, tt.certs)
+			require.NoError(t, err)
+			golden := filepath.Join("testdata", tt.golden)
+			if *update {
+				require.NoError(t, os.WriteFile(golden, []byte(config), 0644))
+			}
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), config)
+
+			// rendered config is read back by import
+			cfg, err := parseWgQuick(config)
+			require.NoError(t, err)
+			assert.Empty(t, cfg.Ignored)
+			for _, cert := range tt.certs {
+				if cert.Disabled {
+					continue
+				}
+				require.NotEmpty(t, cfg.Peers)
+				assert.Equal(t, cert.Public, cfg.Peers[0].Public)
+				cfg.Peers = cfg.Peers[1:]
+			}
+			assert.Empty(t, cfg.Peers)
+		})
+	}
+}
+
+func TestRenderServerConfigBadClient(t *testing.T) {
+	u := &Usecases{}
+	_, err := u.renderServerConfig(db.ServerCert{}, []db.ClientCert{{Public: testPublic, IP: "10.0.0.2"}})
+	assert.Error(t, err)
+}
+
+func TestWriteWgQuick(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "wg0.conf")
+
+	// config written by someone else is kept once
+	require.NoError(t, os.WriteFile(path, []byte("[Interface]\n"), 0644))
+	// open file keeps its inode from being reused by the new file
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	old, err := f.Stat()
+	require.NoError(t, err)
+	require.NoError(t, writeWgQuick(path, wgQuickHeader+"first\n"))
+	require.NoError(t, writeWgQuick(path, wgQuickHeader+"second\n"))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, wgQuickHeader+"second\n", string(data))
+	orig, err := os.ReadFile(path + ".orig")
+	require.NoError(t, err)
+	assert.Equal(t, "[Interface]\n", string(orig))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	// file is replaced by rename, not written in place
+	assert.False(t, os.SameFile(old, info))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, v := range entries {
+		names = append(names, v.Name())
+	}
+	assert.Equal(t, []string{"wg0.conf", "wg0.conf.orig"}, names)
+}
+
+func TestWriteWgQuickNoDir(t *testing.T) {
+	err := writeWgQuick(filepath.Join(t.TempDir(), "missing", "wg0.conf"), wgQuickHeader)
+	assert.Error(t, err)
+}
+
+func TestDeleteClientNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// nothing is read for sync of config when client is not found
+	clientRepo := NewMockClientRepo(ctrl)
+	clientRepo.EXPECT().DeleteClientCert(testPublic, db.ReasonDeleted).Return(db.ClientCert{}, nil)
+	u := &Usecases{ClientRepo: clientRepo, ServerRepo: NewMockServerRepo(ctrl), WgQuickDir: t.TempDir()}
+
+	err := u.DeleteClient(" " + testPublic + " ")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+}
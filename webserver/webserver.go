@@ -29,6 +29,8 @@ func (c *Server) StartWebServer(ctx context.Context, cfg *config.ServerConfig) {
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
+	// public keys in url contain '/' and have to be escaped as %2F
+	r.UseRawPath = true
 	r.Use(checkIpAccess(cfg))
 	r.Use(checkToken(cfg))
 
@@ -36,12 +38,20 @@ func (c *Server) StartWebServer(ctx context.Context, cfg *config.ServerConfig) {
 	r.GET("/version", ctrl.GetVersion)
 
 	//server certs
-	r.POST("/interface/new", ctrl.AddInterface) // create new interface and server certificate
+	r.POST("/interface/new", ctrl.AddInterface)           // create new interface and server certificate
+	r.POST("/interface/import", ctrl.CtrlImportInterface) // create interface and clients from wg-quick config
 	r.DELETE("/interface", ctrl.CtrlDeleteServer)
+	r.PATCH("/interface/:ifname", ctrl.CtrlUpdateInterface) // new settings are written to configs of all clients
+	r.POST("/interface/:ifname/rotate-key", ctrl.CtrlRotateInterfaceKey)
 	r.POST("/interface/stop", ctrl.CtrlStopServer)
 	r.POST("/interface/start", ctrl.CtrlStartServer)
 	r.GET("/interface/all", ctrl.CtrlGetInterfaces)
 	r.GET("/interface/archive", ctrl.CtrlGetServerArchive)
+	r.POST("/interface/archive/:id/restore", ctrl.CtrlRestoreInterface)
+	r.DELETE("/interface/archive/:id", ctrl.CtrlDeleteServerArchive)
+	r.GET("/interface/:ifname/export", ctrl.CtrlExportInterface) // zip with configs of all clients
+	r.GET("/interface/:ifname/config", ctrl.CtrlGetServerConfig) // wg-quick config of server with all peers
+	r.GET("/drift", ctrl.CtrlGetDrift)                           // differences of devices from database
 	// iptables
 	r.POST("/server/forward", ctrl.SetForward)
 	r.POST("/server/forward/updateList", ctrl.SetForwardUpdateList)
@@ -50,10 +60,25 @@ func (c *Server) StartWebServer(ctx context.Context, cfg *config.ServerConfig) {
 
 	//clients certs
 	r.POST("/clients/new", ctrl.AddClient)
+	r.POST("/clients/bulk", ctrl.AddClients)
 	r.DELETE("/clients", ctrl.DeleteClient)
+	r.POST("/clients/disable", ctrl.DisableClient)
+	r.POST("/clients/enable", ctrl.EnableClient)
+	r.POST("/clients/quota", ctrl.SetClientQuota)
 	r.GET("/clients/getall", ctrl.GetAllClients)
 	r.GET("/clients/status", ctrl.GetStatus)
 	r.GET("/clients/archive", ctrl.GetClientArchive)
+	r.POST("/clients/archive/:id/restore", ctrl.RestoreClient)
+	r.DELETE("/clients/archive/:id", ctrl.DeleteClientArchive)
+	r.GET("/clients/:public/qr", ctrl.GetClientQR)
+	r.PATCH("/clients/:public", ctrl.UpdateClient)
+	r.POST("/clients/:public/rotate", ctrl.RotateClient)
+
+	// routing profiles
+	r.GET("/profiles", ctrl.GetProfiles)
+	r.POST("/profiles/new", ctrl.AddProfile)
+	r.PATCH("/profiles/:name", ctrl.UpdateProfile) // new routes are written to configs of all clients of profile
+	r.DELETE("/profiles/:name", ctrl.DeleteProfile)
 
 	server := &http.Server{
 		Addr:    cfg.IpPort,
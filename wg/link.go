@@ -0,0 +1,173 @@
+package wg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// errors of link operations, LinkError wraps one of them when kernel returned known errno
+var (
+	ErrExists     = errors.New("already exists")
+	ErrNoDevice   = errors.New("no such device")
+	ErrPermission = errors.New("permission denied")
+)
+
+// LinkError is error of link operation on interface
+type LinkError struct {
+	Op     string
+	Ifname string
+	Err    error
+}
+
+func (e *LinkError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Ifname, e.Err)
+}
+
+func (e *LinkError) Unwrap() error {
+	return e.Err
+}
+
+func linkError(op, ifname string, err error) error {
+	switch {
+	case errors.Is(err, unix.EEXIST):
+		err = ErrExists
+	case errors.Is(err, unix.ENODEV):
+		err = ErrNoDevice
+	case errors.Is(err, unix.EPERM), errors.Is(err, unix.EACCES):
+		err = ErrPermission
+	}
+	return &LinkError{Op: op, Ifname: ifname, Err: err}
+}
+
+// NetlinkManager creates wireguard links and their addresses by rtnetlink,
+// every call opens its own netlink socket
+type NetlinkManager struct{}
+
+func NewLinkManager() *NetlinkManager {
+	return &NetlinkManager{}
+}
+
+func (m *NetlinkManager) execute(op, ifname string, typ uint16, flags netlink.HeaderFlags, data []byte) error {
+	conn, err := netlink.Dial(unix.NETLINK_ROUTE, nil)
+	if err != nil {
+		return linkError(op, ifname, err)
+	}
+	defer conn.Close()
+	_, err = conn.Execute(netlink.Message{
+		Header: netlink.Header{Type: netlink.HeaderType(typ), Flags: netlink.Request | netlink.Acknowledge | flags},
+		Data:   data,
+	})
+	if err != nil {
+		return linkError(op, ifname, err)
+	}
+	return nil
+}
+
+// ifInfomsg encodes struct ifinfomsg
+func ifInfomsg(index int32, flags, change uint32) []byte {
+	b := make([]byte, unix.SizeofIfInfomsg)
+	b[0] = unix.AF_UNSPEC
+	binary.NativeEndian.PutUint32(b[4:8], uint32(index))
+	binary.NativeEndian.PutUint32(b[8:12], flags)
+	binary.NativeEndian.PutUint32(b[12:16], change)
+	return b
+}
+
+// linkMessage is ifinfomsg followed by IFLA_IFNAME, kernel finds link by name when index is 0
+func linkMessage(ifname string, flags, change uint32, attrs func(ae *netlink.AttributeEncoder)) ([]byte, error) {
+	ae := netlink.NewAttributeEncoder()
+	ae.String(unix.IFLA_IFNAME, ifname)
+	if attrs != nil {
+		attrs(ae)
+	}
+	b, err := ae.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return append(ifInfomsg(0, flags, change), b...), nil
+}
+
+// addrMessage encodes struct ifaddrmsg with IFA_LOCAL and IFA_ADDRESS of cidr
+func addrMessage(index int, cidr string) ([]byte, error) {
+	ip, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	family, addr := unix.AF_INET6, ip.To16()
+	if ip4 := ip.To4(); ip4 != nil {
+		family, addr = unix.AF_INET, ip4
+	}
+	bits, _ := subnet.Mask.Size()
+	b := make([]byte, unix.SizeofIfAddrmsg)
+	b[0] = byte(family)
+	b[1] = byte(bits)
+	b[3] = unix.RT_SCOPE_UNIVERSE
+	binary.NativeEndian.PutUint32(b[4:8], uint32(index))
+	ae := netlink.NewAttributeEncoder()
+	ae.Bytes(unix.IFA_LOCAL, addr)
+	ae.Bytes(unix.IFA_ADDRESS, addr)
+	attrs, err := ae.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return append(b, attrs...), nil
+}
+
+// AddLink creates link of type wireguard, like "ip link add dev <ifname> type wireguard"
+func (m *NetlinkManager) AddLink(ifname string) error {
+	data, err := linkMessage(ifname, 0, 0, func(ae *netlink.AttributeEncoder) {
+		ae.Nested(unix.IFLA_LINKINFO, func(nae *netlink.AttributeEncoder) error {
+			nae.String(unix.IFLA_INFO_KIND, "wireguard")
+			return nil
+		})
+	})
+	if err != nil {
+		return linkError("add link", ifname, err)
+	}
+	return m.execute("add link", ifname, unix.RTM_NEWLINK, netlink.Create|netlink.Excl, data)
+}
+
+// AddAddress adds address with mask to link, like "ip addr add <cidr> dev <ifname>"
+func (m *NetlinkManager) AddAddress(ifname, cidr string) error {
+	iface, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return linkError("add address "+cidr, ifname, unix.ENODEV)
+	}
+	data, err := addrMessage(iface.Index, cidr)
+	if err != nil {
+		return linkError("add address "+cidr, ifname, err)
+	}
+	return m.execute("add address "+cidr, ifname, unix.RTM_NEWADDR, netlink.Create|netlink.Excl, data)
+}
+
+// SetUp brings link up, like "ip link set <ifname> up"
+func (m *NetlinkManager) SetUp(ifname string) error {
+	data, err := linkMessage(ifname, unix.IFF_UP, unix.IFF_UP, nil)
+	if err != nil {
+		return linkError("set up", ifname, err)
+	}
+	return m.execute("set up", ifname, unix.RTM_NEWLINK, 0, data)
+}
+
+// SetDown brings link down, like "ip link set <ifname> down"
+func (m *NetlinkManager) SetDown(ifname string) error {
+	data, err := linkMessage(ifname, 0, unix.IFF_UP, nil)
+	if err != nil {
+		return linkError("set down", ifname, err)
+	}
+	return m.execute("set down", ifname, unix.RTM_NEWLINK, 0, data)
+}
+
+// DeleteLink removes link with its addresses, like "ip link del dev <ifname>"
+func (m *NetlinkManager) DeleteLink(ifname string) error {
+	data, err := linkMessage(ifname, 0, 0, nil)
+	if err != nil {
+		return linkError("delete link", ifname, err)
+	}
+	return m.execute("delete link", ifname, unix.RTM_DELLINK, 0, data)
+}
@@ -0,0 +1,62 @@
+package wg
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/mdlayher/netlink"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestLinkError(t *testing.T) {
+	err := linkError("add link", "wg0", &netlink.OpError{Op: "receive", Err: unix.EEXIST})
+	assert.ErrorIs(t, err, ErrExists)
+	assert.EqualError(t, err, "add link wg0: already exists")
+
+	assert.ErrorIs(t, linkError("delete link", "wg0", unix.ENODEV), ErrNoDevice)
+	assert.ErrorIs(t, linkError("set up", "wg0", unix.EPERM), ErrPermission)
+	assert.ErrorIs(t, linkError("set up", "wg0", unix.EACCES), ErrPermission)
+
+	other := errors.New("message too long")
+	err = linkError("add link", "wg0", other)
+	assert.ErrorIs(t, err, other)
+	var linkErr *LinkError
+	assert.True(t, errors.As(err, &linkErr))
+	assert.Equal(t, "wg0", linkErr.Ifname)
+}
+
+func TestLinkMessage(t *testing.T) {
+	data, err := linkMessage("wg0", unix.IFF_UP, unix.IFF_UP, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(unix.IFF_UP), binary.NativeEndian.Uint32(data[8:12]))
+	assert.Equal(t, uint32(unix.IFF_UP), binary.NativeEndian.Uint32(data[12:16]))
+
+	attrs, err := netlink.NewAttributeDecoder(data[unix.SizeofIfInfomsg:])
+	assert.NoError(t, err)
+	assert.True(t, attrs.Next())
+	assert.Equal(t, uint16(unix.IFLA_IFNAME), attrs.Type())
+	assert.Equal(t, "wg0", attrs.String())
+}
+
+func TestAddrMessage(t *testing.T) {
+	data, err := addrMessage(7, "10.0.0.1/24")
+	assert.NoError(t, err)
+	assert.Equal(t, byte(unix.AF_INET), data[0])
+	assert.Equal(t, byte(24), data[1])
+	assert.Equal(t, uint32(7), binary.NativeEndian.Uint32(data[4:8]))
+	attrs, err := netlink.NewAttributeDecoder(data[unix.SizeofIfAddrmsg:])
+	assert.NoError(t, err)
+	assert.True(t, attrs.Next())
+	assert.Equal(t, uint16(unix.IFA_LOCAL), attrs.Type())
+	assert.Equal(t, []byte{10, 0, 0, 1}, attrs.Bytes())
+
+	data, err = addrMessage(7, "fd00::1/64")
+	assert.NoError(t, err)
+	assert.Equal(t, byte(unix.AF_INET6), data[0])
+	assert.Equal(t, byte(64), data[1])
+
+	_, err = addrMessage(7, "10.0.0.1")
+	assert.Error(t, err)
+}